@@ -4,10 +4,19 @@ import (
 	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/rand"
 	"encoding/base64"
+	"errors"
 )
 
-var Key = []byte("lgqgg56oi9a9tefl")
+var (
+	Key = []byte("lgqgg56oi9a9tefl")
+
+	// ErrAuthFailed is returned if the encrypted data is modified, or decrypted with a wrong key.
+	ErrAuthFailed = errors.New("aescode: message authentication failed")
+	// ErrBadPadding is returned if the CBC encrypted data is not padded correctly.
+	ErrBadPadding = errors.New("aescode: bad padding")
+)
 
 func PKCS7Padding(ciphertext []byte, blockSize int) []byte {
 	padding := blockSize - len(ciphertext)%blockSize
@@ -44,9 +53,85 @@ func AesDecrypt(cryptedStr string, key []byte) (string, error) {
 		return "", err
 	}
 	blockSize := block.BlockSize()
+	if len(crypted) == 0 || len(crypted)%blockSize != 0 {
+		return "", ErrBadPadding
+	}
 	blockMode := cipher.NewCBCDecrypter(block, key[:blockSize])
 	origData := make([]byte, len(crypted))
 	blockMode.CryptBlocks(origData, crypted)
+	if padding := int(origData[len(origData)-1]); padding == 0 || padding > blockSize {
+		return "", ErrBadPadding
+	}
 	origData = PKCS7UnPadding(origData)
 	return string(origData), nil
 }
+
+// GcmEncrypt encrypts and authenticates plain with AES-GCM, the key is 16, 24 or 32 bytes,
+// the random nonce is prepended to the sealed data.
+func GcmEncrypt(plain, key []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plain)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plain, nil), nil
+}
+
+// GcmDecrypt decrypts the data sealed by GcmEncrypt, ErrAuthFailed is returned if
+// the data is modified or the key is wrong.
+func GcmDecrypt(sealed, key []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrAuthFailed
+	}
+
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrAuthFailed
+	}
+
+	return plain, nil
+}
+
+// GcmEncryptString is GcmEncrypt with the base64 encoded result.
+func GcmEncryptString(plain string, key []byte) (string, error) {
+	sealed, err := GcmEncrypt([]byte(plain), key)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// GcmDecryptString decrypts the base64 encoded result of GcmEncryptString.
+func GcmDecryptString(sealed string, key []byte) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+
+	plain, err := GcmDecrypt(data, key)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plain), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,204 @@
+package apix
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/weblazy/core/logx"
+)
+
+const (
+	jsonLogFormat     = "json"
+	combinedLogFormat = "combined"
+	combinedTimeFmt   = "02/Jan/2006:15:04:05 -0700"
+	requestTimeFmt    = "2006-01-02T15:04:05.000Z07:00"
+)
+
+var trustedProxies []*net.IPNet
+
+type accessRecord struct {
+	RemoteAddr     string `json:"RemoteAddr"`
+	RequestTime    string `json:"RequestTime"`
+	DuringTime     string `json:"DuringTime"`
+	RequestMethod  string `json:"RequestMethod"`
+	Request        string `json:"Request"`
+	ServerProtocol string `json:"ServerProtocol"`
+	Host           string `json:"Host"`
+	Status         int    `json:"Status"`
+	HTTPReferrer   string `json:"HTTPReferrer"`
+	HTTPUserAgent  string `json:"HTTPUserAgent"`
+	RemoteUser     string `json:"RemoteUser"`
+	BodyBytesSent  int64  `json:"BodyBytesSent"`
+	RequestID      string `json:"RequestID"`
+}
+
+// SetTrustedProxies sets the proxies allowed to report the client ip by X-Forwarded-For and X-Real-IP,
+// each of proxies is an ip or a cidr.
+// It's the package state for the requests served by ControllerRegister directly,
+// the Servers have their own trusted proxies by config.ApiConfig.TrustedProxies.
+func SetTrustedProxies(proxies []string) error {
+	nets, err := parseTrustedProxies(proxies)
+	if err != nil {
+		return err
+	}
+
+	trustedProxies = nets
+	return nil
+}
+
+func parseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", proxy)
+			}
+			if ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipNet)
+	}
+
+	return nets, nil
+}
+
+// ClientIP returns the ip of the client, X-Forwarded-For and X-Real-IP are only honoured
+// if the request comes from a trusted proxy, X-Forwarded-For is walked from right to left,
+// and the first address which is not a trusted proxy is the client.
+func ClientIP(r *http.Request) string {
+	remoteIP := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		remoteIP = host
+	}
+	proxies := stateOf(r).trustedProxies
+	if !isTrustedProxy(proxies, remoteIP) {
+		return remoteIP
+	}
+
+	if forwarded := r.Header.Get("X-Forwarded-For"); len(forwarded) > 0 {
+		ips := strings.Split(forwarded, ",")
+		for i := len(ips) - 1; i >= 0; i-- {
+			ip := strings.TrimSpace(ips[i])
+			if net.ParseIP(ip) == nil {
+				break
+			}
+			if i == 0 || !isTrustedProxy(proxies, ip) {
+				return ip
+			}
+		}
+	}
+
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+
+	return remoteIP
+}
+
+func isTrustedProxy(proxies []*net.IPNet, ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, ipNet := range proxies {
+		if ipNet.Contains(parsed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func remoteUser(r *http.Request) string {
+	if user, _, ok := r.BasicAuth(); ok {
+		return user
+	}
+
+	return r.Header.Get("Remote-User")
+}
+
+func writeAccessLog(ctx *Context, startTime time.Time) {
+	r := ctx.R
+	status := ctx.W.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	switch stateOf(r).conf.AccessLogFormat {
+	case combinedLogFormat:
+		logx.Access(formatCombined(r, status, ctx.W.Size, startTime, time.Since(startTime)))
+	default:
+		record := accessRecord{
+			RemoteAddr:     ClientIP(r),
+			RequestTime:    startTime.Format(requestTimeFmt),
+			DuringTime:     time.Since(startTime).String(),
+			RequestMethod:  r.Method,
+			Request:        fmt.Sprintf("%s %s %s", r.Method, r.RequestURI, r.Proto),
+			ServerProtocol: r.Proto,
+			Host:           r.Host,
+			Status:         status,
+			HTTPReferrer:   r.Header.Get("Referer"),
+			HTTPUserAgent:  r.Header.Get("User-Agent"),
+			RemoteUser:     remoteUser(r),
+			BodyBytesSent:  ctx.W.Size,
+			RequestID:      ctx.RequestID(),
+		}
+		content, err := json.Marshal(record)
+		if err != nil {
+			logx.Error(err)
+			return
+		}
+		logx.Access(string(content))
+	}
+}
+
+// formatCombined formats the request in apache combined log format, followed by the latency in seconds:
+// %h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-agent}i" %{ms}T
+func formatCombined(r *http.Request, status int, size int64, startTime time.Time, latency time.Duration) string {
+	var buf strings.Builder
+	buf.WriteString(ClientIP(r))
+	buf.WriteString(" - ")
+	buf.WriteString(dashIfEmpty(remoteUser(r)))
+	buf.WriteString(" [")
+	buf.WriteString(startTime.Format(combinedTimeFmt))
+	buf.WriteString("] ")
+	buf.WriteString(strconv.Quote(fmt.Sprintf("%s %s %s", r.Method, r.RequestURI, r.Proto)))
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.Itoa(status))
+	buf.WriteByte(' ')
+	if size > 0 {
+		buf.WriteString(strconv.FormatInt(size, 10))
+	} else {
+		buf.WriteByte('-')
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.Quote(dashIfEmpty(r.Header.Get("Referer"))))
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.Quote(dashIfEmpty(r.Header.Get("User-Agent"))))
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.FormatFloat(latency.Seconds(), 'f', 3, 64))
+	return buf.String()
+}
+
+func dashIfEmpty(s string) string {
+	if len(s) == 0 {
+		return "-"
+	}
+
+	return s
+}
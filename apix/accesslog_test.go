@@ -0,0 +1,92 @@
+package apix
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, err := parseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1", "2001:db8::/32"})
+	assert.Nil(t, err)
+	state := &serverState{trustedProxies: proxies}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		realIP     string
+		expect     string
+	}{
+		{"direct", "1.1.1.1:1234", "", "", "1.1.1.1"},
+		{"no port", "1.1.1.1", "", "", "1.1.1.1"},
+		{"spoofed forwarded from untrusted", "1.1.1.1:1234", "2.2.2.2", "", "1.1.1.1"},
+		{"spoofed real ip from untrusted", "1.1.1.1:1234", "", "2.2.2.2", "1.1.1.1"},
+		{"untrusted next to trusted ip", "192.168.1.2:1234", "2.2.2.2", "", "192.168.1.2"},
+		{"trusted", "10.0.0.1:1234", "2.2.2.2", "", "2.2.2.2"},
+		{"trusted ip", "192.168.1.1:1234", "2.2.2.2", "", "2.2.2.2"},
+		{"trusted ipv6", "[2001:db8::1]:1234", "2.2.2.2", "", "2.2.2.2"},
+		{"spoofed forwarded from trusted", "10.0.0.1:1234", "6.6.6.6, 2.2.2.2", "", "2.2.2.2"},
+		{"trusted chain", "10.0.0.1:1234", "6.6.6.6, 2.2.2.2, 10.0.0.3, 10.0.0.2", "", "2.2.2.2"},
+		{"all trusted", "10.0.0.1:1234", "10.0.0.3, 10.0.0.2", "", "10.0.0.3"},
+		{"invalid forwarded", "10.0.0.1:1234", "2.2.2.2, bogus", "", "10.0.0.1"},
+		{"invalid forwarded with real ip", "10.0.0.1:1234", "bogus", "3.3.3.3", "3.3.3.3"},
+		{"real ip from trusted", "10.0.0.1:1234", "", " 3.3.3.3 ", "3.3.3.3"},
+		{"invalid real ip", "10.0.0.1:1234", "", "bogus", "10.0.0.1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r = r.WithContext(context.WithValue(r.Context(), serverStateKey{}, state))
+			r.RemoteAddr = test.remoteAddr
+			if len(test.forwarded) > 0 {
+				r.Header.Set("X-Forwarded-For", test.forwarded)
+			}
+			if len(test.realIP) > 0 {
+				r.Header.Set("X-Real-IP", test.realIP)
+			}
+			assert.Equal(t, test.expect, ClientIP(r))
+		})
+	}
+}
+
+func TestSetTrustedProxies(t *testing.T) {
+	prev := trustedProxies
+	defer func() {
+		trustedProxies = prev
+	}()
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-Forwarded-For", "2.2.2.2")
+	assert.Equal(t, "10.0.0.1", ClientIP(r))
+	assert.Nil(t, SetTrustedProxies([]string{"10.0.0.0/8"}))
+	assert.Equal(t, "2.2.2.2", ClientIP(r))
+
+	for _, proxy := range []string{"bogus", "10.0.0.0/33", "10.0.0"} {
+		assert.NotNil(t, SetTrustedProxies([]string{proxy}), proxy)
+	}
+	assert.Len(t, trustedProxies, 1)
+}
+
+func TestFormatCombined(t *testing.T) {
+	startTime := time.Date(2020, time.March, 1, 8, 30, 0, 0, time.UTC)
+	r := httptest.NewRequest(http.MethodGet, "/users?id=1", nil)
+	r.RemoteAddr = "1.1.1.1:1234"
+	r.SetBasicAuth("kevin", "secret")
+	r.Header.Set("User-Agent", `curl/7.0 "quoted"`)
+	assert.Equal(t, `1.1.1.1 - kevin [01/Mar/2020:08:30:00 +0000] "GET /users?id=1 HTTP/1.1" 200 42 "-" `+
+		`"curl/7.0 \"quoted\"" 0.012`,
+		formatCombined(r, http.StatusOK, 42, startTime, 12*time.Millisecond+300*time.Microsecond))
+
+	r = httptest.NewRequest(http.MethodHead, "/", nil)
+	r.RemoteAddr = "1.1.1.1:1234"
+	r.Header.Set("Referer", "http://example.com/")
+	assert.Equal(t, `1.1.1.1 - - [01/Mar/2020:08:30:00 +0000] "HEAD / HTTP/1.1" 304 - "http://example.com/" "-" 1.500`,
+		formatCombined(r, http.StatusNotModified, 0, startTime, 1500*time.Millisecond))
+}
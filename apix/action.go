@@ -0,0 +1,111 @@
+package apix
+
+import (
+	"context"
+	"errors"
+	"reflect"
+)
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+
+	errActionSignature = errors.New("action must be like func(), func(ctx context.Context), " +
+		"optionally returning error or (result, error)")
+)
+
+// resultServer is implemented by Controller to serve the results of actions.
+type resultServer interface {
+	serveResult(result interface{}) error
+}
+
+// checkAction checks the signature of the action method, which has its receiver as the first argument.
+// An action takes nothing or a context.Context, and returns nothing, an error or a result with an error.
+func checkAction(method reflect.Type) error {
+	switch method.NumIn() {
+	case 1:
+	case 2:
+		if method.In(1) != contextType {
+			return errActionSignature
+		}
+	default:
+		return errActionSignature
+	}
+
+	switch method.NumOut() {
+	case 0:
+	case 1:
+		if method.Out(0) != errorType {
+			return errActionSignature
+		}
+	case 2:
+		if method.Out(1) != errorType {
+			return errActionSignature
+		}
+	default:
+		return errActionSignature
+	}
+
+	return nil
+}
+
+// actionResultType returns the type of the result returned by the action, nil if it returns no result.
+func actionResultType(method reflect.Type) reflect.Type {
+	if method.NumOut() != 2 {
+		return nil
+	}
+
+	return method.Out(0)
+}
+
+// callAction calls the action with ctx if it takes one, and returns its result and error.
+func callAction(action reflect.Value, ctx context.Context) (interface{}, error) {
+	var in []reflect.Value
+	if action.Type().NumIn() == 1 {
+		in = []reflect.Value{reflect.ValueOf(ctx)}
+	}
+
+	return actionResults(action.Call(in))
+}
+
+// callMethod calls the action method on the controller value, with ctx if it takes one.
+func callMethod(method reflect.Method, value reflect.Value, ctx context.Context) (interface{}, error) {
+	if method.Type.NumIn() == 2 {
+		return actionResults(method.Func.Call([]reflect.Value{value, reflect.ValueOf(ctx)}))
+	}
+
+	return actionResults(method.Func.Call([]reflect.Value{value}))
+}
+
+// actionResults returns the result and the error of the returned values of an action.
+func actionResults(out []reflect.Value) (interface{}, error) {
+	switch len(out) {
+	case 1:
+		return nil, asError(out[0])
+	case 2:
+		var result interface{}
+		if !isNilValue(out[0]) {
+			result = out[0].Interface()
+		}
+		return result, asError(out[1])
+	default:
+		return nil, nil
+	}
+}
+
+func asError(v reflect.Value) error {
+	if v.IsNil() {
+		return nil
+	}
+
+	return v.Interface().(error)
+}
+
+func isNilValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Chan, reflect.Func, reflect.Interface, reflect.Map, reflect.Ptr, reflect.Slice:
+		return v.IsNil()
+	default:
+		return false
+	}
+}
@@ -0,0 +1,146 @@
+package apix
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/weblazy/core/tracex"
+)
+
+type actionTestController struct {
+	Controller
+}
+
+func (c *actionTestController) Deadline(ctx context.Context) (map[string]interface{}, error) {
+	_, ok := ctx.Deadline()
+	span, _ := tracex.SpanFromContext(ctx)
+	return map[string]interface{}{
+		"deadline":  ok,
+		"requestId": tracex.RequestIDFromContext(c.Context()),
+		"traceId":   span.TraceID,
+	}, nil
+}
+
+func (c *actionTestController) Fail() error {
+	return errors.New("failed")
+}
+
+func (c *actionTestController) Empty() (*struct{}, error) {
+	return nil, nil
+}
+
+func (c *actionTestController) Helper(n int) int {
+	return n
+}
+
+func TestActions(t *testing.T) {
+	mux := NewControllerRegister()
+	assert.Nil(t, mux.Add("/deadline", &actionTestController{}, "get:Deadline"))
+	assert.Nil(t, mux.Add("/fail", &actionTestController{}, "get:Fail"))
+	assert.Nil(t, mux.Add("/empty", &actionTestController{}, "get:Empty"))
+	assert.NotNil(t, mux.Add("/helper", &actionTestController{}, "get:Helper"))
+	assert.Nil(t, mux.AddAuto("/auto/", &actionTestController{}))
+	assert.Nil(t, mux.InsertFilter("/deadline", BeforeRouter, TimeoutFilter(time.Second)))
+
+	r := httptest.NewRequest(http.MethodGet, "/deadline", nil)
+	r.Header.Set(tracex.RequestIDHeader, "req-1")
+	r.Header.Set(tracex.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	mux.serveHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "req-1", w.Header().Get(tracex.RequestIDHeader))
+	assert.JSONEq(t, `{"deadline":true,"requestId":"req-1","traceId":"4bf92f3577b34da6a3ce929d0e0e4736"}`,
+		w.Body.String())
+
+	w = httptest.NewRecorder()
+	mux.serveHTTP(w, httptest.NewRequest(http.MethodGet, "/fail", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.NotEmpty(t, w.Header().Get(tracex.RequestIDHeader))
+
+	w = httptest.NewRecorder()
+	mux.serveHTTP(w, httptest.NewRequest(http.MethodGet, "/empty", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	// methods which are not actions are not routed, and they are logged
+	assert.Equal(t, []string{"Helper"}, skippedActions(&actionTestController{}))
+	w = httptest.NewRecorder()
+	mux.serveHTTP(w, httptest.NewRequest(http.MethodGet, "/auto/Helper", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestControllerPoolReset(t *testing.T) {
+	mux := NewControllerRegister()
+	pool := mux.controllerPool(reflect.TypeOf(benchController{}))
+	assert.True(t, pool == mux.controllerPool(reflect.TypeOf(benchController{})))
+
+	method, _ := reflect.TypeOf(&benchController{}).MethodByName("Get")
+	for i := 0; i < 3; i++ {
+		instance := pool.get()
+		controller := instance.controller.(*benchController)
+		assert.Equal(t, 0, controller.count)
+		_, err := instance.call(method, context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, 1, controller.count)
+		pool.put(instance)
+	}
+}
+
+var finishedID string
+
+type finishTestController struct {
+	Controller
+}
+
+func (c *finishTestController) Get() {
+	c.Ctx.OnFinish(func() {
+		// the controller must not be reused until the finishers return
+		finishedID = c.Params["id"]
+	})
+}
+
+func TestControllerReusedAfterFinish(t *testing.T) {
+	mux := NewControllerRegister()
+	assert.Nil(t, mux.Add("/finish/:id", &finishTestController{}))
+
+	mux.serveHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/finish/7", nil))
+	assert.Equal(t, "7", finishedID)
+}
+
+type escapeTestController struct {
+	Controller
+}
+
+func (c *escapeTestController) Get() {
+	ids := escapedIDs
+	go func() {
+		<-escapeRelease
+		// the controller is read after the request is served
+		ids <- c.Params["id"]
+	}()
+}
+
+var (
+	escapedIDs    chan string
+	escapeRelease chan struct{}
+)
+
+func TestControllerNotReused(t *testing.T) {
+	escapedIDs = make(chan string, 2)
+	escapeRelease = make(chan struct{})
+	mux := NewControllerRegister()
+	assert.Nil(t, mux.Add("/escape/:id", &escapeTestController{}))
+	assert.False(t, mux.controllerPool(reflect.TypeOf(escapeTestController{})).reuse)
+	assert.True(t, mux.controllerPool(reflect.TypeOf(benchController{})).reuse)
+
+	mux.serveHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/escape/7", nil))
+	mux.serveHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/escape/8", nil))
+	close(escapeRelease)
+	assert.ElementsMatch(t, []string{"7", "8"}, []string{<-escapedIDs, <-escapedIDs})
+}
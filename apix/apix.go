@@ -2,20 +2,18 @@ package apix
 
 import (
 	"bytes"
-	"compress/gzip"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
-	"os"
 	"reflect"
-	"strconv"
+	"sort"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/weblazy/core/apix/httphandler"
+	"github.com/weblazy/core/apix/session"
 	"github.com/weblazy/core/config"
 	"github.com/weblazy/core/logx"
 )
@@ -41,76 +39,84 @@ var (
 		"LOCK":      true,
 		"UNLOCK":    true,
 	}
-	forbidMethod      map[string]bool            = make(map[string]bool, 0)
-	controllerInfoMap map[string]*ControllerInfo = make(map[string]*ControllerInfo, 0)
-	ApiConfig         config.ApiConfig
+	forbidMethod    map[string]bool = make(map[string]bool, 0)
+	defaultRegister                 = NewControllerRegister()
+	ApiConfig       config.ApiConfig
+	// GlobalSessions is the session manager of controllers, it's set up if ApiConfig.SessionOn is set.
+	GlobalSessions *session.Manager
 )
 
 type (
 	// ControllerRegister containers registered router rules, controller handlers and filters.
 	ControllerRegister struct {
-		// routers      map[string]*Tree
+		routers      map[string]*Tree
 		enablePolicy bool
 		// policies     map[string]*Tree
 		enableFilter bool
-		// filters      [FinishRouter + 1][]*FilterRouter
-		pool sync.Pool
+		filters      [FinishRouter + 1][]*FilterRouter
+		// the keys of the filters inserted by the servers
+		filterKeys map[string]bool
+		pools      map[reflect.Type]*controllerPool
+		docs       map[reflect.Type]map[string]*ActionDoc
+		statics    []*staticDir
 	}
 
 	ControllerInfo struct {
-		key            string
-		keyLenth       int
+		pattern        string
 		controllerType reflect.Type
-		methodMap      map[string]bool
+		methodName     string
+		method         reflect.Method
+		pool           *controllerPool
 	}
 )
 
+func init() {
+	initForbidMethod()
+}
+
 // NewControllerRegister returns a new ControllerRegister.
 func NewControllerRegister() *ControllerRegister {
 	cr := &ControllerRegister{
-		// routers:  make(map[string]*Tree),
+		routers: make(map[string]*Tree),
+		pools:   make(map[reflect.Type]*controllerPool),
 		// policies: make(map[string]*Tree),
 	}
 	return cr
 }
 
+// Router registers controller c on pattern with the default ControllerRegister used by Run.
+// see ControllerRegister.Add for the pattern and mappingMethods notations.
+func Router(pattern string, c ControllerInterface, mappingMethods ...string) {
+	if err := defaultRegister.Add(pattern, c, mappingMethods...); err != nil {
+		logx.Fatal(err)
+	}
+}
+
+// AutoRouter registers every action of c under prefix with the default ControllerRegister,
+// see ControllerRegister.AddAuto.
+func AutoRouter(prefix string, c ControllerInterface) {
+	if err := defaultRegister.AddAuto(prefix, c); err != nil {
+		logx.Fatal(err)
+	}
+}
+
+// Run registers routerMap with AddAuto and starts the server with conf.
 func Run(conf config.ApiConfig, routerMap map[string]ControllerInterface) {
-	mux := NewControllerRegister()
-	initForbidMethod()
+	mux := defaultRegister
 	for key, value := range routerMap {
-		vf := reflect.ValueOf(value)
-		vft := vf.Type()
-		vtp := reflect.Indirect(vf).Type()
-
-		//读取方法数量
-		mNum := vf.NumMethod()
-		//遍历路由器的方法，并将其存入控制器映射变量中
-		methodMap := make(map[string]bool, 0)
-		for i := 0; i < mNum; i++ {
-			mName := vft.Method(i).Name
-			if forbid, ok := forbidMethod[mName]; ok {
-				methodMap[mName] = forbid
-			} else {
-				methodMap[mName] = true
-			}
-		}
-		controllerInfoMap[key] = &ControllerInfo{
-			key:            key,
-			keyLenth:       len(key),
-			controllerType: vtp,
-			methodMap:      methodMap,
+		if err := mux.AddAuto(key, value); err != nil {
+			logx.Fatal(err)
 		}
 	}
 
-	ApiConfig = conf
-	if ApiConfig.MaxMemory == 0 {
-		ApiConfig.MaxMemory = 1 << 26 //64M
+	server, err := NewServer(conf, mux)
+	if err != nil {
+		logx.Fatal(err)
 	}
-	timeoutHandler := httphandler.TimeoutHandler(time.Duration(ApiConfig.Timeout) * time.Millisecond)
-	hander := timeoutHandler(mux)
-	portStr := strconv.FormatInt(ApiConfig.Port, 10)
-	logx.Info("http server Running on http://:" + portStr)
-	http.ListenAndServe(":"+portStr, hander)
+	// the package state read by the applications
+	ApiConfig = server.state.conf
+	GlobalSessions = server.state.sessions
+	server.Start()
 }
 
 func initForbidMethod() {
@@ -125,112 +131,340 @@ func initForbidMethod() {
 	}
 }
 
+// controllerMethods returns the methods of c which can be used as actions.
+func controllerMethods(c ControllerInterface) map[string]bool {
+	vf := reflect.ValueOf(c)
+	vft := vf.Type()
+	//读取方法数量
+	mNum := vf.NumMethod()
+	//遍历路由器的方法，并将其存入控制器映射变量中
+	methodMap := make(map[string]bool, 0)
+	for i := 0; i < mNum; i++ {
+		method := vft.Method(i)
+		mName := method.Name
+		if forbid, ok := forbidMethod[mName]; ok {
+			methodMap[mName] = forbid
+		} else {
+			methodMap[mName] = checkAction(method.Type) == nil
+		}
+	}
+	return methodMap
+}
+
+// Add registers controller c on pattern.
+// pattern supports named params and a trailing wildcard, like /users/:id/orders/*rest,
+// the captured values are available in Controller.Params.
+// mappingMethods binds http methods to controller methods, like "get:List;post:Create",
+// "get,head:Show" or "*:Any", without mappingMethods every http method is bound to
+// the controller method named after it, like Get or Post.
+// Each request is served by a new controller instance, unless the controller embeds Reusable.
+func (p *ControllerRegister) Add(pattern string, c ControllerInterface, mappingMethods ...string) error {
+	methodMap := controllerMethods(c)
+	controllerType := reflect.Indirect(reflect.ValueOf(c)).Type()
+	if _, ok := reflect.New(controllerType).Interface().(ControllerInterface); !ok {
+		return fmt.Errorf("*%s is not a ControllerInterface", controllerType.Name())
+	}
+	mapping := make(map[string]string)
+	if len(mappingMethods) > 0 {
+		for _, pairs := range mappingMethods {
+			for _, pair := range strings.Split(pairs, ";") {
+				pair = strings.TrimSpace(pair)
+				if len(pair) == 0 {
+					continue
+				}
+				colon := strings.IndexByte(pair, ':')
+				if colon < 0 {
+					return fmt.Errorf("wrong method mapping %q on pattern %s", pair, pattern)
+				}
+				methodName := strings.TrimSpace(pair[colon+1:])
+				if method, ok := reflect.PtrTo(controllerType).MethodByName(methodName); ok {
+					if err := checkAction(method.Type); err != nil {
+						return fmt.Errorf("%s.%s: %s", controllerType.Name(), methodName, err)
+					}
+				}
+				if !methodMap[methodName] {
+					return fmt.Errorf("%s has no action named %s", controllerType.Name(), methodName)
+				}
+				for _, verb := range strings.Split(pair[:colon], ",") {
+					verb = strings.ToUpper(strings.TrimSpace(verb))
+					if verb == "*" {
+						for m := range HTTPMETHOD {
+							mapping[m] = methodName
+						}
+					} else if HTTPMETHOD[verb] {
+						mapping[verb] = methodName
+					} else {
+						return fmt.Errorf("%s is not a valid http method on pattern %s", verb, pattern)
+					}
+				}
+			}
+		}
+	} else {
+		for m := range HTTPMETHOD {
+			methodName := strings.Title(strings.ToLower(m))
+			if methodMap[methodName] {
+				mapping[m] = methodName
+			}
+		}
+	}
+
+	if len(mapping) == 0 {
+		return fmt.Errorf("%s has no action to register on pattern %s", controllerType.Name(), pattern)
+	}
+
+	pool := p.controllerPool(controllerType)
+	for verb, methodName := range mapping {
+		method, _ := reflect.PtrTo(controllerType).MethodByName(methodName)
+		if err := p.addToRouter(verb, pattern, &ControllerInfo{
+			pattern:        pattern,
+			controllerType: controllerType,
+			methodName:     methodName,
+			method:         method,
+			pool:           pool,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AddAuto registers every action of c under prefix, the action name follows prefix directly,
+// e.g. prefix /user/ and action Login serves /user/Login for all http methods.
+// The methods of c not like actions are not registered, and they are logged.
+func (p *ControllerRegister) AddAuto(prefix string, c ControllerInterface) error {
+	for methodName, runable := range controllerMethods(c) {
+		if !runable {
+			continue
+		}
+		if err := p.Add(prefix+methodName, c, "*:"+methodName); err != nil {
+			return err
+		}
+	}
+
+	controllerName := reflect.Indirect(reflect.ValueOf(c)).Type().Name()
+	for _, methodName := range skippedActions(c) {
+		logx.Errorf("%s.%s is not registered on %s: %s", controllerName, methodName, prefix, errActionSignature)
+	}
+
+	return nil
+}
+
+// skippedActions returns the sorted methods of c which are not actions,
+// except the methods of Controller.
+func skippedActions(c ControllerInterface) []string {
+	var skipped []string
+	for methodName, runable := range controllerMethods(c) {
+		if _, ok := forbidMethod[methodName]; !ok && !runable {
+			skipped = append(skipped, methodName)
+		}
+	}
+	sort.Strings(skipped)
+
+	return skipped
+}
+
+func (p *ControllerRegister) addToRouter(method, pattern string, info *ControllerInfo) error {
+	t, ok := p.routers[method]
+	if !ok {
+		t = NewTree()
+		p.routers[method] = t
+	}
+
+	return t.AddRouter(pattern, info)
+}
+
+// FindRouter returns the ControllerInfo matched by method and path, with the captured params.
+// HEAD requests fall back to the GET routes.
+func (p *ControllerRegister) FindRouter(method, path string) (*ControllerInfo, map[string]string) {
+	if t, ok := p.routers[method]; ok {
+		if runObject, params := t.Match(path); runObject != nil {
+			return runObject.(*ControllerInfo), params
+		}
+	}
+
+	if method == http.MethodHead {
+		return p.FindRouter(http.MethodGet, path)
+	}
+
+	return nil, nil
+}
+
+// allowedMethods returns the http methods that have a route on path.
+func (p *ControllerRegister) allowedMethods(path string) []string {
+	var methods []string
+	for method := range HTTPMETHOD {
+		if runObject, _ := p.FindRouter(method, path); runObject != nil {
+			methods = append(methods, method)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
 func (p *ControllerRegister) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	startTime := time.Now()
-	var (
-		urlPath        = r.URL.Path
-		controllerInfo *ControllerInfo
-		execController ControllerInterface
-	)
+	ctx := p.serveHTTP(w, r)
+	writeAccessLog(ctx, startTime)
+}
+
+func (p *ControllerRegister) serveHTTP(w http.ResponseWriter, r *http.Request) *Context {
+	ctx := newContext(w, r)
+	defer ctx.finish()
+
+	p.serveRecovered(ctx)
+	if p.enableFilter {
+		p.execFilter(ctx, FinishRouter, r.URL.Path)
+	}
+
+	return ctx
+}
+
+// serveRecovered serves ctx, the panics are recovered and responded as 500.
+func (p *ControllerRegister) serveRecovered(ctx *Context) {
+	defer recoverPanic(ctx)
+	p.serveContext(ctx)
+}
+
+func (p *ControllerRegister) serveContext(ctx *Context) {
+	urlPath := ctx.R.URL.Path
 	// filter wrong http method
-	if !HTTPMETHOD[r.Method] {
-		http.Error(w, "Method Not Allowed", 405)
-		goto Admin
+	if !HTTPMETHOD[ctx.R.Method] {
+		writeError(ctx.W, ctx.R, NewHTTPError(http.StatusMethodNotAllowed, ""))
+		return
+	}
+
+	if p.enableFilter && p.execFilter(ctx, BeforeRouter, urlPath) {
+		return
+	}
+
+	if p.serveStatic(ctx) {
+		return
 	}
 
-	if urlPath == "/favicon.ico" || urlPath == "/robots.txt" {
-		file := ApiConfig.ImagePath + "/favicon.ico"
-		f, err := os.Open(file)
-		defer f.Close()
-		if err != nil && os.IsNotExist(err) {
-			file = ApiConfig.ImagePath + "/default.png"
+	controllerInfo, params := p.FindRouter(ctx.R.Method, urlPath)
+	if controllerInfo == nil {
+		if methods := p.allowedMethods(urlPath); len(methods) > 0 {
+			ctx.W.Header().Set("Allow", strings.Join(methods, ", "))
+			writeError(ctx.W, ctx.R, NewHTTPError(http.StatusMethodNotAllowed, ""))
+		} else {
+			writeError(ctx.W, ctx.R, NewHTTPError(http.StatusNotFound, ""))
 		}
-		http.ServeFile(w, r, file)
 		return
 	}
+	ctx.Params = params
+	ctx.route = controllerInfo.pattern
+
+	if p.enableFilter && p.execFilter(ctx, BeforeExec, urlPath) {
+		return
+	}
+
+	// the instance is put back by ctx.finish, after the finishers registered by the controller
+	ctx.controller = controllerInfo.pool.get()
+	ctx.controllerPool = controllerInfo.pool
+	if deadline, ok := ctx.R.Context().Deadline(); ok {
+		timeoutHandler := httphandler.TimeoutHandler(time.Until(deadline))
+		timeoutHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p.execController(ctx, controllerInfo, &timeoutWriter{ResponseWriter: w}, r)
+			ctx.markServed()
+		})).ServeHTTP(ctx.W, ctx.R)
+	} else {
+		p.execController(ctx, controllerInfo, ctx.W, ctx.R)
+		ctx.markServed()
+	}
+
+	if p.enableFilter {
+		p.execFilter(ctx, AfterExec, urlPath)
+	}
+}
 
-	for key, value := range controllerInfoMap {
-		if strings.HasPrefix(urlPath, key) {
-			if controllerInfo == nil || (value.keyLenth > controllerInfo.keyLenth) {
-				controllerInfo = value
+func (p *ControllerRegister) execController(ctx *Context, controllerInfo *ControllerInfo,
+	w http.ResponseWriter, r *http.Request) {
+	instance := ctx.controller
+	execController := instance.controller
+	conf := &stateOf(r).conf
+	baseController := BaseController{
+		controllerName: controllerInfo.controllerType.Name(),
+		actionName:     controllerInfo.methodName,
+		AppController:  execController,
+		W:              w,
+		R:              r,
+		Ctx:            ctx,
+		params:         ctx.Params,
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		if !strings.Contains(r.Header.Get("Content-Type"), "multipart/form-data") {
+			body, err := copyBody(w, r, conf.MaxMemory)
+			if err != nil {
+				writeError(w, r, err)
+				return
 			}
+			baseController.RequestBody = body
 		}
+		parseFormOrMulitForm(r, conf.MaxMemory)
 	}
 
-	if controllerInfo != nil {
-		methodName := urlPath[controllerInfo.keyLenth:]
-		vc := reflect.New(controllerInfoMap[controllerInfo.key].controllerType)
-		var ok bool
-		execController, ok = vc.Interface().(ControllerInterface)
-		if !ok {
-			logx.Fatal("controller is not ControllerInterface")
+	execController.Init(baseController)
+	execController.Prepare()
+	if conf.EnableXSRF {
+		execController.XSRFToken()
+		if isUnsafeMethod(r.Method) && !execController.CheckXSRFCookie() {
+			execController.Finish()
+			return
 		}
-		baseController := BaseController{
-			controllerName: controllerInfo.controllerType.Name(),
-			actionName:     methodName,
-			AppController:  execController,
-			W:              w,
-			R:              r,
-		}
-		if r.Method != http.MethodGet && r.Method != http.MethodHead {
-			if !strings.Contains(r.Header.Get("Content-Type"), "multipart/form-data") {
-				baseController.RequestBody = copyBody(w, r, ApiConfig.MaxMemory)
+	}
+
+	result, err := instance.call(controllerInfo.method, r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		execController.Finish()
+		return
+	}
+	if result != nil {
+		if server, ok := execController.(resultServer); ok {
+			if err := server.serveResult(result); err != nil {
+				writeError(w, r, err)
 			}
-			parseFormOrMulitForm(r, ApiConfig.MaxMemory)
 		}
+	}
+	if err := execController.Render(); err != nil {
+		writeError(w, r, err)
+	}
+	execController.Finish()
+}
 
-		execController.Init(baseController)
-		if runable, ok := controllerInfo.methodMap[methodName]; runable && ok {
-			method := vc.MethodByName(methodName)
-			method.Call(nil)
-		} else {
-			http.NotFound(w, r)
-		}
-		goto Admin
-	}
-	http.NotFound(w, r)
-Admin:
-	//admin module record QPS
-	record := map[string]interface{}{
-		// "RemoteAddr":     context.Input.IP(),
-		"RequestTime":    startTime,
-		"DuringTime":     time.Since(startTime),
-		"RequestMethod":  r.Method,
-		"Request":        fmt.Sprintf("%s %s %s", r.Method, r.RequestURI, r.Proto),
-		"ServerProtocol": r.Proto,
-		"Host":           r.Host,
-		// "Status":         statusCode,
-		"HTTPReferrer":  r.Header.Get("Referer"),
-		"HTTPUserAgent": r.Header.Get("User-Agent"),
-		"RemoteUser":    r.Header.Get("Remote-User"),
-		"BodyBytesSent": 0, //@todo this one is missing!
-	}
-	logx.Info(record)
-	return
-}
-
-// CopyBody returns the raw request body data as bytes.
-func copyBody(w http.ResponseWriter, r *http.Request, MaxMemory int64) []byte {
+// copyBody returns the raw request body data as bytes, decoded by the Content-Encoding,
+// and resets r.Body to read them again. The error is an HTTPError of 415 for the unsupported encodings,
+// or 400 for the bodies failing to decode.
+func copyBody(w http.ResponseWriter, r *http.Request, MaxMemory int64) ([]byte, error) {
 	if r.Body == nil {
-		return []byte{}
+		return []byte{}, nil
 	}
 
 	var requestBody []byte
+	var err error
 	safe := &io.LimitedReader{R: r.Body, N: MaxMemory}
-	if r.Header.Get("Content-Encoding") == "gzip" {
-		reader, err := gzip.NewReader(safe)
-		if err != nil {
-			return nil
+	if encoding := r.Header.Get("Content-Encoding"); len(encoding) > 0 && encoding != "identity" {
+		reader, err := decodeBody(encoding, safe)
+		if err == errUnsupportedEncoding {
+			return nil, NewHTTPError(http.StatusUnsupportedMediaType, "unsupported content encoding "+encoding)
+		} else if err != nil {
+			return nil, NewHTTPError(http.StatusBadRequest, "invalid "+encoding+" body")
 		}
-		requestBody, _ = ioutil.ReadAll(reader)
-	} else {
-		requestBody, _ = ioutil.ReadAll(safe)
+		// limit the decoded size as well to avoid decompression bombs
+		if requestBody, err = ioutil.ReadAll(io.LimitReader(reader, MaxMemory)); err != nil {
+			return nil, NewHTTPError(http.StatusBadRequest, "invalid "+encoding+" body")
+		}
+		// the body is decoded, so that the form parsing reads it as it is
+		r.Header.Del("Content-Encoding")
+	} else if requestBody, err = ioutil.ReadAll(safe); err != nil {
+		return nil, err
 	}
 
 	r.Body.Close()
 	bf := bytes.NewBuffer(requestBody)
 	r.Body = http.MaxBytesReader(w, ioutil.NopCloser(bf), MaxMemory)
-	return requestBody
+	return requestBody, nil
 }
 
 // ParseFormOrMulitForm parseForm or parseMultiForm based on Content-type
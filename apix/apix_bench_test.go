@@ -0,0 +1,138 @@
+package apix
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+type (
+	benchController struct {
+		Controller
+		Reusable
+		count int
+	}
+
+	newBenchController struct {
+		Controller
+	}
+)
+
+func (c *benchController) Get() {
+	c.count++
+}
+
+func (c *benchController) Show(ctx context.Context) error {
+	c.count++
+	return nil
+}
+
+func (c *benchController) Find() (*benchResult, error) {
+	return &benchResult{Name: c.Params["id"]}, nil
+}
+
+func (c *newBenchController) Show(ctx context.Context) error {
+	return nil
+}
+
+type benchResult struct {
+	Name string `json:"name"`
+}
+
+func benchmarkServe(b *testing.B, mux *ControllerRegister, r *http.Request) {
+	w := httptest.NewRecorder()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.Body.Reset()
+		mux.serveHTTP(w, r)
+	}
+}
+
+func BenchmarkServeStatic(b *testing.B) {
+	mux := NewControllerRegister()
+	if err := mux.Add("/bench", &benchController{}); err != nil {
+		b.Fatal(err)
+	}
+	benchmarkServe(b, mux, httptest.NewRequest(http.MethodGet, "/bench", nil))
+}
+
+func BenchmarkServeParam(b *testing.B) {
+	mux := NewControllerRegister()
+	if err := mux.Add("/bench/:id", &benchController{}, "get:Show"); err != nil {
+		b.Fatal(err)
+	}
+	benchmarkServe(b, mux, httptest.NewRequest(http.MethodGet, "/bench/7", nil))
+}
+
+func BenchmarkServeResult(b *testing.B) {
+	mux := NewControllerRegister()
+	if err := mux.Add("/bench/:id", &benchController{}, "get:Find"); err != nil {
+		b.Fatal(err)
+	}
+	benchmarkServe(b, mux, httptest.NewRequest(http.MethodGet, "/bench/7", nil))
+}
+
+func BenchmarkServeParallel(b *testing.B) {
+	mux := NewControllerRegister()
+	if err := mux.Add("/bench/:id", &benchController{}, "get:Show"); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		r := httptest.NewRequest(http.MethodGet, "/bench/7", nil)
+		w := httptest.NewRecorder()
+		for pb.Next() {
+			w.Body.Reset()
+			mux.serveHTTP(w, r)
+		}
+	})
+}
+
+func BenchmarkInvokeReflect(b *testing.B) {
+	controllerType := reflect.TypeOf(benchController{})
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		vc := reflect.New(controllerType)
+		if _, err := callAction(vc.MethodByName("Show"), ctx); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkInvokePooled(b *testing.B) {
+	mux := NewControllerRegister()
+	pool := mux.controllerPool(reflect.TypeOf(benchController{}))
+	method, _ := reflect.TypeOf(&benchController{}).MethodByName("Show")
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		instance := pool.get()
+		if _, err := instance.call(method, ctx); err != nil {
+			b.Fatal(err)
+		}
+		pool.put(instance)
+	}
+}
+
+func BenchmarkInvokeNew(b *testing.B) {
+	mux := NewControllerRegister()
+	pool := mux.controllerPool(reflect.TypeOf(newBenchController{}))
+	method, _ := reflect.TypeOf(&newBenchController{}).MethodByName("Show")
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		instance := pool.get()
+		if _, err := instance.call(method, ctx); err != nil {
+			b.Fatal(err)
+		}
+		pool.put(instance)
+	}
+}
@@ -0,0 +1,140 @@
+package apix
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"reflect"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/golang/protobuf/proto"
+)
+
+const (
+	mimeJSON          = "application/json"
+	mimeXML           = "application/xml"
+	mimeXML2          = "text/xml"
+	mimeProtobuf      = "application/x-protobuf"
+	mimeMultipartForm = "multipart/form-data"
+	mimeForm          = "application/x-www-form-urlencoded"
+)
+
+var (
+	ErrNotProtoMessage = errors.New("obj must be a proto.Message to bind protobuf")
+
+	errUnsupportedEncoding = errors.New("unsupported content encoding")
+
+	fileHeaderType      = reflect.TypeOf((*multipart.FileHeader)(nil))
+	fileHeaderSliceType = reflect.TypeOf([]*multipart.FileHeader(nil))
+)
+
+// Bind decodes the request into obj by the Content-Type header:
+// application/json and application/xml (or text/xml) are decoded from RequestBody,
+// application/x-protobuf is decoded from RequestBody into obj which must be a proto.Message,
+// others like multipart/form-data and application/x-www-form-urlencoded are bound with ParseForm,
+// and the uploaded files are set to the *multipart.FileHeader and []*multipart.FileHeader fields by form tags.
+func (c *Controller) Bind(obj interface{}) error {
+	switch c.contentType() {
+	case mimeJSON:
+		return c.ParseJSON(obj)
+	case mimeXML, mimeXML2:
+		return xml.Unmarshal(c.RequestBody, obj)
+	case mimeProtobuf:
+		msg, ok := obj.(proto.Message)
+		if !ok {
+			return ErrNotProtoMessage
+		}
+		return proto.Unmarshal(c.RequestBody, msg)
+	default:
+		if err := c.ParseForm(obj); err != nil {
+			return err
+		}
+		if c.R.MultipartForm == nil || len(c.R.MultipartForm.File) == 0 {
+			return nil
+		}
+		objT := reflect.TypeOf(obj)
+		if !isStructPtr(objT) {
+			return fmt.Errorf("%v must be  a struct pointer", obj)
+		}
+		bindFiles(c.R.MultipartForm.File, objT.Elem(), reflect.ValueOf(obj).Elem())
+		return nil
+	}
+}
+
+func (c *Controller) contentType() string {
+	mediaType, _, err := mime.ParseMediaType(c.R.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+
+	return mediaType
+}
+
+// bindFiles sets the uploaded files to the fields by form tags, the same way as parseFormToStruct.
+func bindFiles(files map[string][]*multipart.FileHeader, objT reflect.Type, objV reflect.Value) {
+	for i := 0; i < objT.NumField(); i++ {
+		fieldV := objV.Field(i)
+		if !fieldV.CanSet() {
+			continue
+		}
+
+		fieldT := objT.Field(i)
+		if fieldT.Anonymous && fieldT.Type.Kind() == reflect.Struct {
+			bindFiles(files, fieldT.Type, fieldV)
+			continue
+		}
+
+		tags := strings.Split(fieldT.Tag.Get(formTag), ",")
+		var tag string
+		if len(tags) == 0 || len(tags[0]) == 0 {
+			tag = fieldT.Name
+		} else if tags[0] == "-" {
+			continue
+		} else {
+			tag = tags[0]
+		}
+
+		headers := files[tag]
+		if len(headers) == 0 {
+			continue
+		}
+
+		switch fieldT.Type {
+		case fileHeaderType:
+			fieldV.Set(reflect.ValueOf(headers[0]))
+		case fileHeaderSliceType:
+			fieldV.Set(reflect.ValueOf(headers))
+		}
+	}
+}
+
+// decodeBody returns the reader which decodes body by the Content-Encoding,
+// deflate accepts both zlib format as RFC 7230 requires and raw deflate format some clients send.
+func decodeBody(encoding string, body io.Reader) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "gzip", "x-gzip":
+		return gzip.NewReader(body)
+	case "deflate":
+		content, err := ioutil.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		if reader, err := zlib.NewReader(bytes.NewReader(content)); err == nil {
+			return reader, nil
+		}
+		return flate.NewReader(bytes.NewReader(content)), nil
+	case "br":
+		return brotli.NewReader(body), nil
+	default:
+		return nil, errUnsupportedEncoding
+	}
+}
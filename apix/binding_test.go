@@ -0,0 +1,287 @@
+package apix
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/stretchr/testify/assert"
+)
+
+type (
+	bindingTestForm struct {
+		Name string `json:"name" xml:"name" form:"name"`
+		Age  int    `json:"age" xml:"age" form:"age,optional"`
+	}
+
+	bindingTestUpload struct {
+		Name   string                  `form:"name"`
+		Avatar *multipart.FileHeader   `form:"avatar"`
+		Photos []*multipart.FileHeader `form:"photos"`
+		Ignore *multipart.FileHeader   `form:"-"`
+	}
+
+	bindingTestValidated struct {
+		Name string `json:"name" form:"name"`
+		Role string `json:"role,options=admin|user" form:"role,options=admin|user"`
+		Age  int    `json:"age,optional,range=[0:150]" form:"age,optional,range=[0:150]"`
+	}
+
+	bindingTestController struct {
+		Controller
+	}
+)
+
+func (c *bindingTestController) Post() (*bindingTestForm, error) {
+	var form bindingTestForm
+	if err := c.Bind(&form); err != nil {
+		return nil, NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return &form, nil
+}
+
+func (c *bindingTestController) Upload() (map[string]interface{}, error) {
+	var form bindingTestUpload
+	if err := c.Bind(&form); err != nil {
+		return nil, err
+	}
+
+	var photos []string
+	for _, photo := range form.Photos {
+		photos = append(photos, photo.Filename)
+	}
+	return map[string]interface{}{
+		"name":   form.Name,
+		"avatar": form.Avatar.Filename,
+		"photos": photos,
+		"ignore": form.Ignore == nil,
+	}, nil
+}
+
+func (c *bindingTestController) Validate() (*bindingTestValidated, error) {
+	var form bindingTestValidated
+	if err := c.Bind(&form); err != nil {
+		return nil, err
+	}
+
+	return &form, nil
+}
+
+func TestBindValidation(t *testing.T) {
+	prev := ApiConfig
+	defer func() {
+		ApiConfig = prev
+	}()
+	ApiConfig.MaxMemory = 1 << 20
+
+	mux := NewControllerRegister()
+	assert.Nil(t, mux.Add("/validate", &bindingTestController{}, "post:Validate"))
+	post := func(contentType, body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		r := httptest.NewRequest(http.MethodPost, "/validate", strings.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		mux.serveHTTP(w, r)
+
+		var result map[string]interface{}
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &result))
+		return w, result
+	}
+
+	tests := []struct {
+		contentType string
+		body        string
+		details     []interface{}
+	}{
+		{"application/x-www-form-urlencoded", "name=kevin&role=root", []interface{}{
+			map[string]interface{}{"field": "role", "message": `value "root" is not one of admin|user`},
+		}},
+		{"application/x-www-form-urlencoded", "name=kevin&age=18", []interface{}{
+			map[string]interface{}{"field": "role", "message": "is required"},
+		}},
+		{"application/json", `{"name":"kevin","role":"user","age":200}`, []interface{}{
+			map[string]interface{}{"field": "age", "message": "value 200 is out of range [0:150]"},
+		}},
+		{"application/json", `{"name":"kevin","age":"x"}`, []interface{}{
+			map[string]interface{}{"field": "role", "message": "is required"},
+			map[string]interface{}{"field": "age", "message": `expect a number, got "x"`},
+		}},
+	}
+	for _, test := range tests {
+		w, body := post(test.contentType, test.body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, test.body)
+		assert.Equal(t, float64(http.StatusBadRequest), body["code"], test.body)
+		assert.ElementsMatch(t, test.details, body["details"], test.body)
+	}
+
+	w, body := post("application/json", `{"Name":"kevin","role":"admin","age":18}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, map[string]interface{}{"name": "kevin", "role": "admin", "age": float64(18)}, body)
+	w, body = post("application/x-www-form-urlencoded", "name=kevin&role=user")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, map[string]interface{}{"name": "kevin", "role": "user", "age": float64(0)}, body)
+}
+
+func TestBind(t *testing.T) {
+	prev := ApiConfig
+	defer func() {
+		ApiConfig = prev
+	}()
+	ApiConfig.MaxMemory = 1 << 20
+
+	mux := NewControllerRegister()
+	assert.Nil(t, mux.Add("/users", &bindingTestController{}, "post:Post"))
+	post := func(contentType string, body io.Reader) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/users", body)
+		r.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		mux.serveHTTP(w, r)
+		return w
+	}
+
+	w := post("application/json; charset=utf-8", strings.NewReader(`{"name":"kevin","age":18}`))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"name":"kevin","age":18}`, w.Body.String())
+
+	w = post("text/xml", strings.NewReader(`<user><name>kevin</name><age>18</age></user>`))
+	assert.Equal(t, `{"name":"kevin","age":18}`, w.Body.String())
+
+	w = post("application/x-www-form-urlencoded", strings.NewReader("name=kevin&age=18"))
+	assert.Equal(t, `{"name":"kevin","age":18}`, w.Body.String())
+
+	w = post("application/json", strings.NewReader(`{"name":`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// protobuf needs a proto.Message
+	w = post("application/x-protobuf", strings.NewReader(""))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), ErrNotProtoMessage.Error())
+	content, err := proto.Marshal(&wrappers.StringValue{Value: "kevin"})
+	assert.Nil(t, err)
+	r := httptest.NewRequest(http.MethodPost, "/users", bytes.NewReader(content))
+	r.Header.Set("Content-Type", "application/x-protobuf")
+	c := &Controller{BaseController: BaseController{R: r, RequestBody: content}}
+	var msg wrappers.StringValue
+	assert.Nil(t, c.Bind(&msg))
+	assert.Equal(t, "kevin", msg.Value)
+}
+
+func TestBindMultipartFiles(t *testing.T) {
+	prev := ApiConfig
+	defer func() {
+		ApiConfig = prev
+	}()
+	ApiConfig.MaxMemory = 1 << 20
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	assert.Nil(t, writer.WriteField("name", "kevin"))
+	for field, names := range map[string][]string{
+		"avatar": {"me.png"},
+		"photos": {"a.jpg", "b.jpg"},
+		"Ignore": {"x.txt"},
+	} {
+		for _, name := range names {
+			part, err := writer.CreateFormFile(field, name)
+			assert.Nil(t, err)
+			part.Write([]byte(name))
+		}
+	}
+	assert.Nil(t, writer.Close())
+
+	mux := NewControllerRegister()
+	assert.Nil(t, mux.Add("/upload", &bindingTestController{}, "post:Upload"))
+	r := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	mux.serveHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var result map[string]interface{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, map[string]interface{}{
+		"name":   "kevin",
+		"avatar": "me.png",
+		"photos": []interface{}{"a.jpg", "b.jpg"},
+		"ignore": true,
+	}, result)
+}
+
+func TestDecodeBody(t *testing.T) {
+	prev := ApiConfig
+	defer func() {
+		ApiConfig = prev
+	}()
+	ApiConfig.MaxMemory = 1 << 20
+
+	const content = `{"name":"kevin","age":18}`
+	encoders := map[string]func(io.Writer) io.WriteCloser{
+		"gzip": func(w io.Writer) io.WriteCloser {
+			return gzip.NewWriter(w)
+		},
+		"deflate": func(w io.Writer) io.WriteCloser {
+			return zlib.NewWriter(w)
+		},
+		"br": func(w io.Writer) io.WriteCloser {
+			return brotli.NewWriter(w)
+		},
+	}
+
+	mux := NewControllerRegister()
+	assert.Nil(t, mux.Add("/users", &bindingTestController{}, "post:Post"))
+	post := func(encoding string, body []byte) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/users", bytes.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("Content-Encoding", encoding)
+		w := httptest.NewRecorder()
+		mux.serveHTTP(w, r)
+		return w
+	}
+
+	for encoding, encoder := range encoders {
+		var buf bytes.Buffer
+		writer := encoder(&buf)
+		writer.Write([]byte(content))
+		assert.Nil(t, writer.Close())
+		w := post(encoding, buf.Bytes())
+		assert.Equal(t, http.StatusOK, w.Code, encoding)
+		assert.Equal(t, content, w.Body.String(), encoding)
+	}
+
+	// raw deflate without the zlib header
+	var buf bytes.Buffer
+	writer, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	assert.Nil(t, err)
+	writer.Write([]byte(content))
+	assert.Nil(t, writer.Close())
+	w := post("deflate", buf.Bytes())
+	assert.Equal(t, content, w.Body.String())
+
+	w = post("compress", []byte(content))
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	w = post("gzip", []byte(content))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// the body reader is reset with the decoded content
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(buf.Bytes()))
+	r.Header.Set("Content-Encoding", "deflate")
+	body, err := copyBody(httptest.NewRecorder(), r, ApiConfig.MaxMemory)
+	assert.Nil(t, err)
+	assert.Equal(t, content, string(body))
+	assert.Empty(t, r.Header.Get("Content-Encoding"))
+	again, err := ioutil.ReadAll(r.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, content, string(again))
+}
@@ -0,0 +1,227 @@
+package apix
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/weblazy/core/apix/websocket"
+	"github.com/weblazy/core/tracex"
+)
+
+type (
+	// Context holds the request and response of one http exchange while it passes
+	// the filters and the controller.
+	Context struct {
+		W      *Response
+		R      *http.Request
+		Params map[string]string
+
+		route     string
+		data      map[interface{}]interface{}
+		stopped   bool
+		finishers []func()
+		// the controller serving the request, put back to its pool on finish if served
+		controller     *controllerInstance
+		controllerPool *controllerPool
+		served         int32
+		// streaming is set by StreamingFilter, untimed is the request context before TimeoutFilter
+		streaming bool
+		untimed   context.Context
+	}
+
+	// Response wraps http.ResponseWriter to know whether the response has been written,
+	// and records the status code and the bytes sent for the access log.
+	Response struct {
+		http.ResponseWriter
+		Started bool
+		Status  int
+		Size    int64
+	}
+
+	// startedWriter is implemented by the response writers knowing whether the response is started.
+	startedWriter interface {
+		started() bool
+	}
+
+	// timeoutWriter wraps the writer of httphandler.TimeoutHandler to know whether the action started the response.
+	timeoutWriter struct {
+		http.ResponseWriter
+		wroteHeader bool
+	}
+)
+
+// newContext returns the Context of the request, the request context carries the request id
+// from the X-Request-Id header or a new one, and the span following the traceparent header.
+func newContext(w http.ResponseWriter, r *http.Request) *Context {
+	requestID := r.Header.Get(tracex.RequestIDHeader)
+	if !tracex.ValidRequestID(requestID) {
+		requestID = tracex.NewRequestID()
+	}
+	w.Header().Set(tracex.RequestIDHeader, requestID)
+
+	c := tracex.ContextWithRequestID(r.Context(), requestID)
+	c = tracex.ContextWithSpan(c, tracex.StartSpan(r.Header.Get(tracex.TraceparentHeader)))
+
+	return &Context{
+		W: &Response{ResponseWriter: w},
+		R: r.WithContext(c),
+	}
+}
+
+// RequestID returns the id of the request.
+func (ctx *Context) RequestID() string {
+	return tracex.RequestIDFromContext(ctx.R.Context())
+}
+
+// Route returns the pattern of the matched route, like /user/:id,
+// it's empty before the route is found, e.g. in the BeforeRouter filters.
+func (ctx *Context) Route() string {
+	return ctx.route
+}
+
+// IsWebSocket tells whether the request asks to upgrade to websocket,
+// the filters may check it to authenticate the handshake differently, e.g. by a query token.
+func (ctx *Context) IsWebSocket() bool {
+	return websocket.IsWebSocketUpgrade(ctx.R)
+}
+
+// IsEventStream tells whether the request accepts the server-sent events, like the ones of EventSource.
+func (ctx *Context) IsEventStream() bool {
+	for _, part := range strings.Split(ctx.R.Header.Get("Accept"), ",") {
+		if strings.TrimSpace(strings.SplitN(part, ";", 2)[0]) == textEventStream {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Abort writes the status code and body, and stops the remaining filters and the controller.
+func (ctx *Context) Abort(code int, body string) {
+	http.Error(ctx.W, body, code)
+	ctx.Stop()
+}
+
+// Stop stops the remaining filters and the controller, FinishRouter filters are still executed.
+func (ctx *Context) Stop() {
+	ctx.stopped = true
+}
+
+// Stopped tells whether the request has been stopped.
+func (ctx *Context) Stopped() bool {
+	return ctx.stopped
+}
+
+// GetData returns the value stored by SetData, filters use it to pass values to controllers.
+func (ctx *Context) GetData(key interface{}) interface{} {
+	if ctx.data == nil {
+		return nil
+	}
+
+	return ctx.data[key]
+}
+
+// SetData stores a value in the context.
+func (ctx *Context) SetData(key, value interface{}) {
+	if ctx.data == nil {
+		ctx.data = make(map[interface{}]interface{})
+	}
+	ctx.data[key] = value
+}
+
+// OnFinish registers fn to be called after the request is served, after the FinishRouter filters.
+func (ctx *Context) OnFinish(fn func()) {
+	ctx.finishers = append(ctx.finishers, fn)
+}
+
+func (ctx *Context) finish() {
+	for i := len(ctx.finishers) - 1; i >= 0; i-- {
+		ctx.finishers[i]()
+	}
+
+	// the controller is dropped if the action panicked or is still running after the timeout
+	if ctx.controller != nil && atomic.LoadInt32(&ctx.served) == 1 {
+		ctx.controllerPool.put(ctx.controller)
+		ctx.controller = nil
+	}
+}
+
+// markServed marks the controller reusable after the action returns.
+func (ctx *Context) markServed() {
+	atomic.StoreInt32(&ctx.served, 1)
+}
+
+// WriteHeader sends the status code.
+func (r *Response) WriteHeader(code int) {
+	if r.Status == 0 {
+		r.Status = code
+	}
+	r.Started = true
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Write writes the data to the connection.
+func (r *Response) Write(b []byte) (int, error) {
+	if r.Status == 0 {
+		r.Status = http.StatusOK
+	}
+	r.Started = true
+	n, err := r.ResponseWriter.Write(b)
+	r.Size += int64(n)
+	return n, err
+}
+
+func (r *Response) started() bool {
+	return r.Started
+}
+
+// Hijack lets the caller take over the connection, e.g. to upgrade to websocket.
+func (r *Response) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("the ResponseWriter doesn't support the Hijacker interface")
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r.Started = true
+	if r.Status == 0 {
+		r.Status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, nil
+}
+
+// Flush sends the buffered data to the client, e.g. for the server-sent events.
+func (r *Response) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		if r.Status == 0 {
+			r.Status = http.StatusOK
+		}
+		r.Started = true
+		flusher.Flush()
+	}
+}
+
+// WriteHeader sends the status code.
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write writes the data to the buffer of the timeout handler.
+func (w *timeoutWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *timeoutWriter) started() bool {
+	return w.wroteHeader
+}
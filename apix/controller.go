@@ -1,6 +1,8 @@
 package apix
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"mime/multipart"
 	"net/http"
@@ -9,6 +11,10 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/weblazy/core/apix/session"
+	"github.com/weblazy/core/logx"
+	"github.com/weblazy/core/mapping"
 )
 
 type (
@@ -32,26 +38,35 @@ type (
 		methodMapping map[string]func() //method:routertree
 
 		EnableRender bool
+		// template rendering, the files are relative to ApiConfig.ViewPath
+		TplName        string
+		Layout         string
+		LayoutSections map[string]string
 		// xsrf data
 		_xsrfToken string
 		XSRFExpire int
 		EnableXSRF bool
 
 		// session
-		// CruSession session.Store
+		CruSession session.Store
 	}
 
 	BaseController struct {
 		W              http.ResponseWriter
 		R              *http.Request
+		Ctx            *Context
 		controllerName string
 		actionName     string
 		AppController  interface{}
 		RequestBody    []byte
+		params         map[string]string
 	}
 )
 
 const (
+	formTag = "form"
+	jsonTag = "json"
+
 	formatTime      = "15:04:05"
 	formatDate      = "2006-01-02"
 	formatDateTime  = "2006-01-02 15:04:05"
@@ -66,17 +81,60 @@ var (
 // Init generates default values of controller operations.
 func (c *Controller) Init(baseController BaseController) {
 	c.BaseController = baseController
+	c.Params = baseController.params
+	c.Data = make(map[interface{}]interface{})
 	c.EnableRender = true
 	c.EnableXSRF = true
+	c.XSRFExpire = stateOf(c.R).conf.XSRFExpire
 	c.methodMapping = make(map[string]func())
 	if c.R != nil && c.R.Form == nil {
 		c.R.ParseForm()
 	}
 }
 
+// Context returns the context of the request, it's done when the client goes away or the request times out,
+// and carries the request id and the tracing span, see the tracex package.
+// Actions like func(ctx context.Context) are called with it.
+func (b *BaseController) Context() context.Context {
+	return b.R.Context()
+}
+
+// Prepare runs after Init before the action, controllers override it to do the common work of actions,
+// like checking the permissions or disabling EnableXSRF.
+func (c *Controller) Prepare() {
+}
+
+// Finish runs after the action and the rendering.
+func (c *Controller) Finish() {
+}
+
 // ParseForm maps input data map to obj struct.
+// The form tag options default, optional, options and range are validated like the mapping package does,
+// a mapping.ValidationErrors listing the failed fields is returned if the validation fails,
+// which is written as 400 with the fields in the details by ServeError or returned by the action.
 func (c *Controller) ParseForm(obj interface{}) error {
-	return parseForm(c.R.Form, obj)
+	if err := parseForm(c.R.Form, obj); err != nil {
+		return err
+	}
+
+	return mapping.Validate(formTag, obj, formValuer(c.R.Form))
+}
+
+// ParseJSON unmarshals RequestBody into obj, and validates the struct pointed by obj
+// with the json tag options like ParseForm.
+func (c *Controller) ParseJSON(obj interface{}) error {
+	if !isStructPtr(reflect.TypeOf(obj)) {
+		// like slices and maps, nothing to validate
+		return json.Unmarshal(c.RequestBody, obj)
+	}
+
+	m, err := mapping.JsonBytesToMap(c.RequestBody)
+	if err != nil {
+		return err
+	}
+
+	// the body is decoded once, the struct is filled and validated with the decoded map
+	return mapping.UnmarshalKey(m, obj)
 }
 
 // ParseForm will parse form values to struct via tag.
@@ -97,7 +155,7 @@ func parseFormToStruct(form url.Values, objT reflect.Type, objV reflect.Value) e
 			continue
 		}
 
-		tags := strings.Split(fieldT.Tag.Get("form"), ",")
+		tags := strings.Split(fieldT.Tag.Get(formTag), ",")
 		var tag string
 		if len(tags) == 0 || len(tags[0]) == 0 {
 			tag = fieldT.Name
@@ -215,6 +273,18 @@ func isStructPtr(t reflect.Type) bool {
 	return t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct
 }
 
+// formValuer tells the provided form values, the empty values are taken as not provided like parseForm does.
+type formValuer url.Values
+
+func (fv formValuer) Value(key string) (interface{}, bool) {
+	vals, ok := fv[key]
+	if !ok || len(vals) == 0 || len(vals[0]) == 0 {
+		return nil, false
+	}
+
+	return vals[0], true
+}
+
 // Query returns input data item string by a given string.
 func (c *Controller) Query(key string) string {
 	if val, ok := c.Params[key]; ok {
@@ -378,8 +448,103 @@ func (c *Controller) Cookie(key string) string {
 	return ck.Value
 }
 
-// // Session returns current session item value by a given key.
-// // if non-existed, return nil.
-// func (c *Controller) Session(key interface{}) interface{} {
-// 	return c.R.CruSession.Get(key)
-// }
+// StartSession starts the session of the request if it's not started.
+func (c *Controller) StartSession() session.Store {
+	if c.CruSession != nil {
+		return c.CruSession
+	}
+
+	sessions := stateOf(c.R).sessions
+	if sessions == nil {
+		logx.Error("session is not enabled, set SessionOn in the config")
+		return nil
+	}
+
+	store, err := sessions.SessionStart(c.W, c.R)
+	if err != nil {
+		logx.Error(err)
+		return nil
+	}
+
+	c.setSession(store)
+	return store
+}
+
+// SetSession puts value into the session.
+func (c *Controller) SetSession(name string, value interface{}) {
+	if store := c.StartSession(); store != nil {
+		store.Set(name, value)
+	}
+}
+
+// GetSession returns the value of the session by name,
+// if non-existed, return nil.
+func (c *Controller) GetSession(name string) interface{} {
+	if store := c.StartSession(); store != nil {
+		return store.Get(name)
+	}
+
+	return nil
+}
+
+// DelSession removes the value of the session by name.
+func (c *Controller) DelSession(name string) {
+	if store := c.StartSession(); store != nil {
+		store.Delete(name)
+	}
+}
+
+// SessionRegenerateID moves the session to a new session id, call it after login to prevent session fixation.
+func (c *Controller) SessionRegenerateID() {
+	sessions := stateOf(c.R).sessions
+	if sessions == nil {
+		return
+	}
+
+	if c.CruSession != nil {
+		if err := c.CruSession.SessionRelease(); err != nil {
+			logx.Error(err)
+		}
+	}
+
+	store, err := sessions.SessionRegenerateID(c.W, c.R)
+	if err != nil {
+		logx.Error(err)
+		return
+	}
+
+	c.setSession(store)
+}
+
+// DestroySession removes the session and its cookie.
+func (c *Controller) DestroySession() {
+	sessions := stateOf(c.R).sessions
+	if sessions == nil {
+		return
+	}
+
+	if c.CruSession != nil {
+		c.CruSession.Flush()
+		c.CruSession = nil
+	}
+
+	if err := sessions.SessionDestroy(c.W, c.R); err != nil {
+		logx.Error(err)
+	}
+}
+
+// setSession sets the current session, which is persisted after the request.
+func (c *Controller) setSession(store session.Store) {
+	first := c.CruSession == nil
+	c.CruSession = store
+	if first && c.Ctx != nil {
+		c.Ctx.OnFinish(func() {
+			if c.CruSession == nil {
+				return
+			}
+			if err := c.CruSession.SessionRelease(); err != nil {
+				logx.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package apix
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const secureCookieSeparator = "|"
+
+// DefaultSecureCookieMaxAge is the max age of the cookies set by SetSecureCookie without maxAge,
+// GetSecureCookie rejects the cookies signed longer ago.
+var DefaultSecureCookieMaxAge = 30 * 24 * time.Hour
+
+// SetCookie sets a cookie on the response,
+// others are optional in the order of maxAge(int, seconds), path(string), domain(string),
+// secure(bool), httpOnly(bool), the path is / by default.
+func (c *Controller) SetCookie(name, value string, others ...interface{}) {
+	cookie := &http.Cookie{
+		Name:  name,
+		Value: url.QueryEscape(value),
+		Path:  "/",
+	}
+
+	if len(others) > 0 {
+		maxAge := cookieMaxAge(others)
+		if maxAge > 0 {
+			cookie.MaxAge = maxAge
+			cookie.Expires = time.Now().Add(time.Duration(maxAge) * time.Second)
+		} else if maxAge < 0 {
+			cookie.MaxAge = -1
+			cookie.Expires = time.Unix(1, 0)
+		}
+	}
+	if len(others) > 1 {
+		if v, ok := others[1].(string); ok && len(v) > 0 {
+			cookie.Path = v
+		}
+	}
+	if len(others) > 2 {
+		if v, ok := others[2].(string); ok {
+			cookie.Domain = v
+		}
+	}
+	if len(others) > 3 {
+		if v, ok := others[3].(bool); ok {
+			cookie.Secure = v
+		}
+	}
+	if len(others) > 4 {
+		if v, ok := others[4].(bool); ok {
+			cookie.HttpOnly = v
+		}
+	}
+
+	http.SetCookie(c.W, cookie)
+}
+
+// GetSecureCookie returns the value of the cookie set by SetSecureCookie, false is returned
+// if the cookie is missing, expired, the signature doesn't match, or secret is empty.
+func (c *Controller) GetSecureCookie(secret, key string) (string, bool) {
+	if len(secret) == 0 {
+		return "", false
+	}
+
+	val := c.Cookie(key)
+	if len(val) == 0 {
+		return "", false
+	}
+
+	val, err := url.QueryUnescape(val)
+	if err != nil {
+		return "", false
+	}
+
+	parts := strings.SplitN(val, secureCookieSeparator, 3)
+	if len(parts) != 3 {
+		return "", false
+	}
+
+	vs, expires, sig := parts[0], parts[1], parts[2]
+	if !hmac.Equal([]byte(sig), []byte(signCookie(secret, vs, expires))) {
+		return "", false
+	}
+	if expiresAt, err := strconv.ParseInt(expires, 10, 64); err != nil || time.Now().Unix() >= expiresAt {
+		return "", false
+	}
+
+	res, err := base64.URLEncoding.DecodeString(vs)
+	if err != nil {
+		return "", false
+	}
+
+	return string(res), true
+}
+
+// SetSecureCookie sets a cookie signed with secret by hmac-sha256, others are the same as SetCookie.
+// The expiry time of maxAge, or DefaultSecureCookieMaxAge without maxAge, is signed in the cookie.
+func (c *Controller) SetSecureCookie(secret, name, value string, others ...interface{}) {
+	maxAge := DefaultSecureCookieMaxAge
+	if seconds := cookieMaxAge(others); seconds != 0 {
+		maxAge = time.Duration(seconds) * time.Second
+	}
+
+	vs := base64.URLEncoding.EncodeToString([]byte(value))
+	expires := strconv.FormatInt(time.Now().Add(maxAge).Unix(), 10)
+	cookie := strings.Join([]string{vs, expires, signCookie(secret, vs, expires)}, secureCookieSeparator)
+	c.SetCookie(name, cookie, others...)
+}
+
+func cookieMaxAge(others []interface{}) int {
+	if len(others) == 0 {
+		return 0
+	}
+
+	switch v := others[0].(type) {
+	case int:
+		return v
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	default:
+		return 0
+	}
+}
+
+func signCookie(secret, value, expires string) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(h, "%s%s%s", value, secureCookieSeparator, expires)
+	return fmt.Sprintf("%02x", h.Sum(nil))
+}
@@ -0,0 +1,172 @@
+package apix
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync"
+
+	"github.com/weblazy/core/logx"
+	"github.com/weblazy/core/mapping"
+	"github.com/weblazy/core/tracex"
+)
+
+type (
+	// HTTPError is an error with the http status code, actions return it to respond with the code,
+	// it's serialized as the json error body, or rendered by the error page of the code.
+	HTTPError struct {
+		Code    int         `json:"code"`
+		Message string      `json:"message"`
+		Details interface{} `json:"details,omitempty"`
+	}
+
+	// ErrorBodyFunc returns the json body of the error responses.
+	ErrorBodyFunc func(r *http.Request, err *HTTPError) interface{}
+
+	defaultErrorBody struct {
+		*HTTPError
+		RequestID string `json:"requestId,omitempty"`
+	}
+)
+
+var (
+	errorBodyFunc ErrorBodyFunc = func(r *http.Request, err *HTTPError) interface{} {
+		return defaultErrorBody{
+			HTTPError: err,
+			RequestID: tracex.RequestIDFromContext(r.Context()),
+		}
+	}
+	errorPages    = make(map[int]string)
+	errorPageLock sync.RWMutex
+)
+
+// NewHTTPError returns an HTTPError, the message defaults to the status text of code,
+// details are put into the error body if given.
+func NewHTTPError(code int, message string, details ...interface{}) *HTTPError {
+	if len(message) == 0 {
+		message = http.StatusText(code)
+	}
+
+	err := &HTTPError{
+		Code:    code,
+		Message: message,
+	}
+	if len(details) == 1 {
+		err.Details = details[0]
+	} else if len(details) > 1 {
+		err.Details = details
+	}
+
+	return err
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("%d: %s", e.Code, e.Message)
+}
+
+// SetErrorBody sets the function that builds the json body of the error responses,
+// the default body is like {"code":404,"message":"Not Found","requestId":"..."}.
+func SetErrorBody(fn ErrorBodyFunc) {
+	errorBodyFunc = fn
+}
+
+// SetErrorPage renders the template tplName for the errors with the status code,
+// if the client accepts html. The template is executed with the HTTPError, like {{.Message}}.
+// It's the package state for the requests served by ControllerRegister directly,
+// the Servers have their own error pages by config.ApiConfig.ErrorPages.
+func SetErrorPage(code int, tplName string) {
+	errorPageLock.Lock()
+	errorPages[code] = tplName
+	errorPageLock.Unlock()
+}
+
+// ServeError writes err as the error response, see AbortWithError.
+func (c *Controller) ServeError(err error) {
+	writeError(c.W, c.R, err)
+}
+
+// AbortWithError writes err as the error response and stops the request.
+// err is written with its code if it's an HTTPError, as 400 if it's a mapping.ValidationErrors,
+// otherwise it's logged and written as 500,
+// without exposing its message to the client.
+func (ctx *Context) AbortWithError(err error) {
+	writeError(ctx.W, ctx.R, err)
+	ctx.Stop()
+}
+
+// writeError writes err with the error page of its code, or as json.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var httpErr *HTTPError
+	var validationErrs mapping.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		// the request failed the validation of ParseForm, ParseJSON or Bind
+		httpErr = NewHTTPError(http.StatusBadRequest, "", validationErrs)
+	} else if !errors.As(err, &httpErr) {
+		logx.Errorf("%s %s: %s", r.Method, r.URL.Path, err)
+		httpErr = NewHTTPError(http.StatusInternalServerError, "")
+	}
+	if sw, ok := w.(startedWriter); ok && sw.started() {
+		// the response is written already, or the connection is hijacked
+		return
+	}
+
+	header := w.Header()
+	header.Del("Content-Length")
+	header.Set("X-Content-Type-Options", "nosniff")
+
+	state := stateOf(r)
+	if tplName, ok := state.errorPage(httpErr.Code); ok && acceptsHTML(r) {
+		content, tplErr := executeTemplate(&state.conf, tplName, httpErr)
+		if tplErr == nil {
+			header.Set("Content-Type", textHTML+charsetUTF8)
+			w.WriteHeader(httpErr.Code)
+			w.Write(content)
+			return
+		}
+		logx.Error(tplErr)
+	}
+
+	content, jsonErr := json.Marshal(errorBodyFunc(r, httpErr))
+	if jsonErr != nil {
+		logx.Error(jsonErr)
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	header.Set("Content-Type", applicationJSON+charsetUTF8)
+	w.WriteHeader(httpErr.Code)
+	w.Write(content)
+}
+
+// recoverPanic recovers the panic of the request, logs it with the stack,
+// and writes 500 if the response is not started yet.
+func recoverPanic(ctx *Context) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	if v == http.ErrAbortHandler {
+		// aborts the response deliberately, let net/http handle it
+		panic(v)
+	}
+
+	logx.ErrorStack(fmt.Sprintf("%s %s: %v\n", ctx.R.Method, ctx.R.URL.Path, v), string(debug.Stack()))
+	if !ctx.W.Started {
+		writeError(ctx.W, ctx.R, NewHTTPError(http.StatusInternalServerError, ""))
+	}
+	ctx.Stop()
+}
+
+func acceptsHTML(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		if mediaType == textHTML || mediaType == "application/xhtml+xml" {
+			return true
+		}
+	}
+
+	return false
+}
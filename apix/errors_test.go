@@ -0,0 +1,139 @@
+package apix
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type errorTestController struct {
+	Controller
+}
+
+func (c *errorTestController) Panic() {
+	panic("boom")
+}
+
+func (c *errorTestController) SlowPanic() {
+	panic("boom")
+}
+
+func (c *errorTestController) Missing() (interface{}, error) {
+	return nil, NewHTTPError(http.StatusNotFound, "user not found", map[string]string{"id": c.Params["id"]})
+}
+
+func (c *errorTestController) Internal() error {
+	return errors.New("database is down")
+}
+
+func (c *errorTestController) Partial() error {
+	c.W.WriteHeader(http.StatusAccepted)
+	c.W.Write([]byte("partial"))
+	return errors.New("failed after writing")
+}
+
+func TestErrorResponses(t *testing.T) {
+	mux := NewControllerRegister()
+	assert.Nil(t, mux.Add("/panic", &errorTestController{}, "get:Panic"))
+	assert.Nil(t, mux.Add("/slow-panic", &errorTestController{}, "get:SlowPanic"))
+	assert.Nil(t, mux.Add("/users/:id", &errorTestController{}, "get:Missing"))
+	assert.Nil(t, mux.Add("/internal", &errorTestController{}, "get:Internal"))
+	assert.Nil(t, mux.InsertFilter("/slow-panic", BeforeRouter, TimeoutFilter(time.Second)))
+
+	var finished bool
+	assert.Nil(t, mux.InsertFilter("/*", FinishRouter, func(ctx *Context) {
+		finished = true
+	}))
+
+	serve := func(path string, accept string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		mux.serveHTTP(w, r)
+
+		var body map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return w, body
+	}
+
+	for _, path := range []string{"/panic", "/slow-panic"} {
+		finished = false
+		w, body := serve(path, "")
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Equal(t, float64(500), body["code"])
+		assert.NotEmpty(t, body["requestId"])
+		assert.True(t, finished)
+	}
+
+	w, body := serve("/users/7", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "user not found", body["message"])
+	assert.Equal(t, map[string]interface{}{"id": "7"}, body["details"])
+
+	w, body = serve("/internal", "")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "Internal Server Error", body["message"])
+
+	w, body = serve("/nowhere", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "Not Found", body["message"])
+
+	dir, err := ioutil.TempDir("", "apix")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "404.html"), []byte("<h1>{{.Code}} {{.Message}}</h1>"), 0644))
+	viewPath := ApiConfig.ViewPath
+	ApiConfig.ViewPath = dir
+	defer func() {
+		ApiConfig.ViewPath = viewPath
+		delete(errorPages, http.StatusNotFound)
+	}()
+	SetErrorPage(http.StatusNotFound, "404.html")
+
+	w, _ = serve("/users/7", "text/html,application/xhtml+xml")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "<h1>404 user not found</h1>", w.Body.String())
+	w, body = serve("/users/7", "application/json")
+	assert.Equal(t, "user not found", body["message"])
+}
+
+func TestErrorAfterStarted(t *testing.T) {
+	mux := NewControllerRegister()
+	assert.Nil(t, mux.Add("/partial", &errorTestController{}, "get:Partial"))
+	assert.Nil(t, mux.Add("/timed-partial", &errorTestController{}, "get:Partial"))
+	assert.Nil(t, mux.InsertFilter("/timed-partial", BeforeRouter, TimeoutFilter(time.Second)))
+
+	for _, path := range []string{"/partial", "/timed-partial"} {
+		w := httptest.NewRecorder()
+		mux.serveHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusAccepted, w.Code, path)
+		assert.Equal(t, "partial", w.Body.String(), path)
+	}
+}
+
+func TestFinishFilterPanic(t *testing.T) {
+	mux := NewControllerRegister()
+	assert.Nil(t, mux.Add("/users/:id", &errorTestController{}, "get:Missing"))
+	assert.Nil(t, mux.InsertFilter("/*", FinishRouter, func(ctx *Context) {
+		panic("boom")
+	}))
+	var finished bool
+	assert.Nil(t, mux.InsertFilter("/*", FinishRouter, func(ctx *Context) {
+		finished = true
+	}))
+
+	w := httptest.NewRecorder()
+	assert.NotPanics(t, func() {
+		mux.serveHTTP(w, httptest.NewRequest(http.MethodGet, "/users/7", nil))
+	})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.True(t, finished)
+}
@@ -0,0 +1,154 @@
+package apix
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/weblazy/core/logx"
+)
+
+// the insertion points of filters, in the order they are executed.
+const (
+	// BeforeRouter filters are executed before finding the route.
+	BeforeRouter = iota
+	// BeforeExec filters are executed after the route is found and before the controller.
+	BeforeExec
+	// AfterExec filters are executed after the controller.
+	AfterExec
+	// FinishRouter filters are always executed at last, even if the request was stopped.
+	FinishRouter
+)
+
+type (
+	// FilterFunc is the signature of filters,
+	// a filter short-circuits the request by writing the response or calling ctx.Stop.
+	FilterFunc func(ctx *Context)
+
+	// FilterRouter is a filter registered on a url pattern.
+	FilterRouter struct {
+		pattern    string
+		tree       *Tree
+		filterFunc FilterFunc
+	}
+)
+
+// InsertFilter registers a filter on pattern at the given position,
+// pattern uses the router notation, /* matches all the urls.
+func InsertFilter(pattern string, pos int, filter FilterFunc) {
+	if err := defaultRegister.InsertFilter(pattern, pos, filter); err != nil {
+		logx.Fatal(err)
+	}
+}
+
+// InsertFilter registers a filter on pattern at the given position,
+// filters on the same position are executed in the order of insertion.
+func (p *ControllerRegister) InsertFilter(pattern string, pos int, filter FilterFunc) error {
+	if pos < BeforeRouter || pos > FinishRouter {
+		return fmt.Errorf("wrong filter position %d", pos)
+	}
+
+	tree := NewTree()
+	if err := tree.AddRouter(pattern, true); err != nil {
+		return err
+	}
+
+	p.enableFilter = true
+	p.filters[pos] = append(p.filters[pos], &FilterRouter{
+		pattern:    pattern,
+		tree:       tree,
+		filterFunc: filter,
+	})
+	return nil
+}
+
+// insertFilterOnce inserts the filter like InsertFilter, unless a filter with the same key is inserted already.
+func (p *ControllerRegister) insertFilterOnce(key, pattern string, pos int, filter FilterFunc) error {
+	if p.filterKeys[key] {
+		return nil
+	}
+
+	if err := p.InsertFilter(pattern, pos, filter); err != nil {
+		return err
+	}
+	if p.filterKeys == nil {
+		p.filterKeys = make(map[string]bool)
+	}
+	p.filterKeys[key] = true
+	return nil
+}
+
+// ValidRouter tells whether the filter matches urlPath.
+func (f *FilterRouter) ValidRouter(urlPath string) bool {
+	runObject, _ := f.tree.Match(urlPath)
+	return runObject != nil
+}
+
+// execFilter executes the filters at pos, and returns true if the request is short-circuited.
+// BeforeRouter and BeforeExec filters short-circuit on written response as well,
+// FinishRouter filters are never short-circuited.
+func (p *ControllerRegister) execFilter(ctx *Context, pos int, urlPath string) bool {
+	for _, filter := range p.filters[pos] {
+		if p.shallStop(ctx, pos) {
+			return true
+		}
+		if !filter.ValidRouter(urlPath) {
+			continue
+		}
+		if pos == FinishRouter {
+			execFinishFilter(ctx, filter.filterFunc)
+		} else {
+			filter.filterFunc(ctx)
+		}
+	}
+
+	return p.shallStop(ctx, pos)
+}
+
+// execFinishFilter executes the FinishRouter filter, the panic is recovered,
+// so that the rest of FinishRouter filters are still executed.
+func execFinishFilter(ctx *Context, filter FilterFunc) {
+	defer recoverPanic(ctx)
+	filter(ctx)
+}
+
+func (p *ControllerRegister) shallStop(ctx *Context, pos int) bool {
+	switch pos {
+	case BeforeRouter, BeforeExec:
+		return ctx.stopped || ctx.W.Started
+	case AfterExec:
+		return ctx.stopped
+	default:
+		return false
+	}
+}
+
+// TimeoutFilter returns a BeforeRouter filter that sets a deadline on the request,
+// the controller is served with httphandler.TimeoutHandler until the deadline.
+// The streaming routes, websocket and server-sent events, must be exempted by StreamingFilter,
+// since httphandler.TimeoutHandler buffers the response until the controller returns.
+func TimeoutFilter(duration time.Duration) FilterFunc {
+	return func(ctx *Context) {
+		if duration <= 0 || ctx.streaming {
+			return
+		}
+
+		ctx.untimed = ctx.R.Context()
+		c, cancel := context.WithTimeout(ctx.untimed, duration)
+		ctx.R = ctx.R.WithContext(c)
+		ctx.OnFinish(cancel)
+	}
+}
+
+// StreamingFilter returns a filter that exempts the requests from TimeoutFilter,
+// insert it on the websocket and server-sent events routes at BeforeRouter or BeforeExec,
+// before or after TimeoutFilter.
+func StreamingFilter() FilterFunc {
+	return func(ctx *Context) {
+		ctx.streaming = true
+		if ctx.untimed != nil {
+			ctx.R = ctx.R.WithContext(ctx.untimed)
+			ctx.untimed = nil
+		}
+	}
+}
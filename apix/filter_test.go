@@ -0,0 +1,72 @@
+package apix
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type filterTestController struct {
+	Controller
+}
+
+func (c *filterTestController) Get() {
+	if v, ok := c.Ctx.GetData("user").(string); ok {
+		c.W.Write([]byte(v))
+	}
+}
+
+func (c *filterTestController) Slow() {
+	time.Sleep(time.Millisecond * 50)
+	c.W.Write([]byte("slow"))
+}
+
+func TestFilters(t *testing.T) {
+	var trace []string
+	mux := NewControllerRegister()
+	assert.Nil(t, mux.Add("/users/:id", &filterTestController{}))
+	assert.Nil(t, mux.Add("/slow", &filterTestController{}, "get:Slow"))
+	assert.NotNil(t, mux.InsertFilter("/*", FinishRouter+1, func(ctx *Context) {}))
+	assert.Nil(t, mux.InsertFilter("/*", BeforeRouter, func(ctx *Context) {
+		trace = append(trace, "before-router")
+		if ctx.R.Header.Get("Authorization") == "" {
+			ctx.Abort(http.StatusUnauthorized, "Unauthorized")
+		}
+	}))
+	assert.Nil(t, mux.InsertFilter("/users/:id", BeforeExec, func(ctx *Context) {
+		trace = append(trace, "before-exec")
+		ctx.SetData("user", ctx.Params["id"])
+	}))
+	assert.Nil(t, mux.InsertFilter("/users/*", AfterExec, func(ctx *Context) {
+		trace = append(trace, "after-exec")
+	}))
+	assert.Nil(t, mux.InsertFilter("/*", FinishRouter, func(ctx *Context) {
+		trace = append(trace, "finish-router")
+	}))
+	assert.Nil(t, mux.InsertFilter("/slow", BeforeRouter, TimeoutFilter(time.Millisecond*10)))
+
+	w := httptest.NewRecorder()
+	mux.serveHTTP(w, httptest.NewRequest(http.MethodGet, "/users/7", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, []string{"before-router", "finish-router"}, trace)
+
+	trace = nil
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/users/7", nil)
+	r.Header.Set("Authorization", "token")
+	mux.serveHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "7", w.Body.String())
+	assert.Equal(t, []string{"before-router", "before-exec", "after-exec", "finish-router"}, trace)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/slow", nil)
+	r.Header.Set("Authorization", "token")
+	mux.serveHTTP(w, r)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.True(t, strings.Contains(w.Body.String(), "Request Timeout"))
+}
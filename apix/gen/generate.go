@@ -0,0 +1,1229 @@
+// Package gen generates the routers, the OpenAPI documents and the scaffolds of apix controllers for cmd/apigen.
+package gen
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/weblazy/core/apix"
+	"github.com/weblazy/core/apix/openapi"
+)
+
+const (
+	apixImportPath      = "github.com/weblazy/core/apix"
+	controllerTypeName  = "Controller"
+	routerAnnotation    = "@router"
+	paramsAnnotation    = "@params"
+	bodyAnnotation      = "@body"
+	successAnnotation   = "@success"
+	tagsAnnotation      = "@tags"
+	deprecatedMark      = "@deprecated"
+	generatedCodeHeader = "// Code generated by apigen. DO NOT EDIT."
+	// the directory of the overlaid main file of GenerateOpenAPI, it doesn't exist in the module
+	overlayDir = ".apigen"
+)
+
+var (
+	identifierRegex       = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	routerAnnotationRegex = regexp.MustCompile(`^@router\s+(\S+)(?:\s+\[([^\]]*)\])?\s*$`)
+	// the methods of apix.Controller, which are not actions
+	controllerMethods = methodNames(reflect.TypeOf(new(apix.Controller)))
+
+	routerTemplate = template.Must(template.New("router").Parse(`{{.Header}}
+
+package {{.Package}}
+
+import (
+	"github.com/weblazy/core/apix"
+	{{if ne .Alias .Name}}{{.Alias}} {{end}}"{{.ImportPath}}"
+{{- range .Imports}}
+	{{if .Named}}{{.Alias}} {{end}}"{{.Path}}"
+{{- end}}
+)
+
+// RouterMap is served by apix.Run, every action of the controllers is routed under its key.
+var RouterMap = map[string]apix.ControllerInterface{
+{{- range .Auto}}
+	"{{.Prefix}}": &{{$.Alias}}.{{.Name}}{},
+{{- end}}
+}
+
+func init() {
+{{- range .Routes}}
+	apix.Router("{{.Pattern}}", &{{$.Alias}}.{{.Controller}}{}, "{{.Mapping}}")
+{{- end}}
+{{- range .Docs}}
+	apix.Doc(&{{$.Alias}}.{{.Controller}}{}, "{{.Action}}", {{.Literal}})
+{{- end}}
+}
+`))
+
+	openAPIMainTemplate = template.Must(template.New("openapi").Parse(`package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/weblazy/core/apix"
+	"github.com/weblazy/core/apix/openapi"
+	routers "{{.ImportPath}}"
+)
+
+func main() {
+	for prefix, c := range routers.RouterMap {
+		apix.AutoRouter(prefix, c)
+	}
+
+	info := {{.Info}}
+	if err := apix.WriteOpenAPI(os.Stdout, info); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+`))
+
+	controllerTemplate = template.Must(template.New("controller").Parse(`package {{.Package}}
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/weblazy/core/apix"
+	"github.com/weblazy/core/database/sqlx"
+	"{{.ModelImport}}"
+)
+
+// {{.Name}}Model must be set before serving, like {{.Package}}.{{.Name}}Model = {{.ModelPackage}}.New{{.Name}}Model(conn).
+var {{.Name}}Model *{{.ModelPackage}}.{{.Name}}Model
+
+// {{.Name}}Controller serves the {{.Resource}} resources.
+type {{.Name}}Controller struct {
+	apix.Controller
+}
+
+// List returns the {{.Resource}} list, paged by offset and limit.
+// @router /{{.Resource}}s [get]
+// @success []{{.ModelPackage}}.{{.Name}}
+func (c *{{.Name}}Controller) List() {
+	offset, err := c.GetInt64("offset", 0)
+	if err != nil {
+		c.Ctx.Abort(http.StatusBadRequest, err.Error())
+		return
+	}
+	limit, err := c.GetInt64("limit", 20)
+	if err != nil {
+		c.Ctx.Abort(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	list, err := {{.Name}}Model.FindAll(offset, limit)
+	if err != nil {
+		c.Ctx.Abort(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.Data["json"] = list
+	c.ServeJSON()
+}
+
+// Show returns the {{.Resource}} of the given id.
+// @router /{{.Resource}}s/:id [get]
+// @success {{.ModelPackage}}.{{.Name}}
+func (c *{{.Name}}Controller) Show() {
+	id, err := strconv.ParseInt(c.Params["id"], 10, 64)
+	if err != nil {
+		c.Ctx.Abort(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	data, err := {{.Name}}Model.FindOne(id)
+	switch err {
+	case nil:
+		c.Data["json"] = data
+		c.ServeJSON()
+	case sqlx.ErrNotFound:
+		c.Ctx.Abort(http.StatusNotFound, http.StatusText(http.StatusNotFound))
+	default:
+		c.Ctx.Abort(http.StatusInternalServerError, err.Error())
+	}
+}
+
+// Create creates a {{.Resource}}.
+// @router /{{.Resource}}s [post]
+// @body {{.ModelPackage}}.{{.Name}}
+// @success {{.ModelPackage}}.{{.Name}}
+func (c *{{.Name}}Controller) Create() {
+	var data {{.ModelPackage}}.{{.Name}}
+	if err := c.Bind(&data); err != nil {
+		c.Ctx.Abort(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id, err := {{.Name}}Model.Insert(&data)
+	if err != nil {
+		c.Ctx.Abort(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	data.Id = id
+	c.Data["json"] = data
+	c.ServeJSON()
+}
+
+// Update updates the {{.Resource}} of the given id.
+// @router /{{.Resource}}s/:id [put]
+// @body {{.ModelPackage}}.{{.Name}}
+// @success {{.ModelPackage}}.{{.Name}}
+func (c *{{.Name}}Controller) Update() {
+	id, err := strconv.ParseInt(c.Params["id"], 10, 64)
+	if err != nil {
+		c.Ctx.Abort(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var data {{.ModelPackage}}.{{.Name}}
+	if err := c.Bind(&data); err != nil {
+		c.Ctx.Abort(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	data.Id = id
+	if err := {{.Name}}Model.Update(&data); err != nil {
+		c.Ctx.Abort(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.Data["json"] = data
+	c.ServeJSON()
+}
+
+// Delete deletes the {{.Resource}} of the given id.
+// @router /{{.Resource}}s/:id [delete]
+func (c *{{.Name}}Controller) Delete() {
+	id, err := strconv.ParseInt(c.Params["id"], 10, 64)
+	if err != nil {
+		c.Ctx.Abort(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := {{.Name}}Model.Delete(id); err != nil {
+		c.Ctx.Abort(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.W.WriteHeader(http.StatusNoContent)
+}
+`))
+
+	modelTemplate = template.Must(template.New("model").Parse(`package {{.ModelPackage}}
+
+import (
+	"github.com/weblazy/core/database/sqlx"
+)
+
+const {{.Resource}}Fields = "` + "`id`, `name`" + `"
+
+type (
+	// {{.Name}} is a row of the {{.Table}} table, add the columns as fields with db tags.
+	{{.Name}} struct {
+		Id   int64  ` + "`db:\"id\" json:\"id\" form:\"-\"`" + `
+		Name string ` + "`db:\"name\" json:\"name\" form:\"name\"`" + `
+	}
+
+	// {{.Name}}Model accesses the {{.Table}} table.
+	{{.Name}}Model struct {
+		conn  sqlx.SqlConn
+		table string
+	}
+)
+
+// New{{.Name}}Model returns a {{.Name}}Model on conn.
+func New{{.Name}}Model(conn sqlx.SqlConn) *{{.Name}}Model {
+	return &{{.Name}}Model{
+		conn:  conn,
+		table: "` + "`{{.Table}}`" + `",
+	}
+}
+
+// FindOne returns the {{.Resource}} of the given id, sqlx.ErrNotFound if not exists.
+func (m *{{.Name}}Model) FindOne(id int64) (*{{.Name}}, error) {
+	var resp {{.Name}}
+	query := "select " + {{.Resource}}Fields + " from " + m.table + " where ` + "`id`" + ` = ? limit 1"
+	if err := m.conn.QueryRow(&resp, query, id); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// FindAll returns at most limit rows from offset, ordered by id.
+func (m *{{.Name}}Model) FindAll(offset, limit int64) ([]*{{.Name}}, error) {
+	var resp []*{{.Name}}
+	query := "select " + {{.Resource}}Fields + " from " + m.table + " order by ` + "`id`" + ` limit ?, ?"
+	if err := m.conn.QueryRows(&resp, query, offset, limit); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// Insert inserts data and returns its id.
+func (m *{{.Name}}Model) Insert(data *{{.Name}}) (int64, error) {
+	query := "insert into " + m.table + " (` + "`name`" + `) values (?)"
+	result, err := m.conn.Exec(query, data.Name)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+// Update updates the row of data.Id with data.
+func (m *{{.Name}}Model) Update(data *{{.Name}}) error {
+	query := "update " + m.table + " set ` + "`name`" + ` = ? where ` + "`id`" + ` = ?"
+	_, err := m.conn.Exec(query, data.Name, data.Id)
+	return err
+}
+
+// Delete deletes the row of the given id.
+func (m *{{.Name}}Model) Delete(id int64) error {
+	query := "delete from " + m.table + " where ` + "`id`" + ` = ?"
+	_, err := m.conn.Exec(query, id)
+	return err
+}
+`))
+)
+
+type (
+	// ControllerPackage is a package of controllers parsed from the source files.
+	ControllerPackage struct {
+		Name        string
+		ImportPath  string
+		Dir         string
+		Controllers []*ControllerSpec
+	}
+
+	// ControllerSpec is a struct embedding apix.Controller, directly or by another controller.
+	ControllerSpec struct {
+		Name    string
+		Doc     string
+		Actions []*ActionSpec
+	}
+
+	// ActionSpec is an exported method of a controller, Routes are taken from its @router annotations,
+	// and the others are documented by the annotations like:
+	//	// @params QueryForm      the form struct of ParseForm
+	//	// @body models.User      the json body of ParseJSON
+	//	// @success []models.User the json response
+	//	// @tags users,admin
+	//	// @deprecated
+	ActionSpec struct {
+		Name       string
+		Doc        string
+		Routes     []*RouteSpec
+		Params     *TypeRef
+		Body       *TypeRef
+		Response   *TypeRef
+		Tags       []string
+		Deprecated bool
+	}
+
+	// TypeRef is a type expression in an annotation, like []models.User,
+	// the types of the controller package are qualified by its name,
+	// and Imports maps the package names used by Expr to their import paths.
+	TypeRef struct {
+		Expr    string
+		Imports map[string]string
+	}
+
+	// RouteSpec is an annotation like // @router /users/:id [get,post],
+	// Methods is empty if the http methods are not specified, which means all of them.
+	RouteSpec struct {
+		Pattern string
+		Methods []string
+	}
+
+	routerRoute struct {
+		Pattern    string
+		Controller string
+		Mapping    string
+	}
+
+	routerDoc struct {
+		Controller string
+		Action     string
+		Literal    string
+	}
+
+	routerImport struct {
+		Alias string
+		Path  string
+		Named bool
+	}
+
+	routerAuto struct {
+		Prefix string
+		Name   string
+	}
+
+	scaffoldData struct {
+		Package      string
+		Name         string
+		Resource     string
+		Table        string
+		ModelPackage string
+		ModelImport  string
+	}
+)
+
+// Prefix returns the key of the controller in the router map, like /User/ for UserController.
+func (c *ControllerSpec) Prefix() string {
+	return "/" + strings.TrimSuffix(c.Name, controllerTypeName) + "/"
+}
+
+// Annotated tells whether any action of the controller has @router annotations.
+func (c *ControllerSpec) Annotated() bool {
+	for _, action := range c.Actions {
+		if len(action.Routes) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Mapping returns the mapping methods of the route used by ControllerRegister.Add.
+func (r *RouteSpec) Mapping(action string) string {
+	if len(r.Methods) == 0 {
+		return "*:" + action
+	}
+
+	return strings.Join(r.Methods, ",") + ":" + action
+}
+
+// ParseControllers parses the go files in dir, and returns the controllers with their actions and routes.
+func ParseControllers(dir string) (*ControllerPackage, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	var pkg *ast.Package
+	for name, p := range pkgs {
+		if pkg != nil {
+			return nil, fmt.Errorf("multiple packages %s and %s in %s", pkg.Name, name, dir)
+		}
+		pkg = p
+	}
+	if pkg == nil {
+		return nil, fmt.Errorf("no go files in %s", dir)
+	}
+
+	importPath, err := resolveImportPath(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	fileNames := make([]string, 0, len(pkg.Files))
+	for name := range pkg.Files {
+		fileNames = append(fileNames, name)
+	}
+	sort.Strings(fileNames)
+
+	types := make(map[string]*ast.TypeSpec)
+	docs := make(map[string]string)
+	var typeNames []string
+	for _, name := range fileNames {
+		for _, decl := range pkg.Files[name].Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if _, ok := ts.Type.(*ast.StructType); !ok {
+					continue
+				}
+				doc := ts.Doc
+				if doc == nil && len(gen.Specs) == 1 {
+					doc = gen.Doc
+				}
+				types[ts.Name.Name] = ts
+				docs[ts.Name.Name] = strings.TrimSpace(doc.Text())
+				typeNames = append(typeNames, ts.Name.Name)
+			}
+		}
+	}
+
+	controllers := findControllers(pkg, fileNames, types)
+	specs := make(map[string]*ControllerSpec)
+	result := &ControllerPackage{
+		Name:       pkg.Name,
+		ImportPath: importPath,
+		Dir:        dir,
+	}
+	for _, name := range typeNames {
+		if controllers[name] {
+			spec := &ControllerSpec{
+				Name: name,
+				Doc:  docs[name],
+			}
+			specs[name] = spec
+			result.Controllers = append(result.Controllers, spec)
+		}
+	}
+
+	for _, name := range fileNames {
+		imports := fileImports(pkg.Files[name])
+		for _, decl := range pkg.Files[name].Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv == nil || len(fn.Recv.List) == 0 || !fn.Name.IsExported() {
+				continue
+			}
+			spec, ok := specs[receiverName(fn.Recv.List[0].Type)]
+			if !ok {
+				continue
+			}
+			if _, ok := controllerMethods[fn.Name.Name]; ok {
+				continue
+			}
+
+			action, err := parseAction(fn, result, imports)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s.%s: %s", fset.Position(fn.Pos()), spec.Name, fn.Name.Name, err)
+			}
+			spec.Actions = append(spec.Actions, action)
+		}
+	}
+
+	return result, nil
+}
+
+// GenerateRouter parses the controllers in controllerDir, and writes the router file output,
+// which declares RouterMap for apix.Run, and registers the @router annotated actions in init.
+// The controllers with annotations are only routed by their annotations,
+// others are put into RouterMap under the prefix like /User/ for UserController.
+func GenerateRouter(controllerDir, output string) error {
+	pkg, err := ParseControllers(controllerDir)
+	if err != nil {
+		return err
+	}
+
+	absOutput, err := filepath.Abs(output)
+	if err != nil {
+		return err
+	}
+
+	if len(pkg.Controllers) == 0 {
+		return fmt.Errorf("no controllers found in %s", controllerDir)
+	}
+
+	alias := pkg.Name
+	pkgName := packageName(filepath.Dir(absOutput))
+	if alias == pkgName {
+		alias = "ctrl" + alias
+	}
+	aliases := map[string]string{
+		apixImportPath: path.Base(apixImportPath),
+		pkg.ImportPath: alias,
+	}
+
+	var autos []routerAuto
+	var routes []routerRoute
+	var docs []routerDoc
+	var imports []routerImport
+	for _, c := range pkg.Controllers {
+		for _, action := range c.Actions {
+			if !action.Documented() {
+				continue
+			}
+
+			for _, ref := range []*TypeRef{action.Params, action.Body, action.Response} {
+				if ref == nil {
+					continue
+				}
+				for _, importPath := range ref.Imports {
+					if _, ok := aliases[importPath]; !ok {
+						imp := routerImport{
+							Alias: uniqueAlias(path.Base(importPath), aliases),
+							Path:  importPath,
+						}
+						imp.Named = imp.Alias != path.Base(importPath)
+						aliases[importPath] = imp.Alias
+						imports = append(imports, imp)
+					}
+				}
+			}
+
+			literal, err := actionDocLiteral(action, aliases)
+			if err != nil {
+				return fmt.Errorf("%s.%s: %s", c.Name, action.Name, err)
+			}
+			docs = append(docs, routerDoc{
+				Controller: c.Name,
+				Action:     action.Name,
+				Literal:    literal,
+			})
+		}
+
+		if !c.Annotated() {
+			autos = append(autos, routerAuto{
+				Prefix: c.Prefix(),
+				Name:   c.Name,
+			})
+			continue
+		}
+
+		for _, action := range c.Actions {
+			for _, route := range action.Routes {
+				routes = append(routes, routerRoute{
+					Pattern:    route.Pattern,
+					Controller: c.Name,
+					Mapping:    route.Mapping(action.Name),
+				})
+			}
+		}
+	}
+
+	return writeSource(absOutput, routerTemplate, map[string]interface{}{
+		"Header":     generatedCodeHeader,
+		"Package":    pkgName,
+		"Alias":      alias,
+		"Name":       pkg.Name,
+		"ImportPath": pkg.ImportPath,
+		"Auto":       autos,
+		"Routes":     routes,
+		"Docs":       docs,
+		"Imports":    imports,
+	}, true)
+}
+
+// actionDocLiteral returns the apix.ActionDoc literal of action, the summary is the first line of the doc.
+func actionDocLiteral(action *ActionSpec, aliases map[string]string) (string, error) {
+	var buf strings.Builder
+	buf.WriteString("apix.ActionDoc{")
+	summary := action.Doc
+	var description string
+	if i := strings.IndexByte(summary, '\n'); i >= 0 {
+		description = strings.TrimSpace(summary[i+1:])
+		summary = summary[:i]
+	}
+	if len(summary) > 0 {
+		fmt.Fprintf(&buf, "Summary: %q,", summary)
+	}
+	if len(description) > 0 {
+		fmt.Fprintf(&buf, "Description: %q,", description)
+	}
+	if len(action.Tags) > 0 {
+		fmt.Fprintf(&buf, "Tags: %#v,", action.Tags)
+	}
+	if action.Deprecated {
+		buf.WriteString("Deprecated: true,")
+	}
+
+	for _, field := range []struct {
+		name string
+		ref  *TypeRef
+	}{
+		{"Params", action.Params},
+		{"Body", action.Body},
+		{"Response", action.Response},
+	} {
+		if field.ref == nil {
+			continue
+		}
+
+		expr, err := requalifyType(field.ref, aliases)
+		if err != nil {
+			return "", err
+		}
+		// a typed nil pointer is enough for apix to reflect the type
+		fmt.Fprintf(&buf, "%s: (*%s)(nil),", field.name, expr)
+	}
+	buf.WriteByte('}')
+
+	return buf.String(), nil
+}
+
+func uniqueAlias(name string, aliases map[string]string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+
+	taken := make(map[string]bool, len(aliases))
+	for _, alias := range aliases {
+		taken[alias] = true
+	}
+	alias := name
+	for i := 2; taken[alias]; i++ {
+		alias = name + strconv.Itoa(i)
+	}
+
+	return alias
+}
+
+// GenerateOpenAPI writes the OpenAPI document of the router package in routerDir, generated by GenerateRouter,
+// into output. The document is built by a temporary program which imports the router package,
+// so the annotated types are reflected like the /swagger.json endpoint does.
+// The program is written into a temporary directory out of the module, and overlaid into the module
+// by go run -overlay, which requires go 1.16 or later.
+func GenerateOpenAPI(routerDir, output string, info openapi.Info) error {
+	importPath, err := resolveImportPath(routerDir)
+	if err != nil {
+		return err
+	}
+
+	absRouterDir, err := filepath.Abs(routerDir)
+	if err != nil {
+		return err
+	}
+	root, _, err := findModule(absRouterDir)
+	if err != nil {
+		return err
+	}
+
+	tmpDir, err := ioutil.TempDir("", "apigen")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mainFile := filepath.Join(tmpDir, "main.go")
+	if err := writeSource(mainFile, openAPIMainTemplate, map[string]interface{}{
+		"ImportPath": importPath,
+		"Info":       fmt.Sprintf("%#v", info),
+	}, false); err != nil {
+		return err
+	}
+
+	// the main file is resolved in the module to import the router package, but never written there
+	overlaidMain := filepath.Join(root, overlayDir, "main.go")
+	overlay, err := json.Marshal(map[string]map[string]string{
+		"Replace": {overlaidMain: mainFile},
+	})
+	if err != nil {
+		return err
+	}
+	overlayFile := filepath.Join(tmpDir, "overlay.json")
+	if err := ioutil.WriteFile(overlayFile, overlay, 0644); err != nil {
+		return err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("go", "run", "-overlay", overlayFile, overlaidMain)
+	cmd.Dir = root
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %s", err, stderr.String())
+	}
+
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(output, stdout.Bytes(), 0644)
+}
+
+// ScaffoldController writes a controller named name like User into controllerDir,
+// with the CRUD actions routed by @router annotations,
+// and the model accessing the table of the lower case name into modelDir.
+// The existing files are never overwritten.
+func ScaffoldController(name, controllerDir, modelDir string) error {
+	if !identifierRegex.MatchString(name) {
+		return fmt.Errorf("%q is not a valid controller name", name)
+	}
+
+	name = strings.TrimSuffix(upperFirst(name), controllerTypeName)
+	modelImport, err := resolveImportPath(modelDir)
+	if err != nil {
+		return err
+	}
+
+	data := scaffoldData{
+		Package:      packageName(controllerDir),
+		Name:         name,
+		Resource:     lowerFirst(name),
+		Table:        toSnakeCase(name),
+		ModelPackage: packageName(modelDir),
+		ModelImport:  modelImport,
+	}
+	controllerFile := filepath.Join(controllerDir, name+controllerTypeName+".go")
+	modelFile := filepath.Join(modelDir, strings.ToLower(name)+"model.go")
+	for _, file := range []string{controllerFile, modelFile} {
+		if isExist(file) {
+			return fmt.Errorf("%s already exists", file)
+		}
+	}
+
+	if err := writeSource(modelFile, modelTemplate, data, false); err != nil {
+		return err
+	}
+
+	return writeSource(controllerFile, controllerTemplate, data, false)
+}
+
+// findControllers returns the struct types embedding apix.Controller, or embedding such types.
+func findControllers(pkg *ast.Package, fileNames []string, types map[string]*ast.TypeSpec) map[string]bool {
+	controllers := make(map[string]bool)
+	if pkg.Name == "apix" {
+		controllers[controllerTypeName] = true
+	}
+
+	apixNames := make(map[*ast.StructType]map[string]bool)
+	for _, name := range fileNames {
+		file := pkg.Files[name]
+		names := apixImportNames(file)
+		ast.Inspect(file, func(n ast.Node) bool {
+			if st, ok := n.(*ast.StructType); ok {
+				apixNames[st] = names
+			}
+			return true
+		})
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for name, ts := range types {
+			if controllers[name] {
+				continue
+			}
+
+			st := ts.Type.(*ast.StructType)
+			for _, field := range st.Fields.List {
+				if len(field.Names) > 0 {
+					continue
+				}
+
+				var embedded bool
+				switch t := derefExpr(field.Type).(type) {
+				case *ast.Ident:
+					embedded = controllers[t.Name]
+				case *ast.SelectorExpr:
+					if x, ok := t.X.(*ast.Ident); ok {
+						embedded = apixNames[st][x.Name] && t.Sel.Name == controllerTypeName
+					}
+				}
+				if embedded {
+					controllers[name] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	if pkg.Name == "apix" {
+		delete(controllers, controllerTypeName)
+	}
+
+	return controllers
+}
+
+func apixImportNames(file *ast.File) map[string]bool {
+	names := make(map[string]bool)
+	for _, imp := range file.Imports {
+		if strings.Trim(imp.Path.Value, `"`) != apixImportPath {
+			continue
+		}
+
+		if imp.Name != nil {
+			names[imp.Name.Name] = true
+		} else {
+			names[path.Base(apixImportPath)] = true
+		}
+	}
+
+	return names
+}
+
+func parseAction(fn *ast.FuncDecl, pkg *ControllerPackage, imports map[string]string) (*ActionSpec, error) {
+	action := &ActionSpec{
+		Name: fn.Name.Name,
+	}
+	if fn.Doc == nil {
+		return action, nil
+	}
+
+	var doc []string
+	for _, line := range strings.Split(fn.Doc.Text(), "\n") {
+		line = strings.TrimSpace(line)
+		fields := strings.Fields(line)
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], "@") {
+			doc = append(doc, line)
+			continue
+		}
+
+		var err error
+		switch fields[0] {
+		case routerAnnotation:
+			var route *RouteSpec
+			if route, err = parseRouterAnnotation(line); err == nil {
+				action.Routes = append(action.Routes, route)
+			}
+		case paramsAnnotation:
+			action.Params, err = parseTypeAnnotation(fields, pkg, imports)
+		case bodyAnnotation:
+			action.Body, err = parseTypeAnnotation(fields, pkg, imports)
+		case successAnnotation:
+			action.Response, err = parseTypeAnnotation(fields, pkg, imports)
+		case tagsAnnotation:
+			for _, tag := range strings.Split(strings.Join(fields[1:], ""), ",") {
+				if len(tag) > 0 {
+					action.Tags = append(action.Tags, tag)
+				}
+			}
+		case deprecatedMark:
+			action.Deprecated = true
+		default:
+			doc = append(doc, line)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	action.Doc = strings.TrimSpace(strings.Join(doc, "\n"))
+
+	return action, nil
+}
+
+// Documented tells whether the action has a doc comment or doc annotations.
+func (a *ActionSpec) Documented() bool {
+	return len(a.Doc) > 0 || a.Params != nil || a.Body != nil || a.Response != nil ||
+		len(a.Tags) > 0 || a.Deprecated
+}
+
+// parseTypeAnnotation parses the type of the annotation like @body models.User,
+// the rest of the line after the type is taken as comment.
+func parseTypeAnnotation(fields []string, pkg *ControllerPackage, imports map[string]string) (*TypeRef, error) {
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("%s requires a type", fields[0])
+	}
+
+	expr, err := parser.ParseExpr(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("wrong type %q of %s: %s", fields[1], fields[0], err)
+	}
+
+	ref := &TypeRef{
+		Imports: make(map[string]string),
+	}
+	expr, err = qualifyType(expr, pkg, imports, ref.Imports)
+	if err != nil {
+		return nil, fmt.Errorf("wrong type %q of %s: %s", fields[1], fields[0], err)
+	}
+
+	var buf bytes.Buffer
+	if err := format.Node(&buf, token.NewFileSet(), expr); err != nil {
+		return nil, err
+	}
+	ref.Expr = buf.String()
+
+	return ref, nil
+}
+
+// qualifyType qualifies the exported types of the controller package with its name,
+// and collects the import paths of the qualified types into used.
+func qualifyType(expr ast.Expr, pkg *ControllerPackage, imports, used map[string]string) (ast.Expr, error) {
+	var err error
+	switch t := expr.(type) {
+	case *ast.Ident:
+		if !t.IsExported() {
+			if types.Universe.Lookup(t.Name) == nil {
+				return nil, fmt.Errorf("unexported type %s", t.Name)
+			}
+			return t, nil
+		}
+		used[pkg.Name] = pkg.ImportPath
+		return &ast.SelectorExpr{X: ast.NewIdent(pkg.Name), Sel: t}, nil
+	case *ast.SelectorExpr:
+		x, ok := t.X.(*ast.Ident)
+		if !ok {
+			return nil, fmt.Errorf("unsupported type %T", t.X)
+		}
+		importPath, ok := imports[x.Name]
+		if !ok {
+			return nil, fmt.Errorf("package %s is not imported", x.Name)
+		}
+		used[x.Name] = importPath
+		return t, nil
+	case *ast.StarExpr:
+		t.X, err = qualifyType(t.X, pkg, imports, used)
+		return t, err
+	case *ast.ArrayType:
+		t.Elt, err = qualifyType(t.Elt, pkg, imports, used)
+		return t, err
+	case *ast.MapType:
+		if t.Key, err = qualifyType(t.Key, pkg, imports, used); err != nil {
+			return nil, err
+		}
+		t.Value, err = qualifyType(t.Value, pkg, imports, used)
+		return t, err
+	default:
+		return nil, fmt.Errorf("unsupported type %T", expr)
+	}
+}
+
+// requalifyType renames the package qualifiers of ref by the import paths with aliases.
+func requalifyType(ref *TypeRef, aliases map[string]string) (string, error) {
+	expr, err := parser.ParseExpr(ref.Expr)
+	if err != nil {
+		return "", err
+	}
+
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if x, ok := sel.X.(*ast.Ident); ok {
+				x.Name = aliases[ref.Imports[x.Name]]
+			}
+			return false
+		}
+		return true
+	})
+
+	var buf bytes.Buffer
+	if err := format.Node(&buf, token.NewFileSet(), expr); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+func fileImports(file *ast.File) map[string]string {
+	imports := make(map[string]string)
+	for _, imp := range file.Imports {
+		importPath := strings.Trim(imp.Path.Value, `"`)
+		name := path.Base(importPath)
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		if name != "_" && name != "." {
+			imports[name] = importPath
+		}
+	}
+
+	return imports
+}
+
+// parseRouterAnnotation parses the annotation like @router /users/:id [get,post].
+func parseRouterAnnotation(line string) (*RouteSpec, error) {
+	matches := routerAnnotationRegex.FindStringSubmatch(line)
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("wrong annotation %q, should be like @router /users/:id [get]", line)
+	}
+
+	route := &RouteSpec{
+		Pattern: matches[1],
+	}
+	if route.Pattern[0] != '/' {
+		return nil, fmt.Errorf("pattern %q must begin with '/'", route.Pattern)
+	}
+
+	for _, method := range strings.Split(matches[2], ",") {
+		method = strings.ToLower(strings.TrimSpace(method))
+		switch {
+		case len(method) == 0:
+			continue
+		case method == "*":
+			route.Methods = nil
+			return route, nil
+		case !apix.HTTPMETHOD[strings.ToUpper(method)]:
+			return nil, fmt.Errorf("%s is not a valid http method in %q", method, line)
+		}
+		route.Methods = append(route.Methods, method)
+	}
+
+	return route, nil
+}
+
+// resolveImportPath returns the import path of dir by the module path in the nearest go.mod.
+func resolveImportPath(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	root, modulePath, err := findModule(abs)
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(root, abs)
+	if err != nil {
+		return "", err
+	}
+	if rel == "." {
+		return modulePath, nil
+	}
+
+	return path.Join(modulePath, filepath.ToSlash(rel)), nil
+}
+
+// findModule returns the root directory and the module path of the nearest go.mod of dir.
+func findModule(dir string) (string, string, error) {
+	for root := dir; ; {
+		if modulePath, ok := readModulePath(filepath.Join(root, "go.mod")); ok {
+			return root, modulePath, nil
+		}
+
+		parent := filepath.Dir(root)
+		if parent == root {
+			return "", "", fmt.Errorf("no go.mod found for %s", dir)
+		}
+		root = parent
+	}
+}
+
+func readModulePath(file string) (string, bool) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`), true
+		}
+	}
+
+	return "", false
+}
+
+func writeSource(file string, tpl *template.Template, data interface{}, overwrite bool) error {
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, data); err != nil {
+		return err
+	}
+
+	content, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("format %s: %s", file, err)
+	}
+
+	if !overwrite && isExist(file) {
+		return fmt.Errorf("%s already exists", file)
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(file, content, 0644)
+}
+
+// packageName returns the package name of dir, by its go files if any, or by its base name.
+func packageName(dir string) string {
+	pkgs, err := parser.ParseDir(token.NewFileSet(), dir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, parser.PackageClauseOnly)
+	if err == nil {
+		for name := range pkgs {
+			return name
+		}
+	}
+
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		abs = dir
+	}
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, filepath.Base(abs))
+	if len(name) == 0 || unicode.IsDigit(rune(name[0])) {
+		name = "_" + name
+	}
+
+	return name
+}
+
+func receiverName(expr ast.Expr) string {
+	if ident, ok := derefExpr(expr).(*ast.Ident); ok {
+		return ident.Name
+	}
+
+	return ""
+}
+
+func derefExpr(expr ast.Expr) ast.Expr {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		return star.X
+	}
+
+	return expr
+}
+
+func methodNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool, t.NumMethod())
+	for i := 0; i < t.NumMethod(); i++ {
+		names[t.Method(i).Name] = true
+	}
+
+	return names
+}
+
+func upperFirst(s string) string {
+	if len(s) == 0 {
+		return s
+	}
+
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+func lowerFirst(s string) string {
+	if len(s) == 0 {
+		return s
+	}
+
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+func toSnakeCase(s string) string {
+	var buf strings.Builder
+	for i, r := range s {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				buf.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		buf.WriteRune(r)
+	}
+
+	return buf.String()
+}
+
+// isExist tells whether the file exists.
+func isExist(filename string) bool {
+	_, err := os.Stat(filename)
+	return !os.IsNotExist(err)
+}
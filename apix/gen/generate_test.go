@@ -0,0 +1,136 @@
+package gen
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testControllerSource = `package controllers
+
+import web "github.com/weblazy/core/apix"
+
+// UserController serves users.
+type UserController struct {
+	web.Controller
+}
+
+type AdminController struct {
+	UserController
+}
+
+type helper struct{}
+
+// Show shows a user.
+// @router /users/:id [get,head]
+// @router /members/:id
+// @success []*UserController
+// @tags users
+func (c *UserController) Show() {}
+
+func (c *UserController) Prepare() {}
+
+func (c *UserController) hidden() {}
+
+func (c *AdminController) Index() {}
+`
+
+func TestParseRouterAnnotation(t *testing.T) {
+	route, err := parseRouterAnnotation("@router /users/:id [get, POST]")
+	assert.Nil(t, err)
+	assert.Equal(t, "/users/:id", route.Pattern)
+	assert.Equal(t, "get,post:Show", route.Mapping("Show"))
+
+	route, err = parseRouterAnnotation("@router /users [*]")
+	assert.Nil(t, err)
+	assert.Equal(t, "*:List", route.Mapping("List"))
+
+	_, err = parseRouterAnnotation("@router /users [fetch]")
+	assert.NotNil(t, err)
+	_, err = parseRouterAnnotation("@router users [get]")
+	assert.NotNil(t, err)
+	_, err = parseRouterAnnotation("@router")
+	assert.NotNil(t, err)
+}
+
+func TestParseControllers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apix")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/app\n"), 0644))
+	controllerDir := filepath.Join(dir, "controllers")
+	assert.Nil(t, os.Mkdir(controllerDir, 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(controllerDir, "user.go"), []byte(testControllerSource), 0644))
+
+	pkg, err := ParseControllers(controllerDir)
+	assert.Nil(t, err)
+	assert.Equal(t, "controllers", pkg.Name)
+	assert.Equal(t, "example.com/app/controllers", pkg.ImportPath)
+	assert.Equal(t, 2, len(pkg.Controllers))
+
+	user := pkg.Controllers[0]
+	assert.Equal(t, "UserController", user.Name)
+	assert.Equal(t, "UserController serves users.", user.Doc)
+	assert.Equal(t, "/User/", user.Prefix())
+	assert.True(t, user.Annotated())
+	assert.Equal(t, 1, len(user.Actions))
+	assert.Equal(t, "Show shows a user.", user.Actions[0].Doc)
+	assert.Equal(t, 2, len(user.Actions[0].Routes))
+	assert.Equal(t, "get,head:Show", user.Actions[0].Routes[0].Mapping("Show"))
+	assert.Equal(t, "*:Show", user.Actions[0].Routes[1].Mapping("Show"))
+	assert.Equal(t, "[]*controllers.UserController", user.Actions[0].Response.Expr)
+	assert.Equal(t, []string{"users"}, user.Actions[0].Tags)
+
+	admin := pkg.Controllers[1]
+	assert.Equal(t, "AdminController", admin.Name)
+	assert.False(t, admin.Annotated())
+
+	output := filepath.Join(dir, "routers", "router.go")
+	assert.Nil(t, GenerateRouter(controllerDir, output))
+	content, err := ioutil.ReadFile(output)
+	assert.Nil(t, err)
+	assert.Contains(t, string(content), `"/Admin/": &controllers.AdminController{},`)
+	assert.Contains(t, string(content), `apix.Router("/users/:id", &controllers.UserController{}, "get,head:Show")`)
+	assert.Contains(t, string(content), `Response: (*[]*controllers.UserController)(nil)`)
+}
+
+func TestScaffoldController(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apix")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/app\n"), 0644))
+	controllerDir := filepath.Join(dir, "controllers")
+	modelDir := filepath.Join(dir, "models")
+	assert.NotNil(t, ScaffoldController("user-info", controllerDir, modelDir))
+	assert.Nil(t, ScaffoldController("userInfoController", controllerDir, modelDir))
+
+	content, err := ioutil.ReadFile(filepath.Join(modelDir, "userinfomodel.go"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(content), "package models")
+	assert.Contains(t, string(content), "func NewUserInfoModel(conn sqlx.SqlConn) *UserInfoModel {")
+	assert.Contains(t, string(content), "user_info")
+
+	content, err = ioutil.ReadFile(filepath.Join(controllerDir, "UserInfoController.go"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(content), `"example.com/app/models"`)
+	assert.Contains(t, string(content), "var UserInfoModel *models.UserInfoModel")
+
+	pkg, err := ParseControllers(controllerDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pkg.Controllers))
+	assert.Equal(t, "UserInfoController", pkg.Controllers[0].Name)
+	assert.True(t, pkg.Controllers[0].Annotated())
+	var actions []string
+	for _, action := range pkg.Controllers[0].Actions {
+		actions = append(actions, action.Name)
+	}
+	assert.ElementsMatch(t, []string{"List", "Show", "Create", "Update", "Delete"}, actions)
+
+	// the existing files are never overwritten
+	assert.NotNil(t, ScaffoldController("UserInfo", controllerDir, modelDir))
+}
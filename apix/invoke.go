@@ -0,0 +1,144 @@
+package apix
+
+import (
+	"context"
+	"reflect"
+	"sync"
+)
+
+var reusableType = reflect.TypeOf((*reusableController)(nil)).Elem()
+
+type (
+	// Reusable is embedded by the controllers to reuse their instances across the requests,
+	// which saves the allocations of the busy routes. The instances are zeroed after the action returns,
+	// so they must not be referenced afterwards, e.g. by the goroutines started by the actions.
+	//	type UserController struct {
+	//		apix.Controller
+	//		apix.Reusable
+	//	}
+	Reusable struct{}
+
+	reusableController interface {
+		reusable()
+	}
+
+	// actionFunc is an action bound to its controller.
+	actionFunc func(ctx context.Context) (interface{}, error)
+
+	// controllerPool creates the instances of a controller type, and reuses them if the controller is Reusable,
+	// the actions of the reused instances are bound once, so that serving a request needs no reflection.
+	controllerPool struct {
+		controllerType reflect.Type
+		zero           reflect.Value
+		numMethod      int
+		reuse          bool
+		pool           sync.Pool
+	}
+
+	controllerInstance struct {
+		value      reflect.Value
+		controller ControllerInterface
+		// the bound actions of the reused instances, nil for the new ones
+		actions []actionFunc
+	}
+)
+
+// controllerPool returns the pool of controllerType, shared by all the routes of the type.
+func (p *ControllerRegister) controllerPool(controllerType reflect.Type) *controllerPool {
+	if pool, ok := p.pools[controllerType]; ok {
+		return pool
+	}
+
+	pool := &controllerPool{
+		controllerType: controllerType,
+		zero:           reflect.Zero(controllerType),
+		numMethod:      reflect.PtrTo(controllerType).NumMethod(),
+		reuse:          reflect.PtrTo(controllerType).Implements(reusableType),
+	}
+	pool.pool.New = func() interface{} {
+		value := reflect.New(controllerType)
+		return &controllerInstance{
+			value:      value,
+			controller: value.Interface().(ControllerInterface),
+			actions:    make([]actionFunc, pool.numMethod),
+		}
+	}
+	p.pools[controllerType] = pool
+
+	return pool
+}
+
+// get returns a zeroed controller instance, just like reflect.New does.
+func (cp *controllerPool) get() *controllerInstance {
+	if !cp.reuse {
+		value := reflect.New(cp.controllerType)
+		return &controllerInstance{
+			value:      value,
+			controller: value.Interface().(ControllerInterface),
+		}
+	}
+
+	return cp.pool.Get().(*controllerInstance)
+}
+
+// put resets instance and puts it back for the next request if the controller is Reusable,
+// the fields are zeroed in place, so the bound actions are still valid.
+func (cp *controllerPool) put(instance *controllerInstance) {
+	if !cp.reuse {
+		return
+	}
+
+	instance.value.Elem().Set(cp.zero)
+	cp.pool.Put(instance)
+}
+
+func (Reusable) reusable() {}
+
+// call calls the action method on the instance, the actions of the reused instances are bound on the first call.
+func (ci *controllerInstance) call(method reflect.Method, ctx context.Context) (interface{}, error) {
+	if ci.actions == nil {
+		return callMethod(method, ci.value, ctx)
+	}
+
+	fn := ci.actions[method.Index]
+	if fn == nil {
+		fn = bindAction(ci.value.Method(method.Index))
+		ci.actions[method.Index] = fn
+	}
+	return fn(ctx)
+}
+
+// bindAction returns the actionFunc calling the bound method directly for the common signatures,
+// the actions returning typed results are called with reflection.
+func bindAction(method reflect.Value) actionFunc {
+	switch fn := method.Interface().(type) {
+	case func():
+		return func(context.Context) (interface{}, error) {
+			fn()
+			return nil, nil
+		}
+	case func() error:
+		return func(context.Context) (interface{}, error) {
+			return nil, fn()
+		}
+	case func(context.Context):
+		return func(ctx context.Context) (interface{}, error) {
+			fn(ctx)
+			return nil, nil
+		}
+	case func(context.Context) error:
+		return func(ctx context.Context) (interface{}, error) {
+			return nil, fn(ctx)
+		}
+	case func() (interface{}, error):
+		return func(context.Context) (interface{}, error) {
+			return fn()
+		}
+	case func(context.Context) (interface{}, error):
+		return fn
+	default:
+		return func(ctx context.Context) (interface{}, error) {
+			return callAction(method, ctx)
+		}
+	}
+}
@@ -0,0 +1,510 @@
+package apix
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/weblazy/core/apix/openapi"
+	"github.com/weblazy/core/logx"
+	"github.com/weblazy/core/mapping"
+	"github.com/weblazy/core/stringx"
+)
+
+const (
+	openAPIVersion      = "3.0.3"
+	defaultDocsPath     = "/swagger.json"
+	defaultDocsVersion  = "1.0.0"
+	unnamedWildcard     = "wildcard"
+	applicationFormData = "application/x-www-form-urlencoded"
+	schemaRefPrefix     = "#/components/schemas/"
+	controllerSuffix    = "Controller"
+)
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	// the http methods that an openapi path item can describe
+	openAPIMethods = []string{
+		http.MethodGet,
+		http.MethodPut,
+		http.MethodPost,
+		http.MethodDelete,
+		http.MethodOptions,
+		http.MethodHead,
+		http.MethodPatch,
+		http.MethodTrace,
+	}
+)
+
+type (
+	// ActionDoc documents an action of a controller.
+	// Params is a struct or struct pointer parsed by ParseForm, it's documented as the query parameters
+	// of GET, HEAD and DELETE requests, and the form body of others.
+	// Body is a struct or struct pointer parsed by ParseJSON, Response is the json response,
+	// which defaults to the result type of the action like func() (*User, error).
+	ActionDoc struct {
+		Summary     string
+		Description string
+		Tags        []string
+		Deprecated  bool
+		Params      interface{}
+		Body        interface{}
+		Response    interface{}
+	}
+
+	schemaBuilder struct {
+		schemas map[string]*openapi.Schema
+		names   map[reflect.Type]string
+	}
+
+	docRoute struct {
+		method  string
+		pattern string
+		info    *ControllerInfo
+	}
+)
+
+// Doc documents the action of controller c on the default ControllerRegister.
+func Doc(c ControllerInterface, action string, doc ActionDoc) {
+	if err := defaultRegister.AddDoc(c, action, doc); err != nil {
+		logx.Fatal(err)
+	}
+}
+
+// WriteOpenAPI writes the OpenAPI document of the default ControllerRegister to w.
+func WriteOpenAPI(w io.Writer, info openapi.Info) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(defaultRegister.OpenAPI(info))
+}
+
+// AddDoc documents the action of controller c, the document is used by OpenAPI.
+func (p *ControllerRegister) AddDoc(c ControllerInterface, action string, doc ActionDoc) error {
+	controllerType := reflect.Indirect(reflect.ValueOf(c)).Type()
+	if !controllerMethods(c)[action] {
+		return fmt.Errorf("%s has no action named %s", controllerType.Name(), action)
+	}
+
+	if p.docs == nil {
+		p.docs = make(map[reflect.Type]map[string]*ActionDoc)
+	}
+	if p.docs[controllerType] == nil {
+		p.docs[controllerType] = make(map[string]*ActionDoc)
+	}
+	p.docs[controllerType][action] = &doc
+	return nil
+}
+
+// OpenAPI returns the OpenAPI 3 document of the registered routes.
+// The schemas are generated from the form and json tags of the documented Params, Body and Response,
+// the fields with default, optional, options and range options are documented like mapping validates them.
+// An action routed on every http method, like the ones of AddAuto, is documented as GET,
+// or POST if its document has Params or Body.
+func (p *ControllerRegister) OpenAPI(info openapi.Info) *openapi.Document {
+	if len(info.Version) == 0 {
+		info.Version = defaultDocsVersion
+	}
+
+	builder := &schemaBuilder{
+		schemas: make(map[string]*openapi.Schema),
+		names:   make(map[reflect.Type]string),
+	}
+	doc := &openapi.Document{
+		OpenAPI: openAPIVersion,
+		Info:    info,
+		Paths:   make(map[string]openapi.PathItem),
+	}
+
+	operationIDs := make(map[string]int)
+	for _, route := range p.docRoutes() {
+		actionDoc := p.docs[route.info.controllerType][route.info.methodName]
+		if actionDoc == nil {
+			actionDoc = new(ActionDoc)
+		}
+
+		openAPIPath, params := toOpenAPIPath(route.pattern)
+		item, ok := doc.Paths[openAPIPath]
+		if !ok {
+			item = make(openapi.PathItem)
+			doc.Paths[openAPIPath] = item
+		}
+
+		controllerName := route.info.controllerType.Name()
+		operationID := lowerFirst(controllerName) + route.info.methodName
+		if n := operationIDs[operationID]; n > 0 {
+			operationIDs[operationID]++
+			operationID += strconv.Itoa(n + 1)
+		} else {
+			operationIDs[operationID] = 1
+		}
+
+		operation := &openapi.Operation{
+			OperationID: operationID,
+			Summary:     actionDoc.Summary,
+			Description: actionDoc.Description,
+			Tags:        actionDoc.Tags,
+			Deprecated:  actionDoc.Deprecated,
+			Responses: map[string]*openapi.Response{
+				strconv.Itoa(http.StatusOK): {
+					Description: http.StatusText(http.StatusOK),
+				},
+			},
+		}
+		if len(operation.Tags) == 0 {
+			operation.Tags = []string{strings.TrimSuffix(controllerName, controllerSuffix)}
+		}
+		for _, name := range params {
+			operation.Parameters = append(operation.Parameters, &openapi.Parameter{
+				Name:     name,
+				In:       "path",
+				Required: true,
+				Schema:   &openapi.Schema{Type: "string"},
+			})
+		}
+		builder.addParams(operation, route.method, actionDoc.Params)
+		if actionDoc.Body != nil {
+			operation.RequestBody = &openapi.RequestBody{
+				Required: true,
+				Content: map[string]*openapi.MediaType{
+					applicationJSON: {Schema: builder.schemaOf(reflect.TypeOf(actionDoc.Body), jsonTag)},
+				},
+			}
+		}
+		responseType := reflect.TypeOf(actionDoc.Response)
+		if responseType == nil {
+			// the result type of actions like func() (*User, error)
+			if method, ok := reflect.PtrTo(route.info.controllerType).MethodByName(route.info.methodName); ok {
+				if resultType := actionResultType(method.Type); resultType != nil && resultType.Kind() != reflect.Interface {
+					responseType = resultType
+				}
+			}
+		}
+		if responseType != nil {
+			operation.Responses[strconv.Itoa(http.StatusOK)].Content = map[string]*openapi.MediaType{
+				applicationJSON: {Schema: builder.schemaOf(responseType, jsonTag)},
+			}
+		}
+
+		item[strings.ToLower(route.method)] = operation
+	}
+
+	if len(builder.schemas) > 0 {
+		doc.Components = &openapi.Components{
+			Schemas: builder.schemas,
+		}
+	}
+
+	return doc
+}
+
+// DocsFilter returns a BeforeRouter filter that serves the OpenAPI document of p as json,
+// the document is generated on the first request.
+func DocsFilter(p *ControllerRegister, info openapi.Info) FilterFunc {
+	var once sync.Once
+	var content []byte
+	var err error
+
+	return func(ctx *Context) {
+		if ctx.R.Method != http.MethodGet && ctx.R.Method != http.MethodHead {
+			return
+		}
+
+		once.Do(func() {
+			content, err = json.Marshal(p.OpenAPI(info))
+		})
+		if err != nil {
+			logx.Error(err)
+			ctx.Abort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+
+		ctx.W.Header().Set("Content-Type", applicationJSON+charsetUTF8)
+		ctx.W.Write(content)
+	}
+}
+
+// docRoutes returns the routes to document, sorted by pattern and method.
+func (p *ControllerRegister) docRoutes() []docRoute {
+	type routeKey struct {
+		pattern        string
+		controllerType reflect.Type
+		methodName     string
+	}
+
+	methods := make(map[routeKey][]string)
+	infos := make(map[routeKey]*ControllerInfo)
+	var keys []routeKey
+	for method, tree := range p.routers {
+		tree.Walk(func(pattern string, runObject interface{}) {
+			info := runObject.(*ControllerInfo)
+			key := routeKey{
+				pattern:        pattern,
+				controllerType: info.controllerType,
+				methodName:     info.methodName,
+			}
+			if _, ok := methods[key]; !ok {
+				keys = append(keys, key)
+				infos[key] = info
+			}
+			methods[key] = append(methods[key], method)
+		})
+	}
+
+	var routes []docRoute
+	for _, key := range keys {
+		info := infos[key]
+		verbs := methods[key]
+		if len(verbs) == len(HTTPMETHOD) {
+			verbs = []string{http.MethodGet}
+			if doc := p.docs[info.controllerType][info.methodName]; doc != nil && (doc.Params != nil || doc.Body != nil) {
+				verbs = []string{http.MethodPost}
+			}
+		}
+
+		for _, method := range openAPIMethods {
+			for _, verb := range verbs {
+				if verb == method {
+					routes = append(routes, docRoute{
+						method:  method,
+						pattern: key.pattern,
+						info:    info,
+					})
+				}
+			}
+		}
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].pattern != routes[j].pattern {
+			return routes[i].pattern < routes[j].pattern
+		}
+		if routes[i].method != routes[j].method {
+			return routes[i].method < routes[j].method
+		}
+		return routes[i].info.methodName < routes[j].info.methodName
+	})
+
+	return routes
+}
+
+func (b *schemaBuilder) addParams(operation *openapi.Operation, method string, params interface{}) {
+	if params == nil {
+		return
+	}
+
+	schema := b.objectSchema(reflect.TypeOf(params), formTag)
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodDelete:
+		names := make([]string, 0, len(schema.Properties))
+		for name := range schema.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			operation.Parameters = append(operation.Parameters, &openapi.Parameter{
+				Name:     name,
+				In:       "query",
+				Required: stringx.Contains(schema.Required, name),
+				Schema:   schema.Properties[name],
+			})
+		}
+	default:
+		operation.RequestBody = &openapi.RequestBody{
+			Required: len(schema.Required) > 0,
+			Content: map[string]*openapi.MediaType{
+				applicationFormData: {Schema: schema},
+			},
+		}
+	}
+}
+
+// schemaOf returns the schema of t, named structs are put into the components and referenced.
+func (b *schemaBuilder) schemaOf(t reflect.Type, tagName string) *openapi.Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &openapi.Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &openapi.Schema{Type: "integer", Format: "int64"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &openapi.Schema{Type: "integer", Format: "int32"}
+	case reflect.Float32:
+		return &openapi.Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &openapi.Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &openapi.Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &openapi.Schema{Type: "string", Format: "byte"}
+		}
+		return &openapi.Schema{Type: "array", Items: b.schemaOf(t.Elem(), tagName)}
+	case reflect.Map:
+		return &openapi.Schema{Type: "object", AdditionalProperties: b.schemaOf(t.Elem(), tagName)}
+	case reflect.Struct:
+		if t == timeType {
+			return &openapi.Schema{Type: "string", Format: "date-time"}
+		}
+		if len(t.Name()) == 0 || tagName != jsonTag {
+			return b.objectSchema(t, tagName)
+		}
+
+		name, ok := b.names[t]
+		if !ok {
+			name = b.componentName(t)
+			b.names[t] = name
+			// registered before building the properties, so recursive types end up with a reference
+			b.schemas[name] = new(openapi.Schema)
+			*b.schemas[name] = *b.objectSchema(t, tagName)
+		}
+		return &openapi.Schema{Ref: schemaRefPrefix + name}
+	default:
+		return new(openapi.Schema)
+	}
+}
+
+func (b *schemaBuilder) objectSchema(t reflect.Type, tagName string) *openapi.Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	schema := &openapi.Schema{
+		Type:       "object",
+		Properties: make(map[string]*openapi.Schema),
+	}
+	if t.Kind() != reflect.Struct {
+		return schema
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if len(field.PkgPath) > 0 && !field.Anonymous {
+			continue
+		}
+
+		// the tags are parsed by mapping, the same as binding the requests
+		opts, err := mapping.ParseFieldOptions(tagName, field)
+		if err != nil || opts.Key == "-" {
+			continue
+		}
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && len(field.Tag.Get(tagName)) == 0 && fieldType.Kind() == reflect.Struct {
+			embedded := b.objectSchema(fieldType, tagName)
+			for name, property := range embedded.Properties {
+				schema.Properties[name] = property
+			}
+			schema.Required = append(schema.Required, embedded.Required...)
+			continue
+		}
+		if len(field.PkgPath) > 0 {
+			continue
+		}
+
+		property := b.schemaOf(field.Type, tagName)
+		if len(property.Ref) == 0 {
+			applyTagOptions(property, opts)
+		}
+		schema.Properties[opts.Key] = property
+		if opts.Required() {
+			schema.Required = append(schema.Required, opts.Key)
+		}
+	}
+	sort.Strings(schema.Required)
+
+	return schema
+}
+
+// componentName returns the name of t in the components, qualified by its package if the name is taken.
+func (b *schemaBuilder) componentName(t reflect.Type) string {
+	name := t.Name()
+	if _, ok := b.schemas[name]; ok {
+		name = path.Base(t.PkgPath()) + "." + name
+	}
+	for i := 2; ; i++ {
+		if _, ok := b.schemas[name]; !ok {
+			return name
+		}
+		name = fmt.Sprintf("%s.%s%d", path.Base(t.PkgPath()), t.Name(), i)
+	}
+}
+
+func applyTagOptions(schema *openapi.Schema, opts mapping.FieldOptions) {
+	// the value is a string like "18" parsed as the field type, the format like int64 is kept
+	if opts.FromString && (schema.Type == "integer" || schema.Type == "number" || schema.Type == "boolean") {
+		schema.Type = "string"
+	}
+	if len(opts.Default) > 0 {
+		schema.Default = typedValue(schema.Type, opts.Default)
+	}
+	for _, option := range opts.Options {
+		schema.Enum = append(schema.Enum, typedValue(schema.Type, option))
+	}
+	schema.Minimum = opts.Minimum
+	schema.ExclusiveMinimum = opts.ExclusiveMinimum
+	schema.Maximum = opts.Maximum
+	schema.ExclusiveMaximum = opts.ExclusiveMaximum
+}
+
+func typedValue(schemaType, value string) interface{} {
+	switch schemaType {
+	case "boolean":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	case "integer":
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return i
+		}
+	case "number":
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+
+	return value
+}
+
+// toOpenAPIPath converts the router pattern like /users/:id/*rest to /users/{id}/{rest},
+// and returns the names of the path params.
+func toOpenAPIPath(pattern string) (string, []string) {
+	var params []string
+	segments := strings.Split(pattern, "/")
+	for i, segment := range segments {
+		if len(segment) == 0 || (segment[0] != paramToken && segment[0] != wildcardToken) {
+			continue
+		}
+
+		name := segment[1:]
+		if len(name) == 0 {
+			name = unnamedWildcard
+		}
+		params = append(params, name)
+		segments[i] = "{" + name + "}"
+	}
+
+	return strings.Join(segments, "/"), params
+}
+
+func lowerFirst(s string) string {
+	if len(s) == 0 {
+		return s
+	}
+
+	return strings.ToLower(s[:1]) + s[1:]
+}
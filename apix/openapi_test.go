@@ -0,0 +1,99 @@
+package apix
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/weblazy/core/apix/openapi"
+)
+
+type (
+	docTestController struct {
+		Controller
+	}
+
+	docTestQuery struct {
+		Page  int    `form:"page,default=1,range=[1:100]"`
+		Order string `form:"order,options=asc|desc"`
+		Name  string `form:"name"`
+	}
+
+	docTestUser struct {
+		Id      int64          `json:"id"`
+		Role    string         `json:"role,options=admin|user"`
+		Friends []*docTestUser `json:"friends,optional"`
+		Age     int64          `json:"age,string,range=(0:150]"`
+		Level   string         `json:"level,optional=role,options=low|high"`
+		Secret  string         `json:"-"`
+	}
+)
+
+func (c *docTestController) List() {}
+
+func (c *docTestController) Show() {}
+
+func TestOpenAPI(t *testing.T) {
+	mux := NewControllerRegister()
+	assert.Nil(t, mux.Add("/users", &docTestController{}, "get:List"))
+	assert.Nil(t, mux.Add("/users/:id/*rest", &docTestController{}, "get,put:Show"))
+	assert.Nil(t, mux.AddAuto("/doc/", &docTestController{}))
+	assert.NotNil(t, mux.AddDoc(&docTestController{}, "Missing", ActionDoc{}))
+	assert.Nil(t, mux.AddDoc(&docTestController{}, "List", ActionDoc{
+		Summary:  "list users",
+		Params:   docTestQuery{},
+		Response: []docTestUser{},
+	}))
+	assert.Nil(t, mux.AddDoc(&docTestController{}, "Show", ActionDoc{
+		Body: (*docTestUser)(nil),
+	}))
+
+	doc := mux.OpenAPI(openapi.Info{Title: "test"})
+	assert.Equal(t, "1.0.0", doc.Info.Version)
+
+	list := doc.Paths["/users"]["get"]
+	assert.Equal(t, "list users", list.Summary)
+	assert.Equal(t, []string{"docTest"}, list.Tags)
+	assert.Equal(t, 3, len(list.Parameters))
+	assert.Equal(t, "order", list.Parameters[1].Name)
+	assert.True(t, list.Parameters[1].Required)
+	assert.Equal(t, []interface{}{"asc", "desc"}, list.Parameters[1].Schema.Enum)
+	assert.Equal(t, "page", list.Parameters[2].Name)
+	assert.False(t, list.Parameters[2].Required)
+	assert.Equal(t, int64(1), list.Parameters[2].Schema.Default)
+	assert.Equal(t, float64(100), *list.Parameters[2].Schema.Maximum)
+	assert.Equal(t, "#/components/schemas/docTestUser",
+		list.Responses["200"].Content[applicationJSON].Schema.Items.Ref)
+
+	show := doc.Paths["/users/{id}/{rest}"]
+	assert.Equal(t, 2, len(show))
+	assert.Equal(t, 2, len(show["put"].Parameters))
+	assert.NotEqual(t, show["get"].OperationID, show["put"].OperationID)
+
+	user := doc.Components.Schemas["docTestUser"]
+	assert.Equal(t, []string{"age", "role"}, user.Required)
+	assert.Equal(t, "string", user.Properties["age"].Type)
+	assert.Equal(t, "int64", user.Properties["age"].Format)
+	assert.True(t, user.Properties["age"].ExclusiveMinimum)
+	assert.Equal(t, float64(150), *user.Properties["age"].Maximum)
+	assert.Equal(t, []interface{}{"low", "high"}, user.Properties["level"].Enum)
+	assert.NotContains(t, user.Properties, "-")
+	assert.NotContains(t, user.Properties, "Secret")
+	assert.Equal(t, "#/components/schemas/docTestUser", user.Properties["friends"].Items.Ref)
+
+	// auto routes are documented once, as POST since List has Params
+	assert.Equal(t, 1, len(doc.Paths["/doc/List"]))
+	assert.NotNil(t, doc.Paths["/doc/List"]["post"])
+	assert.NotNil(t, doc.Paths["/doc/Show"]["post"])
+
+	assert.Nil(t, mux.InsertFilter(defaultDocsPath, BeforeRouter, DocsFilter(mux, openapi.Info{Title: "test"})))
+	w := httptest.NewRecorder()
+	mux.serveHTTP(w, httptest.NewRequest(http.MethodGet, defaultDocsPath, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var served openapi.Document
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &served))
+	assert.Equal(t, "test", served.Info.Title)
+	assert.Equal(t, len(doc.Paths), len(served.Paths))
+}
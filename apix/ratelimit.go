@@ -0,0 +1,253 @@
+package apix
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/weblazy/core/database/redis"
+	"github.com/weblazy/core/logx"
+	"github.com/weblazy/core/stringx"
+	"github.com/weblazy/core/timex"
+)
+
+const (
+	rateLimitLimitHeader     = "RateLimit-Limit"
+	rateLimitRemainingHeader = "RateLimit-Remaining"
+	rateLimitResetHeader     = "RateLimit-Reset"
+	retryAfterHeader         = "Retry-After"
+
+	bucketSweepInterval = time.Minute
+
+	// KEYS[1]: the key of the window
+	// ARGV[1]: now in milliseconds, ARGV[2]: window in milliseconds, ARGV[3]: limit, ARGV[4]: unique member
+	// returns {allowed, remaining, reset in milliseconds}
+	slidingWindowScript = `local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+redis.call("ZREMRANGEBYSCORE", KEYS[1], 0, now - window)
+local count = redis.call("ZCARD", KEYS[1])
+local allowed = 0
+if count < limit then
+    redis.call("ZADD", KEYS[1], now, ARGV[4])
+    count = count + 1
+    allowed = 1
+end
+redis.call("PEXPIRE", KEYS[1], window)
+local reset = window
+local oldest = redis.call("ZRANGE", KEYS[1], 0, 0, "WITHSCORES")
+if oldest[2] then
+    reset = tonumber(oldest[2]) + window - now
+end
+return {allowed, limit - count, reset}`
+)
+
+type (
+	// RateLimiter limits the requests of each key.
+	RateLimiter interface {
+		// Take takes a request of key, and returns whether it's allowed with the quota left.
+		Take(key string) (RateLimitResult, error)
+	}
+
+	// RateLimitResult is the outcome of RateLimiter.Take.
+	RateLimitResult struct {
+		Allowed bool
+		// Limit is the number of requests allowed in the quota.
+		Limit int
+		// Remaining is the number of requests left in the quota.
+		Remaining int
+		// Reset is the time until the quota is fully restored if allowed,
+		// or until the next request can be allowed if not.
+		Reset time.Duration
+	}
+
+	// KeyFunc returns the key to limit the request on, the request is not limited if empty.
+	KeyFunc func(ctx *Context) string
+
+	// TokenBucketLimiter is an in-memory RateLimiter, each key has a bucket of burst tokens,
+	// refilled at rate tokens per second.
+	TokenBucketLimiter struct {
+		rate      float64
+		burst     int
+		buckets   map[string]*tokenBucket
+		lastSweep time.Duration
+		lock      sync.Mutex
+	}
+
+	tokenBucket struct {
+		tokens float64
+		last   time.Duration
+	}
+
+	// RedisLimiter is a RateLimiter with a sliding window on redis, shared by all the servers,
+	// each key is allowed limit requests in any window.
+	RedisLimiter struct {
+		store  *redis.Redis
+		prefix string
+		limit  int
+		window time.Duration
+	}
+)
+
+// NewTokenBucketLimiter returns a TokenBucketLimiter allowing rate requests per second on average,
+// and burst requests at most at once.
+func NewTokenBucketLimiter(rate float64, burst int) *TokenBucketLimiter {
+	return &TokenBucketLimiter{
+		rate:      rate,
+		burst:     burst,
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: timex.Now(),
+	}
+}
+
+// Take takes a token of key.
+func (l *TokenBucketLimiter) Take(key string) (RateLimitResult, error) {
+	now := timex.Now()
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.sweep(now)
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{
+			tokens: float64(l.burst),
+			last:   now,
+		}
+		l.buckets[key] = bucket
+	} else {
+		bucket.refill(now, l.rate, l.burst)
+	}
+
+	result := RateLimitResult{
+		Limit: l.burst,
+	}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		result.Allowed = true
+		result.Reset = l.timeToFill(float64(l.burst) - bucket.tokens)
+	} else {
+		result.Reset = l.timeToFill(1 - bucket.tokens)
+	}
+	result.Remaining = int(bucket.tokens)
+
+	return result, nil
+}
+
+// sweep removes the buckets which are full again, they behave the same as the new ones.
+func (l *TokenBucketLimiter) sweep(now time.Duration) {
+	if now-l.lastSweep < bucketSweepInterval {
+		return
+	}
+
+	l.lastSweep = now
+	for key, bucket := range l.buckets {
+		bucket.refill(now, l.rate, l.burst)
+		if bucket.tokens >= float64(l.burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func (l *TokenBucketLimiter) timeToFill(tokens float64) time.Duration {
+	if l.rate <= 0 {
+		return 0
+	}
+
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
+
+func (b *tokenBucket) refill(now time.Duration, rate float64, burst int) {
+	b.tokens = math.Min(float64(burst), b.tokens+(now-b.last).Seconds()*rate)
+	b.last = now
+}
+
+// NewRedisLimiter returns a RedisLimiter allowing limit requests in window,
+// the keys are stored on store with prefix.
+func NewRedisLimiter(store *redis.Redis, prefix string, limit int, window time.Duration) *RedisLimiter {
+	return &RedisLimiter{
+		store:  store,
+		prefix: prefix,
+		limit:  limit,
+		window: window,
+	}
+}
+
+// Take records a request of key in the window.
+func (l *RedisLimiter) Take(key string) (RateLimitResult, error) {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	resp, err := l.store.Eval(slidingWindowScript, []string{l.prefix + key}, []string{
+		strconv.FormatInt(now, 10),
+		strconv.FormatInt(int64(l.window/time.Millisecond), 10),
+		strconv.Itoa(l.limit),
+		strconv.FormatInt(now, 10) + "-" + stringx.Randn(8),
+	})
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+
+	values, ok := resp.([]interface{})
+	if !ok || len(values) != 3 {
+		return RateLimitResult{}, fmt.Errorf("unknown reply of rate limit script: %v", resp)
+	}
+	allowed, _ := values[0].(int64)
+	remaining, _ := values[1].(int64)
+	reset, _ := values[2].(int64)
+
+	return RateLimitResult{
+		Allowed:   allowed == 1,
+		Limit:     l.limit,
+		Remaining: int(remaining),
+		Reset:     time.Duration(reset) * time.Millisecond,
+	}, nil
+}
+
+// IPKey limits the requests by the client ip.
+func IPKey(ctx *Context) string {
+	return ClientIP(ctx.R)
+}
+
+// UserKey returns a KeyFunc that limits the requests by the user stored with ctx.SetData(dataKey, user)
+// by the authentication filters, the requests without user are limited by the client ip.
+func UserKey(dataKey interface{}) KeyFunc {
+	return func(ctx *Context) string {
+		if user := ctx.GetData(dataKey); user != nil {
+			return fmt.Sprintf("user:%v", user)
+		}
+
+		return "ip:" + ClientIP(ctx.R)
+	}
+}
+
+// RateLimitFilter returns a filter that limits the requests by the keys from keyFunc,
+// the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers are set on the responses,
+// and the rejected requests are responded with 429 and Retry-After.
+// The requests are allowed if the limiter fails, e.g. redis is down.
+// Insert it at BeforeExec and put ctx.Route() into the keys to limit each route separately.
+func RateLimitFilter(limiter RateLimiter, keyFunc KeyFunc) FilterFunc {
+	return func(ctx *Context) {
+		key := keyFunc(ctx)
+		if len(key) == 0 {
+			return
+		}
+
+		result, err := limiter.Take(key)
+		if err != nil {
+			logx.Errorf("rate limit on %s: %s", key, err)
+			return
+		}
+
+		header := ctx.W.Header()
+		reset := strconv.Itoa(int(math.Ceil(result.Reset.Seconds())))
+		header.Set(rateLimitLimitHeader, strconv.Itoa(result.Limit))
+		header.Set(rateLimitRemainingHeader, strconv.Itoa(result.Remaining))
+		header.Set(rateLimitResetHeader, reset)
+		if !result.Allowed {
+			header.Set(retryAfterHeader, reset)
+			ctx.AbortWithError(NewHTTPError(http.StatusTooManyRequests, ""))
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package apix
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/weblazy/core/database/redis"
+	"github.com/weblazy/core/load"
+)
+
+// overloadedShedder drops all the requests.
+type overloadedShedder struct{}
+
+func (s overloadedShedder) Allow() (load.Promise, error) {
+	return nil, load.ErrServiceOverloaded
+}
+
+func TestTokenBucketLimiter(t *testing.T) {
+	limiter := NewTokenBucketLimiter(10, 2)
+	result, err := limiter.Take("a")
+	assert.Nil(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 2, result.Limit)
+	assert.Equal(t, 1, result.Remaining)
+
+	result, _ = limiter.Take("a")
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	result, _ = limiter.Take("a")
+	assert.False(t, result.Allowed)
+	assert.True(t, result.Reset > 0 && result.Reset <= time.Second/10)
+
+	result, _ = limiter.Take("b")
+	assert.True(t, result.Allowed)
+
+	time.Sleep(time.Second / 10)
+	result, _ = limiter.Take("a")
+	assert.True(t, result.Allowed)
+}
+
+func TestRedisLimiter(t *testing.T) {
+	s, err := miniredis.Run()
+	assert.Nil(t, err)
+	defer s.Close()
+
+	limiter := NewRedisLimiter(redis.NewRedis(s.Addr(), redis.NodeType), "limit:", 2, time.Minute)
+	result, err := limiter.Take("a")
+	assert.Nil(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 2, result.Limit)
+	assert.Equal(t, 1, result.Remaining)
+	assert.True(t, result.Reset > 0 && result.Reset <= time.Minute)
+
+	result, err = limiter.Take("a")
+	assert.Nil(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	result, err = limiter.Take("a")
+	assert.Nil(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+	assert.True(t, result.Reset > 0 && result.Reset <= time.Minute)
+
+	result, err = limiter.Take("b")
+	assert.Nil(t, err)
+	assert.True(t, result.Allowed)
+	assert.True(t, s.Exists("limit:a"))
+
+	// the requests are allowed if redis is down
+	s.Close()
+	_, err = limiter.Take("a")
+	assert.NotNil(t, err)
+	mux := NewControllerRegister()
+	assert.Nil(t, mux.Add("/users/:id", &filterTestController{}))
+	assert.Nil(t, mux.InsertFilter("/*", BeforeExec, RateLimitFilter(limiter, IPKey)))
+	w := httptest.NewRecorder()
+	mux.serveHTTP(w, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRateLimitFilter(t *testing.T) {
+	mux := NewControllerRegister()
+	assert.Nil(t, mux.Add("/users/:id", &filterTestController{}))
+	assert.Nil(t, mux.InsertFilter("/*", BeforeExec, RateLimitFilter(NewTokenBucketLimiter(1, 1),
+		func(ctx *Context) string {
+			return ctx.Route() + " " + IPKey(ctx)
+		})))
+
+	w := httptest.NewRecorder()
+	mux.serveHTTP(w, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get(rateLimitLimitHeader))
+	assert.Equal(t, "0", w.Header().Get(rateLimitRemainingHeader))
+	assert.Equal(t, "1", w.Header().Get(rateLimitResetHeader))
+
+	// the same route with other params shares the quota
+	w = httptest.NewRecorder()
+	mux.serveHTTP(w, httptest.NewRequest(http.MethodGet, "/users/2", nil))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get(retryAfterHeader))
+}
+
+func TestUserKey(t *testing.T) {
+	ctx := newContext(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	keyFunc := UserKey("user")
+	assert.Equal(t, "ip:192.0.2.1", keyFunc(ctx))
+	ctx.SetData("user", 7)
+	assert.Equal(t, "user:7", keyFunc(ctx))
+}
+
+func TestSheddingFilter(t *testing.T) {
+	mux := NewControllerRegister()
+	assert.Nil(t, mux.Add("/users/:id", &filterTestController{}))
+	assert.Nil(t, mux.InsertFilter("/*", BeforeExec, SheddingFilter()))
+
+	w := httptest.NewRecorder()
+	mux.serveHTTP(w, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestSheddingFilterOverloaded(t *testing.T) {
+	var keys []string
+	mux := NewControllerRegister()
+	assert.Nil(t, mux.Add("/users/:id", &filterTestController{}))
+	assert.Nil(t, mux.InsertFilter("/*", BeforeExec, sheddingFilter(func(key string) load.Shedder {
+		keys = append(keys, key)
+		return overloadedShedder{}
+	})))
+
+	w := httptest.NewRecorder()
+	mux.serveHTTP(w, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, []string{"GET /users/:id"}, keys)
+}
@@ -0,0 +1,307 @@
+package apix
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/weblazy/core/config"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	defaultViewPath = "views"
+	devMode         = "dev"
+
+	jsonDataKey  = "json"
+	jsonpDataKey = "jsonp"
+	xmlDataKey   = "xml"
+	yamlDataKey  = "yaml"
+
+	layoutContentKey = "LayoutContent"
+
+	applicationJSON       = "application/json"
+	applicationJavaScript = "application/javascript"
+	applicationXML        = "application/xml"
+	applicationYAML       = "application/x-yaml"
+	textHTML              = "text/html"
+	textXML               = "text/xml"
+	textYAML              = "text/yaml"
+	charsetUTF8           = "; charset=utf-8"
+)
+
+var (
+	ErrJSONPCallback = errors.New("jsonp callback is not a valid javascript identifier")
+
+	jsonpCallbackRegex = regexp.MustCompile(`^[a-zA-Z_$][a-zA-Z0-9_$]*(\.[a-zA-Z_$][a-zA-Z0-9_$]*)*$`)
+	templateFuncs      = make(template.FuncMap)
+	templateCache      = make(map[string]*template.Template)
+	templateLock       sync.RWMutex
+)
+
+// AddFuncMap registers a function that can be used in the templates,
+// it must be called before the templates are rendered.
+func AddFuncMap(name string, fn interface{}) {
+	templateLock.Lock()
+	templateFuncs[name] = fn
+	templateLock.Unlock()
+}
+
+// ServeJSON writes Data["json"] as json.
+func (c *Controller) ServeJSON() error {
+	return c.serveJSON(c.Data[jsonDataKey])
+}
+
+func (c *Controller) serveJSON(data interface{}) error {
+	content, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	return c.writeContent(applicationJSON+charsetUTF8, content)
+}
+
+// ServeJSONP writes Data["jsonp"] as jsonp, the callback is taken from the callback query param.
+func (c *Controller) ServeJSONP() error {
+	callback := c.GetString("callback")
+	if len(callback) == 0 {
+		return c.ServeJSON()
+	}
+	if !jsonpCallbackRegex.MatchString(callback) {
+		return ErrJSONPCallback
+	}
+
+	content, err := json.Marshal(c.Data[jsonpDataKey])
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	// the comment prevents the content sniffing attacks like rosetta flash
+	buf.WriteString("/**/")
+	buf.WriteString(callback)
+	buf.WriteByte('(')
+	buf.Write(content)
+	buf.WriteString(");")
+	return c.writeContent(applicationJavaScript+charsetUTF8, buf.Bytes())
+}
+
+// ServeXML writes Data["xml"] as xml.
+func (c *Controller) ServeXML() error {
+	return c.serveXML(c.Data[xmlDataKey])
+}
+
+func (c *Controller) serveXML(data interface{}) error {
+	content, err := xml.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	return c.writeContent(applicationXML+charsetUTF8, append([]byte(xml.Header), content...))
+}
+
+// ServeYAML writes Data["yaml"] as yaml.
+func (c *Controller) ServeYAML() error {
+	return c.serveYAML(c.Data[yamlDataKey])
+}
+
+func (c *Controller) serveYAML(data interface{}) error {
+	content, err := yaml.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	return c.writeContent(applicationYAML+charsetUTF8, content)
+}
+
+// ServeFormatted serves xml, yaml or json according to the Accept header, json by default.
+func (c *Controller) ServeFormatted() error {
+	switch negotiateFormat(c.R.Header.Get("Accept")) {
+	case xmlDataKey:
+		return c.ServeXML()
+	case yamlDataKey:
+		return c.ServeYAML()
+	default:
+		return c.ServeJSON()
+	}
+}
+
+// serveResult serves the result returned by the action like ServeFormatted.
+func (c *Controller) serveResult(result interface{}) error {
+	switch negotiateFormat(c.R.Header.Get("Accept")) {
+	case xmlDataKey:
+		return c.serveXML(result)
+	case yamlDataKey:
+		return c.serveYAML(result)
+	default:
+		return c.serveJSON(result)
+	}
+}
+
+// Render renders the template TplName with Data if EnableRender is set,
+// if Layout is set, the rendered content is put into the layout as {{.LayoutContent}},
+// and each LayoutSections template is rendered into the Data key of its name.
+func (c *Controller) Render() error {
+	if !c.EnableRender || len(c.TplName) == 0 {
+		return nil
+	}
+
+	content, err := c.RenderBytes()
+	if err != nil {
+		return err
+	}
+
+	return c.writeContent(textHTML+charsetUTF8, content)
+}
+
+// RenderString returns the rendered template as string.
+func (c *Controller) RenderString() (string, error) {
+	content, err := c.RenderBytes()
+	return string(content), err
+}
+
+// RenderBytes returns the rendered template, with the layout if set.
+func (c *Controller) RenderBytes() ([]byte, error) {
+	conf := &stateOf(c.R).conf
+	content, err := executeTemplate(conf, c.TplName, c.Data)
+	if err != nil || len(c.Layout) == 0 {
+		return content, err
+	}
+
+	data := make(map[interface{}]interface{}, len(c.Data)+len(c.LayoutSections)+1)
+	for k, v := range c.Data {
+		data[k] = v
+	}
+	for sectionName, sectionTpl := range c.LayoutSections {
+		if len(sectionTpl) == 0 {
+			data[sectionName] = template.HTML("")
+			continue
+		}
+
+		section, err := executeTemplate(conf, sectionTpl, c.Data)
+		if err != nil {
+			return nil, err
+		}
+		data[sectionName] = template.HTML(section)
+	}
+	data[layoutContentKey] = template.HTML(content)
+
+	return executeTemplate(conf, c.Layout, data)
+}
+
+func (c *Controller) writeContent(contentType string, content []byte) error {
+	c.W.Header().Set("Content-Type", contentType)
+	_, err := c.W.Write(content)
+	return err
+}
+
+func executeTemplate(conf *config.ApiConfig, name string, data interface{}) ([]byte, error) {
+	tpl, err := getTemplate(conf, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err = tpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// getTemplate returns the parsed template in the view path of conf,
+// templates are cached by their files except in dev mode.
+func getTemplate(conf *config.ApiConfig, name string) (*template.Template, error) {
+	viewPath := conf.ViewPath
+	if len(viewPath) == 0 {
+		viewPath = defaultViewPath
+	}
+	file := filepath.Join(viewPath, filepath.FromSlash(name))
+	// a bare prefix check lets views2/x.html pass for views
+	if rel, err := filepath.Rel(viewPath, file); err != nil || rel == ".." ||
+		strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("template %s is out of the view path", name)
+	}
+
+	cacheable := conf.RunMode != devMode
+	if cacheable {
+		templateLock.RLock()
+		tpl, ok := templateCache[file]
+		templateLock.RUnlock()
+		if ok {
+			return tpl, nil
+		}
+	}
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	templateLock.Lock()
+	defer templateLock.Unlock()
+	tpl, err := template.New(name).Funcs(templateFuncs).Parse(string(content))
+	if err != nil {
+		return nil, err
+	}
+	if cacheable {
+		templateCache[file] = tpl
+	}
+
+	return tpl, nil
+}
+
+// negotiateFormat returns the data key of the supported media type with the highest quality
+// in the Accept header, the first one wins on ties, json by default.
+func negotiateFormat(accept string) string {
+	format := jsonDataKey
+	best := 0.0
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		var key string
+		switch strings.TrimSpace(fields[0]) {
+		case applicationJSON:
+			key = jsonDataKey
+		case applicationXML, textXML:
+			key = xmlDataKey
+		case applicationYAML, textYAML:
+			key = yamlDataKey
+		default:
+			continue
+		}
+
+		if quality := mediaQuality(fields[1:]); quality > best {
+			format = key
+			best = quality
+		}
+	}
+
+	return format
+}
+
+// mediaQuality returns the q parameter of a media range, 1 if absent, 0 if invalid.
+func mediaQuality(params []string) float64 {
+	for _, param := range params {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) != "q" {
+			continue
+		}
+
+		quality, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+		if err != nil || quality < 0 || quality > 1 {
+			return 0
+		}
+		return quality
+	}
+
+	return 1
+}
@@ -0,0 +1,127 @@
+package apix
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newRenderTestController(target, accept string) (*Controller, *httptest.ResponseRecorder) {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	r.Header.Set("Accept", accept)
+	r.ParseForm()
+	w := httptest.NewRecorder()
+	return &Controller{
+		BaseController: BaseController{W: w, R: r},
+		Data:           make(map[interface{}]interface{}),
+	}, w
+}
+
+func TestServeFormats(t *testing.T) {
+	type user struct {
+		Name string `json:"name" xml:"name" yaml:"name"`
+	}
+
+	c, w := newRenderTestController("/", "")
+	c.Data[jsonDataKey] = user{Name: "kevin"}
+	assert.Nil(t, c.ServeJSON())
+	assert.Equal(t, applicationJSON+charsetUTF8, w.Header().Get("Content-Type"))
+	assert.Equal(t, `{"name":"kevin"}`, w.Body.String())
+
+	c, w = newRenderTestController("/?callback=app.done", "")
+	c.Data[jsonpDataKey] = user{Name: "kevin"}
+	assert.Nil(t, c.ServeJSONP())
+	assert.Equal(t, applicationJavaScript+charsetUTF8, w.Header().Get("Content-Type"))
+	assert.Equal(t, `/**/app.done({"name":"kevin"});`, w.Body.String())
+	c, _ = newRenderTestController("/?callback=alert(1)", "")
+	assert.Equal(t, ErrJSONPCallback, c.ServeJSONP())
+
+	c, w = newRenderTestController("/", "text/html, application/xml;q=0.9, application/json;q=0.8")
+	c.Data[xmlDataKey] = user{Name: "kevin"}
+	assert.Nil(t, c.ServeFormatted())
+	assert.Equal(t, applicationXML+charsetUTF8, w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "<user><name>kevin</name></user>")
+
+	c, w = newRenderTestController("/", "application/json;q=0.5, text/yaml")
+	c.Data[yamlDataKey] = user{Name: "kevin"}
+	assert.Nil(t, c.ServeFormatted())
+	assert.Equal(t, applicationYAML+charsetUTF8, w.Header().Get("Content-Type"))
+	assert.Equal(t, "name: kevin\n", w.Body.String())
+}
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		accept string
+		expect string
+	}{
+		{"", jsonDataKey},
+		{"*/*", jsonDataKey},
+		{"application/xml", xmlDataKey},
+		{"text/html, text/xml", xmlDataKey},
+		{"application/json, application/xml", jsonDataKey},
+		{"application/xml;q=0.5, application/json", jsonDataKey},
+		{"application/json;q=0.1, application/yaml, text/yaml;q=0.2", yamlDataKey},
+		{"application/xml;q=0, text/html", jsonDataKey},
+		{"application/xml;q=abc, text/yaml;q=0.3", yamlDataKey},
+		{"application/xml; charset=utf-8; q=0.9, application/json;q=0.8", xmlDataKey},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expect, negotiateFormat(test.accept), test.accept)
+	}
+}
+
+func TestRender(t *testing.T) {
+	dir, err := ioutil.TempDir("", "views")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	viewPath := filepath.Join(dir, "views")
+	assert.Nil(t, os.MkdirAll(filepath.Join(viewPath, "user"), 0755))
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "views2"), 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(viewPath, "layout.html"),
+		[]byte(`<title>{{.Title}}</title>{{.Scripts}}<main>{{.LayoutContent}}</main>`), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(viewPath, "user", "show.html"),
+		[]byte(`<p>{{upper .Name}}</p>`), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(viewPath, "scripts.html"),
+		[]byte(`<script src="{{.Name}}.js"></script>`), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "views2", "secret.html"), []byte("secret"), 0644))
+
+	prev := ApiConfig
+	defer func() {
+		ApiConfig = prev
+	}()
+	ApiConfig.ViewPath = viewPath
+	ApiConfig.RunMode = devMode
+	AddFuncMap("upper", func(s string) string {
+		return "<" + s + ">"
+	})
+
+	c, w := newRenderTestController("/", "")
+	c.EnableRender = true
+	c.TplName = "user/show.html"
+	c.Layout = "layout.html"
+	c.LayoutSections = map[string]string{"Scripts": "scripts.html"}
+	c.Data["Title"] = "user"
+	c.Data["Name"] = "kevin"
+	assert.Nil(t, c.Render())
+	assert.Equal(t, textHTML+charsetUTF8, w.Header().Get("Content-Type"))
+	assert.Equal(t, `<title>user</title><script src="kevin.js"></script><main><p>&lt;kevin&gt;</p></main>`,
+		w.Body.String())
+
+	c.EnableRender = false
+	assert.Nil(t, c.Render())
+
+	for _, name := range []string{"../views2/secret.html", "../../etc/passwd", ".."} {
+		_, err = getTemplate(&ApiConfig, name)
+		assert.NotNil(t, err, name)
+		assert.Contains(t, err.Error(), "out of the view path", name)
+	}
+	_, err = getTemplate(&ApiConfig, "missing.html")
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,224 @@
+package apix
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/weblazy/core/apix/openapi"
+	"github.com/weblazy/core/apix/session"
+	"github.com/weblazy/core/config"
+	"github.com/weblazy/core/logx"
+	"github.com/weblazy/core/system"
+)
+
+const (
+	// the in-flight requests are drained within shutdownTimeout on shutdown,
+	// shorter than the force quit time of the system package
+	shutdownTimeout = 5 * time.Second
+
+	timeoutFilterKey = "timeout"
+	docsFilterKey    = "docs"
+)
+
+type (
+	// Server is a http server which drains in-flight requests on shutdown.
+	// The config, the sessions, the error pages and the trusted proxies are kept on the Server,
+	// several Servers with different configs can run in the same process.
+	Server struct {
+		state    *serverState
+		router   *ControllerRegister
+		server   *http.Server
+		stopOnce sync.Once
+		stopped  chan struct{}
+	}
+
+	// serverState is the state of the Server serving the request, read by the controllers and the filters.
+	serverState struct {
+		conf           config.ApiConfig
+		sessions       *session.Manager
+		errorPages     map[int]string
+		trustedProxies []*net.IPNet
+	}
+
+	serverStateKey struct{}
+)
+
+// NewServer returns a Server which serves router with conf.
+// The timeout and the docs filters are inserted into router once, even if router is served by several Servers.
+func NewServer(conf config.ApiConfig, router *ControllerRegister) (*Server, error) {
+	if conf.MaxMemory == 0 {
+		conf.MaxMemory = 1 << 26 //64M
+	}
+	if conf.EnableXSRF && len(conf.XSRFKey) == 0 {
+		// the cookies signed with an empty key can be forged by anyone
+		return nil, ErrXSRFKeyNotSet
+	}
+
+	state := &serverState{
+		conf:       conf,
+		errorPages: make(map[int]string, len(conf.ErrorPages)),
+	}
+	for code, tplName := range conf.ErrorPages {
+		statusCode, err := strconv.Atoi(code)
+		if err != nil || len(http.StatusText(statusCode)) == 0 {
+			return nil, fmt.Errorf("invalid status code %q of error pages", code)
+		}
+		state.errorPages[statusCode] = tplName
+	}
+	trustedProxies, err := parseTrustedProxies(conf.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	state.trustedProxies = trustedProxies
+
+	if conf.Timeout > 0 {
+		// the timeout is read from the state of the request, the servers sharing router have their own timeouts
+		if err := router.insertFilterOnce(timeoutFilterKey, "/*", BeforeRouter, serverTimeoutFilter); err != nil {
+			return nil, err
+		}
+	}
+	if conf.EnableDocs {
+		docsPath := conf.DocsPath
+		if len(docsPath) == 0 {
+			docsPath = defaultDocsPath
+		}
+		title := conf.AppName
+		if len(title) == 0 {
+			title = conf.ServerName
+		}
+		if err := router.insertFilterOnce(docsFilterKey+" "+docsPath, docsPath, BeforeRouter,
+			DocsFilter(router, openapi.Info{
+				Title: title,
+			})); err != nil {
+			return nil, err
+		}
+	}
+	for _, static := range conf.Static {
+		if router.hasStatic(static) {
+			continue
+		}
+		if err := router.AddStatic(static); err != nil {
+			return nil, err
+		}
+	}
+	// the session manager is created at last, it cleans up the sessions until the server is stopped
+	if conf.SessionOn {
+		manager, err := session.NewManager(conf.Session)
+		if err != nil {
+			return nil, err
+		}
+		state.sessions = manager
+	}
+
+	s := &Server{
+		state:   state,
+		router:  router,
+		stopped: make(chan struct{}),
+	}
+	s.server = &http.Server{
+		Addr:         fmt.Sprintf("%s:%d", conf.Host, conf.Port),
+		Handler:      s,
+		ReadTimeout:  time.Duration(conf.ReadTimeout) * time.Millisecond,
+		WriteTimeout: time.Duration(conf.WriteTimeout) * time.Millisecond,
+		IdleTimeout:  time.Duration(conf.IdleTimeout) * time.Millisecond,
+	}
+	if !conf.HTTP2 {
+		// a non-nil empty map disables the http2 upgrade on tls connections
+		s.server.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+	}
+
+	return s, nil
+}
+
+// ServeHTTP serves r by the router with the state of the server.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.router.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), serverStateKey{}, s.state)))
+}
+
+// Start serves http or https until the server is stopped,
+// on SIGTERM the in-flight requests are drained before exiting.
+func (s *Server) Start() {
+	// we need to make sure all others are wrapped up
+	// so we do graceful stop at shutdown phase instead of wrap up phase
+	system.AddShutdownListener(func() {
+		s.shutdown()
+	})
+
+	var err error
+	if s.isTLS() {
+		logx.Infof("https server Running on https://%s", s.server.Addr)
+		err = s.server.ListenAndServeTLS(s.state.conf.CertFile, s.state.conf.KeyFile)
+	} else {
+		logx.Infof("http server Running on http://%s", s.server.Addr)
+		err = s.server.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		logx.Fatal(err)
+	}
+
+	// ListenAndServe returns as soon as shutdown begins, wait for the draining
+	<-s.stopped
+}
+
+// Stop gracefully shuts down the server, waiting for the in-flight requests up to 5 seconds.
+func (s *Server) Stop() {
+	s.shutdown()
+}
+
+func (s *Server) isTLS() bool {
+	return len(s.state.conf.CertFile) > 0 && len(s.state.conf.KeyFile) > 0
+}
+
+func (s *Server) shutdown() {
+	s.stopOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := s.server.Shutdown(ctx); err != nil {
+			logx.Error(err)
+		}
+		if s.state.sessions != nil {
+			s.state.sessions.Close()
+		}
+		close(s.stopped)
+	})
+}
+
+// stateOf returns the state of the Server serving r, or the package state for the requests
+// served by ControllerRegister directly, which is set by Run, SetErrorPage and SetTrustedProxies.
+func stateOf(r *http.Request) *serverState {
+	if r != nil {
+		if state, ok := r.Context().Value(serverStateKey{}).(*serverState); ok {
+			return state
+		}
+	}
+
+	return &serverState{
+		conf:           ApiConfig,
+		sessions:       GlobalSessions,
+		trustedProxies: trustedProxies,
+	}
+}
+
+// errorPage returns the template of the error page of code.
+func (s *serverState) errorPage(code int) (string, bool) {
+	if s.errorPages != nil {
+		tplName, ok := s.errorPages[code]
+		return tplName, ok
+	}
+
+	errorPageLock.RLock()
+	defer errorPageLock.RUnlock()
+	tplName, ok := errorPages[code]
+	return tplName, ok
+}
+
+// serverTimeoutFilter limits the requests with the timeout of their servers.
+func serverTimeoutFilter(ctx *Context) {
+	TimeoutFilter(time.Duration(stateOf(ctx.R).conf.Timeout) * time.Millisecond)(ctx)
+}
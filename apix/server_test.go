@@ -0,0 +1,126 @@
+package apix
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/weblazy/core/config"
+)
+
+type serverTestController struct {
+	Controller
+}
+
+func (c *serverTestController) Deadline() (string, error) {
+	if deadline, ok := c.Context().Deadline(); ok {
+		return time.Until(deadline).Round(time.Second).String(), nil
+	}
+
+	return "none", nil
+}
+
+func (c *serverTestController) IP() (string, error) {
+	return ClientIP(c.R), nil
+}
+
+func (c *serverTestController) Login() (string, error) {
+	c.SetSession("user", "kevin")
+	return "ok", nil
+}
+
+func TestServerState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "static")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	prev := ApiConfig
+	defer func() {
+		ApiConfig = prev
+	}()
+
+	router := NewControllerRegister()
+	assert.Nil(t, router.Add("/deadline", &serverTestController{}, "get:Deadline"))
+	assert.Nil(t, router.Add("/ip", &serverTestController{}, "get:IP"))
+	static := config.StaticConfig{Prefix: "/static", Dir: dir}
+	first, err := NewServer(config.ApiConfig{
+		Timeout:        10000,
+		EnableDocs:     true,
+		TrustedProxies: []string{"10.0.0.0/8"},
+		Static:         []config.StaticConfig{static},
+	}, router)
+	assert.Nil(t, err)
+	// the filters and the statics are added once for the servers sharing the router
+	second, err := NewServer(config.ApiConfig{
+		Timeout:    20000,
+		EnableDocs: true,
+		Static:     []config.StaticConfig{static},
+	}, router)
+	assert.Nil(t, err)
+	assert.Len(t, router.filters[BeforeRouter], 2)
+	assert.Len(t, router.statics, 1)
+	assert.Equal(t, prev, ApiConfig)
+
+	serve := func(s *Server, path string) string {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		r.Header.Set("X-Forwarded-For", "1.2.3.4")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code, path)
+		return w.Body.String()
+	}
+
+	assert.Equal(t, `"10s"`, serve(first, "/deadline"))
+	assert.Equal(t, `"20s"`, serve(second, "/deadline"))
+	assert.Equal(t, `"1.2.3.4"`, serve(first, "/ip"))
+	assert.Equal(t, `"10.0.0.1"`, serve(second, "/ip"))
+}
+
+func TestServerSessions(t *testing.T) {
+	router := NewControllerRegister()
+	assert.Nil(t, router.Add("/session", &serverTestController{}, "get:Login"))
+	s, err := NewServer(config.ApiConfig{
+		SessionOn: true,
+		Session: config.SessionConfig{
+			Provider:   "memory",
+			CookieName: "sid",
+			GCLifetime: 3600,
+		},
+	}, router)
+	assert.Nil(t, err)
+	assert.Nil(t, GlobalSessions)
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/session", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Set-Cookie"), "sid=")
+
+	done := make(chan struct{})
+	go func() {
+		s.Stop()
+		s.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(shutdownTimeout):
+		t.Fatal("stop is blocked")
+	}
+}
+
+func TestNewServerErrors(t *testing.T) {
+	_, err := NewServer(config.ApiConfig{EnableXSRF: true}, NewControllerRegister())
+	assert.Equal(t, ErrXSRFKeyNotSet, err)
+
+	_, err = NewServer(config.ApiConfig{ErrorPages: map[string]string{"999": "error.html"}},
+		NewControllerRegister())
+	assert.NotNil(t, err)
+
+	_, err = NewServer(config.ApiConfig{TrustedProxies: []string{"bad"}}, NewControllerRegister())
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,157 @@
+package session
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/weblazy/core/logx"
+)
+
+const (
+	sessionDirMode  = 0755
+	sessionFileMode = 0600
+)
+
+type (
+	fileProvider struct {
+		savePath    string
+		maxlifetime int64
+	}
+
+	fileStore struct {
+		*values
+		file string
+	}
+)
+
+// NewFileProvider returns a Provider which keeps each session in a file under savePath,
+// the files not modified in maxlifetime seconds are removed on gc.
+func NewFileProvider(savePath string, maxlifetime int64) Provider {
+	return &fileProvider{
+		savePath:    savePath,
+		maxlifetime: maxlifetime,
+	}
+}
+
+func (p *fileProvider) SessionRead(sid string) (Store, error) {
+	if !validSessionId(sid) {
+		return nil, ErrInvalidSessionId
+	}
+
+	file := p.sessionFile(sid)
+	content, err := ioutil.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	var data map[string]interface{}
+	if err == nil && !p.expired(file) {
+		if data, err = decodeValues(content); err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		os.Chtimes(file, now, now)
+	}
+
+	return &fileStore{
+		values: newValues(sid, data),
+		file:   file,
+	}, nil
+}
+
+func (p *fileProvider) SessionExist(sid string) (bool, error) {
+	if !validSessionId(sid) {
+		return false, nil
+	}
+
+	file := p.sessionFile(sid)
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return !p.expired(file), nil
+}
+
+func (p *fileProvider) SessionRegenerate(oldsid, sid string) (Store, error) {
+	store, err := p.SessionRead(oldsid)
+	if err != nil {
+		return nil, err
+	}
+
+	values := store.(*fileStore).values
+	newStore := &fileStore{
+		values: newValues(sid, values.data),
+		file:   p.sessionFile(sid),
+	}
+	if err = newStore.SessionRelease(); err != nil {
+		return nil, err
+	}
+
+	if err = p.SessionDestroy(oldsid); err != nil {
+		return nil, err
+	}
+
+	return newStore, nil
+}
+
+func (p *fileProvider) SessionDestroy(sid string) error {
+	if !validSessionId(sid) {
+		return ErrInvalidSessionId
+	}
+
+	if err := os.Remove(p.sessionFile(sid)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// SessionGC removes the session files which are not modified in maxlifetime.
+func (p *fileProvider) SessionGC() {
+	boundary := time.Now().Add(-time.Duration(p.maxlifetime) * time.Second)
+	filepath.Walk(p.savePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		if !info.IsDir() && info.ModTime().Before(boundary) {
+			if err := os.Remove(path); err != nil {
+				logx.Errorf("failed to remove session file: %s, error: %s", path, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// sessionFile spreads the files into sub directories by the first two characters of sid.
+func (p *fileProvider) sessionFile(sid string) string {
+	return filepath.Join(p.savePath, sid[0:1], sid[1:2], sid)
+}
+
+func (p *fileProvider) expired(file string) bool {
+	info, err := os.Stat(file)
+	if err != nil {
+		return true
+	}
+
+	return info.ModTime().Add(time.Duration(p.maxlifetime) * time.Second).Before(time.Now())
+}
+
+// SessionRelease writes the values to the session file.
+func (s *fileStore) SessionRelease() error {
+	content, err := s.encode()
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(s.file), sessionDirMode); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(s.file, content, sessionFileMode)
+}
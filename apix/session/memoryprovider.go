@@ -0,0 +1,85 @@
+package session
+
+import (
+	"time"
+
+	"github.com/weblazy/core/collection"
+)
+
+type (
+	// memoryProvider keeps the sessions in a collection.Cache,
+	// the sessions are evicted after maxlifetime without access.
+	memoryProvider struct {
+		cache *collection.Cache
+	}
+
+	memoryStore struct {
+		*values
+	}
+)
+
+// NewMemoryProvider returns a Provider which keeps the sessions in memory.
+func NewMemoryProvider(maxlifetime int64) (Provider, error) {
+	cache, err := collection.NewCache(time.Duration(maxlifetime) * time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	return &memoryProvider{
+		cache: cache,
+	}, nil
+}
+
+func (p *memoryProvider) SessionRead(sid string) (Store, error) {
+	if v, ok := p.cache.Get(sid); ok {
+		// set again to refresh the expiry
+		p.cache.Set(sid, v)
+		return v.(*memoryStore), nil
+	}
+
+	store := &memoryStore{
+		values: newValues(sid, nil),
+	}
+	p.cache.Set(sid, store)
+	return store, nil
+}
+
+func (p *memoryProvider) SessionExist(sid string) (bool, error) {
+	_, ok := p.cache.Get(sid)
+	return ok, nil
+}
+
+func (p *memoryProvider) SessionRegenerate(oldsid, sid string) (Store, error) {
+	store := &memoryStore{}
+	if v, ok := p.cache.Get(oldsid); ok {
+		old := v.(*memoryStore)
+		// copy the values, the old store may still be used by the requests in flight
+		old.lock.RLock()
+		data := make(map[string]interface{}, len(old.data))
+		for key, value := range old.data {
+			data[key] = value
+		}
+		old.lock.RUnlock()
+		store.values = newValues(sid, data)
+		p.cache.Del(oldsid)
+	} else {
+		store.values = newValues(sid, nil)
+	}
+
+	p.cache.Set(sid, store)
+	return store, nil
+}
+
+func (p *memoryProvider) SessionDestroy(sid string) error {
+	p.cache.Del(sid)
+	return nil
+}
+
+// SessionGC does nothing, collection.Cache evicts the expired sessions itself.
+func (p *memoryProvider) SessionGC() {
+}
+
+// SessionRelease does nothing, the values are kept in memory already.
+func (s *memoryStore) SessionRelease() error {
+	return nil
+}
@@ -0,0 +1,111 @@
+package session
+
+import (
+	"github.com/weblazy/core/database/redis"
+)
+
+type (
+	redisProvider struct {
+		store       *redis.Redis
+		keyPrefix   string
+		maxlifetime int64
+	}
+
+	redisStore struct {
+		*values
+		provider *redisProvider
+	}
+)
+
+// NewRedisProvider returns a Provider which keeps the sessions in redis with the keys of keyPrefix+sid,
+// the keys expire after maxlifetime seconds without access.
+func NewRedisProvider(store *redis.Redis, keyPrefix string, maxlifetime int64) Provider {
+	return &redisProvider{
+		store:       store,
+		keyPrefix:   keyPrefix,
+		maxlifetime: maxlifetime,
+	}
+}
+
+func (p *redisProvider) SessionRead(sid string) (Store, error) {
+	if !validSessionId(sid) {
+		return nil, ErrInvalidSessionId
+	}
+
+	content, err := p.store.Get(p.key(sid))
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := decodeValues([]byte(content))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(content) > 0 {
+		if err = p.store.Expire(p.key(sid), int(p.maxlifetime)); err != nil {
+			return nil, err
+		}
+	}
+
+	return &redisStore{
+		values:   newValues(sid, data),
+		provider: p,
+	}, nil
+}
+
+func (p *redisProvider) SessionExist(sid string) (bool, error) {
+	if !validSessionId(sid) {
+		return false, nil
+	}
+
+	return p.store.Exists(p.key(sid))
+}
+
+func (p *redisProvider) SessionRegenerate(oldsid, sid string) (Store, error) {
+	store, err := p.SessionRead(oldsid)
+	if err != nil {
+		return nil, err
+	}
+
+	newStore := &redisStore{
+		values:   newValues(sid, store.(*redisStore).data),
+		provider: p,
+	}
+	if err = newStore.SessionRelease(); err != nil {
+		return nil, err
+	}
+
+	if err = p.SessionDestroy(oldsid); err != nil {
+		return nil, err
+	}
+
+	return newStore, nil
+}
+
+func (p *redisProvider) SessionDestroy(sid string) error {
+	if !validSessionId(sid) {
+		return ErrInvalidSessionId
+	}
+
+	_, err := p.store.Del(p.key(sid))
+	return err
+}
+
+// SessionGC does nothing, redis expires the keys itself.
+func (p *redisProvider) SessionGC() {
+}
+
+func (p *redisProvider) key(sid string) string {
+	return p.keyPrefix + sid
+}
+
+// SessionRelease writes the values to redis, and refreshes the expiry.
+func (s *redisStore) SessionRelease() error {
+	content, err := s.encode()
+	if err != nil {
+		return err
+	}
+
+	return s.provider.store.Setex(s.provider.key(s.sid), string(content), int(s.provider.maxlifetime))
+}
@@ -0,0 +1,355 @@
+package session
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/weblazy/core/config"
+	"github.com/weblazy/core/database/redis"
+	"github.com/weblazy/core/logx"
+	"github.com/weblazy/core/syncx"
+	"github.com/weblazy/core/threading"
+	"github.com/weblazy/core/timex"
+)
+
+const (
+	MemoryProvider = "memory"
+	FileProvider   = "file"
+	RedisProvider  = "redis"
+
+	defaultCookieName  = "sessionid"
+	defaultHeaderName  = "Session-Id"
+	defaultMaxLifetime = 3600
+	defaultGCLifetime  = 60
+	defaultSavePath    = "sessions"
+	defaultKeyPrefix   = "session:"
+	sidBytes           = 16
+)
+
+var ErrInvalidSessionId = errors.New("invalid session id")
+
+type (
+	// Store is the session of a client, the changes are persisted by SessionRelease.
+	Store interface {
+		Set(key string, value interface{}) error
+		Get(key string) interface{}
+		Delete(key string) error
+		SessionID() string
+		Flush() error
+		SessionRelease() error
+	}
+
+	// Provider keeps the sessions.
+	Provider interface {
+		SessionRead(sid string) (Store, error)
+		SessionExist(sid string) (bool, error)
+		SessionRegenerate(oldsid, sid string) (Store, error)
+		SessionDestroy(sid string) error
+		SessionGC()
+	}
+
+	// Manager reads and writes the sessions of the requests.
+	Manager struct {
+		provider Provider
+		config   config.SessionConfig
+		done     *syncx.DoneChan
+	}
+
+	// values is the base of the stores, providers persist the values on SessionRelease.
+	values struct {
+		sid  string
+		lock sync.RWMutex
+		data map[string]interface{}
+	}
+)
+
+// NewManager returns a Manager with the provider named in c, the expired sessions are cleaned up
+// every GCLifetime seconds until the Manager is closed.
+func NewManager(c config.SessionConfig) (*Manager, error) {
+	c = fillDefaults(c)
+
+	var provider Provider
+	switch c.Provider {
+	case MemoryProvider:
+		p, err := NewMemoryProvider(c.MaxLifetime)
+		if err != nil {
+			return nil, err
+		}
+		provider = p
+	case FileProvider:
+		provider = NewFileProvider(c.SavePath, c.MaxLifetime)
+	case RedisProvider:
+		conf := redis.RedisConf(c.Redis)
+		if err := conf.Validate(); err != nil {
+			return nil, err
+		}
+		provider = NewRedisProvider(conf.NewRedis(), c.KeyPrefix, c.MaxLifetime)
+	default:
+		return nil, fmt.Errorf("unknown session provider %q", c.Provider)
+	}
+
+	return NewManagerWithProvider(provider, c), nil
+}
+
+// NewManagerWithProvider returns a Manager with the given provider.
+func NewManagerWithProvider(provider Provider, c config.SessionConfig) *Manager {
+	m := &Manager{
+		provider: provider,
+		config:   fillDefaults(c),
+		done:     syncx.NewDoneChan(),
+	}
+	threading.GoSafe(m.gc)
+	return m
+}
+
+// Close stops cleaning up the expired sessions.
+func (m *Manager) Close() {
+	m.done.Close()
+}
+
+// SessionStart returns the session of the request, a new session is created if the request has no valid one.
+func (m *Manager) SessionStart(w http.ResponseWriter, r *http.Request) (Store, error) {
+	if sid, ok := m.getSid(r); ok {
+		if exist, err := m.provider.SessionExist(sid); err != nil {
+			return nil, err
+		} else if exist {
+			return m.provider.SessionRead(sid)
+		}
+	}
+
+	sid, err := newSessionId()
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := m.provider.SessionRead(sid)
+	if err != nil {
+		return nil, err
+	}
+
+	m.setSid(w, r, sid)
+	return store, nil
+}
+
+// SessionDestroy destroys the session of the request and removes the cookie.
+func (m *Manager) SessionDestroy(w http.ResponseWriter, r *http.Request) error {
+	sid, ok := m.getSid(r)
+	if !ok {
+		return nil
+	}
+
+	if err := m.provider.SessionDestroy(sid); err != nil {
+		return err
+	}
+
+	if m.config.EnableSidInHTTPHeader {
+		r.Header.Del(m.config.SessionNameInHTTPHeader)
+		w.Header().Del(m.config.SessionNameInHTTPHeader)
+	} else {
+		http.SetCookie(w, &http.Cookie{
+			Name:     m.config.CookieName,
+			Path:     "/",
+			HttpOnly: true,
+			Expires:  time.Unix(1, 0),
+			MaxAge:   -1,
+		})
+	}
+
+	return nil
+}
+
+// SessionRegenerateID moves the session of the request to a new session id,
+// it should be called on privilege changes like login to prevent session fixation.
+func (m *Manager) SessionRegenerateID(w http.ResponseWriter, r *http.Request) (Store, error) {
+	sid, err := newSessionId()
+	if err != nil {
+		return nil, err
+	}
+
+	var store Store
+	if oldsid, ok := m.getSid(r); ok {
+		store, err = m.provider.SessionRegenerate(oldsid, sid)
+	} else {
+		store, err = m.provider.SessionRead(sid)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m.setSid(w, r, sid)
+	return store, nil
+}
+
+func (m *Manager) gc() {
+	ticker := timex.NewRealTicker(time.Duration(m.config.GCLifetime) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.Chan():
+			m.provider.SessionGC()
+		case <-m.done.Done():
+			return
+		}
+	}
+}
+
+func (m *Manager) getSid(r *http.Request) (string, bool) {
+	var sid string
+	if m.config.EnableSidInHTTPHeader {
+		sid = r.Header.Get(m.config.SessionNameInHTTPHeader)
+	} else if cookie, err := r.Cookie(m.config.CookieName); err == nil {
+		sid, _ = url.QueryUnescape(cookie.Value)
+	}
+
+	return sid, validSessionId(sid)
+}
+
+func (m *Manager) setSid(w http.ResponseWriter, r *http.Request, sid string) {
+	if m.config.EnableSidInHTTPHeader {
+		r.Header.Set(m.config.SessionNameInHTTPHeader, sid)
+		w.Header().Set(m.config.SessionNameInHTTPHeader, sid)
+		return
+	}
+
+	cookie := &http.Cookie{
+		Name:     m.config.CookieName,
+		Value:    url.QueryEscape(sid),
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   m.config.Secure || r.TLS != nil,
+		Domain:   m.config.Domain,
+	}
+	if m.config.CookieLifetime > 0 {
+		cookie.MaxAge = m.config.CookieLifetime
+		cookie.Expires = time.Now().Add(time.Duration(m.config.CookieLifetime) * time.Second)
+	}
+	http.SetCookie(w, cookie)
+	r.AddCookie(cookie)
+}
+
+func newValues(sid string, data map[string]interface{}) *values {
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+
+	return &values{
+		sid:  sid,
+		data: data,
+	}
+}
+
+func (v *values) Set(key string, value interface{}) error {
+	v.lock.Lock()
+	v.data[key] = value
+	v.lock.Unlock()
+	return nil
+}
+
+func (v *values) Get(key string) interface{} {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	return v.data[key]
+}
+
+func (v *values) Delete(key string) error {
+	v.lock.Lock()
+	delete(v.data, key)
+	v.lock.Unlock()
+	return nil
+}
+
+func (v *values) SessionID() string {
+	return v.sid
+}
+
+func (v *values) Flush() error {
+	v.lock.Lock()
+	v.data = make(map[string]interface{})
+	v.lock.Unlock()
+	return nil
+}
+
+func (v *values) encode() ([]byte, error) {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	return encodeValues(v.data)
+}
+
+// encodeValues encodes the session values by gob,
+// the custom types saved in sessions must be registered by gob.Register.
+func encodeValues(data map[string]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(data); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func decodeValues(content []byte) (map[string]interface{}, error) {
+	data := make(map[string]interface{})
+	if len(content) == 0 {
+		return data, nil
+	}
+
+	if err := gob.NewDecoder(bytes.NewReader(content)).Decode(&data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func fillDefaults(c config.SessionConfig) config.SessionConfig {
+	if len(c.Provider) == 0 {
+		c.Provider = MemoryProvider
+	}
+	if len(c.CookieName) == 0 {
+		c.CookieName = defaultCookieName
+	}
+	if c.MaxLifetime <= 0 {
+		c.MaxLifetime = defaultMaxLifetime
+	}
+	if c.GCLifetime <= 0 {
+		c.GCLifetime = defaultGCLifetime
+	}
+	if len(c.SessionNameInHTTPHeader) == 0 {
+		c.SessionNameInHTTPHeader = defaultHeaderName
+	}
+	if len(c.SavePath) == 0 {
+		c.SavePath = defaultSavePath
+	}
+	if len(c.KeyPrefix) == 0 {
+		c.KeyPrefix = defaultKeyPrefix
+	}
+
+	return c
+}
+
+func newSessionId() (string, error) {
+	b := make([]byte, sidBytes)
+	if _, err := rand.Read(b); err != nil {
+		logx.Error(err)
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// validSessionId checks the session id from clients, it's used in file paths and redis keys.
+func validSessionId(sid string) bool {
+	if len(sid) != sidBytes*2 {
+		return false
+	}
+
+	_, err := hex.DecodeString(sid)
+	return err == nil
+}
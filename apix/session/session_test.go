@@ -0,0 +1,148 @@
+package session
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/weblazy/core/config"
+	"github.com/weblazy/core/database/redis"
+)
+
+const (
+	testSid    = "0123456789abcdef0123456789abcdef"
+	testNewSid = "fedcba9876543210fedcba9876543210"
+)
+
+func TestMemoryProvider(t *testing.T) {
+	p, err := NewMemoryProvider(3600)
+	assert.Nil(t, err)
+	testProvider(t, p)
+
+	// the regenerated store doesn't share the values with the old one
+	old, err := p.SessionRead(testSid)
+	assert.Nil(t, err)
+	assert.Nil(t, old.Set("user", "kevin"))
+	store, err := p.SessionRegenerate(testSid, testNewSid)
+	assert.Nil(t, err)
+	assert.Nil(t, old.Set("user", "bob"))
+	assert.Equal(t, "kevin", store.Get("user"))
+	assert.Nil(t, p.SessionDestroy(testNewSid))
+}
+
+func TestFileProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "session")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	p := NewFileProvider(dir, 3600)
+	testProvider(t, p)
+
+	store, err := p.SessionRead(testSid)
+	assert.Nil(t, err)
+	assert.Nil(t, store.SessionRelease())
+	file := filepath.Join(dir, testSid[0:1], testSid[1:2], testSid)
+	past := time.Now().Add(-time.Hour * 2)
+	assert.Nil(t, os.Chtimes(file, past, past))
+	exist, err := p.SessionExist(testSid)
+	assert.Nil(t, err)
+	assert.False(t, exist)
+	p.SessionGC()
+	_, err = os.Stat(file)
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = p.SessionRead("../../etc/passwd")
+	assert.Equal(t, ErrInvalidSessionId, err)
+}
+
+func TestRedisProvider(t *testing.T) {
+	s, err := miniredis.Run()
+	assert.Nil(t, err)
+	defer s.Close()
+
+	p := NewRedisProvider(redis.NewRedis(s.Addr(), redis.NodeType), defaultKeyPrefix, 3600)
+	testProvider(t, p)
+
+	store, err := p.SessionRead(testSid)
+	assert.Nil(t, err)
+	assert.Nil(t, store.Set("user", "kevin"))
+	assert.Nil(t, store.SessionRelease())
+	assert.Equal(t, time.Hour, s.TTL(defaultKeyPrefix+testSid))
+	s.FastForward(time.Hour)
+	exist, err := p.SessionExist(testSid)
+	assert.Nil(t, err)
+	assert.False(t, exist)
+}
+
+func TestManagerClose(t *testing.T) {
+	p := &gcProvider{gcs: make(chan struct{}, 1)}
+	m := NewManagerWithProvider(p, config.SessionConfig{GCLifetime: 1})
+	select {
+	case <-p.gcs:
+	case <-time.After(time.Second * 3):
+		t.Fatal("no gc")
+	}
+
+	m.Close()
+	// drain the gc which may have raced with Close
+	select {
+	case <-p.gcs:
+	default:
+	}
+	select {
+	case <-p.gcs:
+		t.Fatal("gc after close")
+	case <-time.After(time.Millisecond * 1500):
+	}
+}
+
+func testProvider(t *testing.T, p Provider) {
+	exist, err := p.SessionExist(testSid)
+	assert.Nil(t, err)
+	assert.False(t, exist)
+
+	store, err := p.SessionRead(testSid)
+	assert.Nil(t, err)
+	assert.Equal(t, testSid, store.SessionID())
+	assert.Nil(t, store.Set("user", "kevin"))
+	assert.Nil(t, store.Set("age", 18))
+	assert.Nil(t, store.Delete("age"))
+	assert.Nil(t, store.SessionRelease())
+
+	store, err = p.SessionRead(testSid)
+	assert.Nil(t, err)
+	assert.Equal(t, "kevin", store.Get("user"))
+	assert.Nil(t, store.Get("age"))
+
+	store, err = p.SessionRegenerate(testSid, testNewSid)
+	assert.Nil(t, err)
+	assert.Equal(t, testNewSid, store.SessionID())
+	assert.Equal(t, "kevin", store.Get("user"))
+	exist, err = p.SessionExist(testSid)
+	assert.Nil(t, err)
+	assert.False(t, exist)
+	exist, err = p.SessionExist(testNewSid)
+	assert.Nil(t, err)
+	assert.True(t, exist)
+
+	assert.Nil(t, p.SessionDestroy(testNewSid))
+	exist, err = p.SessionExist(testNewSid)
+	assert.Nil(t, err)
+	assert.False(t, exist)
+}
+
+type gcProvider struct {
+	Provider
+	gcs chan struct{}
+}
+
+func (p *gcProvider) SessionGC() {
+	select {
+	case p.gcs <- struct{}{}:
+	default:
+	}
+}
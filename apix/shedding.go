@@ -0,0 +1,55 @@
+package apix
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/weblazy/core/load"
+)
+
+const serviceType = "http"
+
+var (
+	sheddingStat *load.SheddingStat
+	sheddingLock sync.Mutex
+)
+
+// SheddingFilter returns a BeforeExec filter that sheds the requests with 503 if the server is overloaded,
+// every route has its own shedder created with opts, keyed by the http method and the route pattern.
+// The shedders drop the requests on overloading, load.WithDropping is not needed.
+// The responses with 5xx status are reported as failures to the shedders.
+func SheddingFilter(opts ...load.ShedderOption) FilterFunc {
+	opts = append([]load.ShedderOption{load.WithDropping()}, opts...)
+	return sheddingFilter(load.NewShedderGroup(opts...).GetShedder)
+}
+
+func sheddingFilter(getShedder func(key string) load.Shedder) FilterFunc {
+	ensureSheddingStat()
+
+	return func(ctx *Context) {
+		sheddingStat.IncrementTotal()
+		promise, err := getShedder(ctx.R.Method + " " + ctx.Route()).Allow()
+		if err != nil {
+			sheddingStat.IncrementDrop()
+			ctx.AbortWithError(NewHTTPError(http.StatusServiceUnavailable, ""))
+			return
+		}
+
+		ctx.OnFinish(func() {
+			if ctx.W.Status >= http.StatusInternalServerError {
+				promise.Fail()
+			} else {
+				sheddingStat.IncrementPass()
+				promise.Pass()
+			}
+		})
+	}
+}
+
+func ensureSheddingStat() {
+	sheddingLock.Lock()
+	if sheddingStat == nil {
+		sheddingStat = load.NewSheddingStat(serviceType)
+	}
+	sheddingLock.Unlock()
+}
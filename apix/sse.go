@@ -0,0 +1,234 @@
+package apix
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	textEventStream  = "text/event-stream"
+	lastEventIDQuery = "lastEventId"
+)
+
+var (
+	// ErrStreamingUnsupported is returned by Controller.SSE if the response can't be flushed,
+	// e.g. the request is served with the TimeoutHandler.
+	ErrStreamingUnsupported = errors.New("the response doesn't support streaming")
+	// ErrStreamClosed is returned on sending to a closed SSEWriter.
+	ErrStreamClosed = errors.New("the event stream is closed")
+
+	eventFieldReplacer = strings.NewReplacer("\r", "", "\n", "")
+)
+
+type (
+	// Event is a server-sent event.
+	Event struct {
+		// ID is sent back by the client in the Last-Event-ID header on reconnection.
+		ID string
+		// Event is the event type, the client dispatches the message event if empty.
+		Event string
+		// Data is written as it is if it's a string or []byte, otherwise in json.
+		Data interface{}
+		// Retry tells the client how long to wait before reconnection.
+		Retry time.Duration
+	}
+
+	// SSEWriter writes the server-sent events, the writes are safe to be called concurrently.
+	SSEWriter struct {
+		w           http.ResponseWriter
+		flusher     http.Flusher
+		ctx         context.Context
+		lastEventID string
+		lock        sync.Mutex
+		done        chan struct{}
+		closed      bool
+	}
+)
+
+// SSE starts the event stream of the request, the action sends the events until it returns,
+// or until the client disconnects, which is told by Done and the errors of Send.
+// The route must be exempted from TimeoutFilter by StreamingFilter, or the response is buffered.
+func (c *Controller) SSE() (*SSEWriter, error) {
+	flusher, ok := flusherOf(c.W)
+	if !ok {
+		return nil, ErrStreamingUnsupported
+	}
+
+	header := c.W.Header()
+	header.Set("Content-Type", textEventStream+charsetUTF8)
+	header.Set("Cache-Control", "no-cache")
+	// disable the response buffering of nginx
+	header.Set("X-Accel-Buffering", "no")
+	c.W.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	c.EnableRender = false
+
+	lastEventID := c.R.Header.Get("Last-Event-ID")
+	if len(lastEventID) == 0 {
+		// the EventSource polyfills pass it in the query
+		lastEventID = c.R.URL.Query().Get(lastEventIDQuery)
+	}
+
+	s := &SSEWriter{
+		w:           c.W,
+		flusher:     flusher,
+		ctx:         c.R.Context(),
+		lastEventID: lastEventID,
+		done:        make(chan struct{}),
+	}
+	if c.Ctx != nil {
+		c.Ctx.OnFinish(s.Close)
+	}
+	go func() {
+		select {
+		case <-s.ctx.Done():
+			s.Close()
+		case <-s.done:
+		}
+	}()
+
+	return s, nil
+}
+
+// LastEventID returns the id of the last event received by the client before reconnection,
+// the events after it should be sent to resume the stream.
+func (s *SSEWriter) LastEventID() string {
+	return s.lastEventID
+}
+
+// Done is closed when the client disconnects or the writer is closed.
+func (s *SSEWriter) Done() <-chan struct{} {
+	return s.done
+}
+
+// Send writes the event and flushes it to the client.
+func (s *SSEWriter) Send(event Event) error {
+	data, err := eventData(event.Data)
+	if err != nil {
+		return err
+	}
+
+	var buf strings.Builder
+	if len(event.ID) > 0 {
+		buf.WriteString("id: " + eventFieldReplacer.Replace(event.ID) + "\n")
+	}
+	if len(event.Event) > 0 {
+		buf.WriteString("event: " + eventFieldReplacer.Replace(event.Event) + "\n")
+	}
+	if event.Retry > 0 {
+		buf.WriteString("retry: " + strconv.FormatInt(int64(event.Retry/time.Millisecond), 10) + "\n")
+	}
+	for _, line := range strings.Split(strings.Replace(data, "\r\n", "\n", -1), "\n") {
+		buf.WriteString("data: " + line + "\n")
+	}
+	buf.WriteString("\n")
+
+	return s.write(buf.String())
+}
+
+// SendData sends an event with data only.
+func (s *SSEWriter) SendData(data interface{}) error {
+	return s.Send(Event{
+		Data: data,
+	})
+}
+
+// Comment writes a comment line, which is ignored by the clients but keeps the connection alive.
+func (s *SSEWriter) Comment(text string) error {
+	var buf strings.Builder
+	for _, line := range strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n") {
+		buf.WriteString(": " + line + "\n")
+	}
+	buf.WriteString("\n")
+
+	return s.write(buf.String())
+}
+
+// Heartbeat writes a comment every interval until the stream is done,
+// to keep the idle connection open through the proxies.
+func (s *SSEWriter) Heartbeat(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.Comment("heartbeat"); err != nil {
+					return
+				}
+			case <-s.done:
+				return
+			}
+		}
+	}()
+}
+
+// Close ends the stream, the following sends return ErrStreamClosed.
+// It's called when the request finishes.
+func (s *SSEWriter) Close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+}
+
+func (s *SSEWriter) write(content string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return ErrStreamClosed
+	}
+	if err := s.ctx.Err(); err != nil {
+		// the client is gone
+		s.closed = true
+		close(s.done)
+		return err
+	}
+
+	if _, err := fmt.Fprint(s.w, content); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// flusherOf returns the flusher of w, the Response wrapping a writer unable to flush is not taken.
+func flusherOf(w http.ResponseWriter) (http.Flusher, bool) {
+	if resp, ok := w.(*Response); ok {
+		if _, ok := flusherOf(resp.ResponseWriter); !ok {
+			return nil, false
+		}
+	}
+
+	flusher, ok := w.(http.Flusher)
+	return flusher, ok
+}
+
+func eventData(data interface{}) (string, error) {
+	switch v := data.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	default:
+		content, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(content), nil
+	}
+}
@@ -0,0 +1,138 @@
+package apix
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var sseStopped = make(chan struct{}, 1)
+
+type sseTestController struct {
+	Controller
+}
+
+func (c *sseTestController) Events() error {
+	s, err := c.SSE()
+	if err != nil {
+		return err
+	}
+
+	start, _ := strconv.Atoi(s.LastEventID())
+	for i := start + 1; i <= start+2; i++ {
+		// longer than the timeout of the route
+		time.Sleep(time.Millisecond * 20)
+		if err := s.Send(Event{
+			ID:    strconv.Itoa(i),
+			Event: "tick",
+			Data:  map[string]int{"n": i},
+		}); err != nil {
+			return err
+		}
+	}
+	return s.Comment("bye\nnow")
+}
+
+func (c *sseTestController) Forever() error {
+	s, err := c.SSE()
+	if err != nil {
+		return err
+	}
+
+	s.Heartbeat(time.Millisecond * 5)
+	<-s.Done()
+	sseStopped <- struct{}{}
+	return nil
+}
+
+func (c *sseTestController) Slow() {
+	time.Sleep(time.Millisecond * 50)
+	c.W.Write([]byte("done"))
+}
+
+func TestSSE(t *testing.T) {
+	mux := NewControllerRegister()
+	assert.Nil(t, mux.Add("/events", &sseTestController{}, "get:Events"))
+	assert.Nil(t, mux.Add("/timed-events", &sseTestController{}, "get:Events"))
+	assert.Nil(t, mux.Add("/forever", &sseTestController{}, "get:Forever"))
+	assert.Nil(t, mux.Add("/slow", &sseTestController{}, "get:Slow"))
+	assert.Nil(t, mux.InsertFilter("/*", BeforeRouter, TimeoutFilter(time.Millisecond*10)))
+	assert.Nil(t, mux.InsertFilter("/events", BeforeRouter, StreamingFilter()))
+	assert.Nil(t, mux.InsertFilter("/forever", BeforeExec, StreamingFilter()))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/events", nil)
+	req.Header.Set("Accept", textEventStream)
+	req.Header.Set("Last-Event-ID", "3")
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, textEventStream+charsetUTF8, resp.Header.Get("Content-Type"))
+
+	var body strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		body.WriteString(scanner.Text() + "\n")
+	}
+	assert.Equal(t, "id: 4\nevent: tick\ndata: {\"n\":4}\n\n"+
+		"id: 5\nevent: tick\ndata: {\"n\":5}\n\n"+
+		": bye\n: now\n\n", body.String())
+
+	// without StreamingFilter, the response is buffered by the TimeoutHandler
+	// and the requests accepting the event stream still time out
+	req, _ = http.NewRequest(http.MethodGet, server.URL+"/timed-events", nil)
+	req.Header.Set("Accept", textEventStream)
+	resp, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	req, _ = http.NewRequest(http.MethodGet, server.URL+"/slow", nil)
+	req.Header.Set("Accept", textEventStream)
+	resp, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	// the stream stops when the client disconnects
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ = http.NewRequest(http.MethodGet, server.URL+"/forever", nil)
+	req.Header.Set("Accept", textEventStream)
+	resp, err = http.DefaultClient.Do(req.WithContext(ctx))
+	assert.Nil(t, err)
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, ": heartbeat\n", line)
+	cancel()
+	resp.Body.Close()
+	select {
+	case <-sseStopped:
+	case <-time.After(time.Second):
+		t.Fatal("stream not stopped")
+	}
+}
+
+func TestSSEUnsupported(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/events", nil)
+	// hides the Flush of the recorder
+	w := struct {
+		http.ResponseWriter
+	}{httptest.NewRecorder()}
+
+	c := &Controller{BaseController: BaseController{R: r, W: &Response{ResponseWriter: w}}}
+	_, err := c.SSE()
+	assert.Equal(t, ErrStreamingUnsupported, err)
+
+	c = &Controller{BaseController: BaseController{R: r, W: &Response{ResponseWriter: httptest.NewRecorder()}}}
+	s, err := c.SSE()
+	assert.Nil(t, err)
+	s.Close()
+}
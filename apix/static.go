@@ -0,0 +1,360 @@
+package apix
+
+import (
+	"fmt"
+	"html/template"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/weblazy/core/config"
+	"github.com/weblazy/core/logx"
+)
+
+const (
+	indexFile   = "index.html"
+	gzipSuffix  = ".gz"
+	faviconPath = "/favicon.ico"
+	robotsPath  = "/robots.txt"
+	defaultIcon = "default.png"
+)
+
+var dirListTemplate = template.Must(template.New("dir").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Index of {{.Path}}</title></head>
+<body>
+<h1>Index of {{.Path}}</h1>
+<ul>
+{{- if .Parent}}
+<li><a href="../">../</a></li>
+{{- end}}
+{{- range .Entries}}
+<li><a href="{{.URL}}">{{.Name}}</a></li>
+{{- end}}
+</ul>
+</body>
+</html>
+`))
+
+type (
+	staticDir struct {
+		prefix string
+		conf   config.StaticConfig
+		// the real path of conf.Dir, the symlinks must not lead out of it
+		root string
+	}
+
+	dirEntry struct {
+		Name string
+		URL  string
+	}
+)
+
+// SetStaticPath serves the files in dir under the url prefix with the default ControllerRegister.
+func SetStaticPath(prefix, dir string) {
+	if err := defaultRegister.AddStatic(config.StaticConfig{
+		Prefix: prefix,
+		Dir:    dir,
+	}); err != nil {
+		logx.Fatal(err)
+	}
+}
+
+// AddStatic serves the files of conf.Dir under conf.Prefix, the longest prefix takes precedence.
+// The files are served with ETag and Last-Modified, and support the conditional and range requests,
+// file.gz is served instead of file with Content-Encoding gzip if it exists and the client accepts gzip.
+// The requests of missing files are passed to the controllers, unless conf.SPA is set.
+// The hidden files like .git are not served unless conf.AllowHidden is set,
+// and the symlinks leading out of conf.Dir are not followed.
+func (p *ControllerRegister) AddStatic(conf config.StaticConfig) error {
+	if len(conf.Prefix) == 0 || conf.Prefix[0] != '/' {
+		return fmt.Errorf("static prefix %q must begin with '/'", conf.Prefix)
+	}
+
+	info, err := os.Stat(conf.Dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("static path %s is not a directory", conf.Dir)
+	}
+	root, err := filepath.EvalSymlinks(conf.Dir)
+	if err != nil {
+		return err
+	}
+	if root, err = filepath.Abs(root); err != nil {
+		return err
+	}
+
+	prefix := strings.TrimSuffix(conf.Prefix, "/")
+	for _, dir := range p.statics {
+		if dir.prefix == prefix {
+			return fmt.Errorf("static prefix %s conflicts with %s", conf.Prefix, dir.conf.Prefix)
+		}
+	}
+
+	p.statics = append(p.statics, &staticDir{
+		prefix: prefix,
+		conf:   conf,
+		root:   root,
+	})
+	sort.Slice(p.statics, func(i, j int) bool {
+		return len(p.statics[i].prefix) > len(p.statics[j].prefix)
+	})
+
+	return nil
+}
+
+// hasStatic tells whether the static directory of conf is added already.
+func (p *ControllerRegister) hasStatic(conf config.StaticConfig) bool {
+	for _, dir := range p.statics {
+		if dir.conf == conf {
+			return true
+		}
+	}
+
+	return false
+}
+
+// serveStatic serves the static file of the request, and returns true if the request is served.
+func (p *ControllerRegister) serveStatic(ctx *Context) bool {
+	r := ctx.R
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	urlPath := r.URL.Path
+	if urlPath == faviconPath || urlPath == robotsPath {
+		if serveLegacyFile(ctx, urlPath) {
+			return true
+		}
+	}
+
+	for _, dir := range p.statics {
+		if urlPath != dir.prefix && !strings.HasPrefix(urlPath, dir.prefix+"/") {
+			continue
+		}
+
+		return dir.serve(ctx, strings.TrimPrefix(urlPath, dir.prefix))
+	}
+
+	return false
+}
+
+func (d *staticDir) serve(ctx *Context, name string) bool {
+	// path.Clean on a rooted path removes all the .. elements
+	name = path.Clean("/" + name)
+	if !d.conf.AllowHidden && hasHiddenSegment(name) {
+		return d.serveFallback(ctx)
+	}
+
+	file := filepath.Join(d.conf.Dir, filepath.FromSlash(name))
+	info, err := os.Stat(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logx.Error(err)
+		}
+		return d.serveFallback(ctx)
+	}
+	if !d.contains(file) {
+		return d.serveFallback(ctx)
+	}
+
+	if info.IsDir() {
+		if !strings.HasSuffix(ctx.R.URL.Path, "/") {
+			redirectToDir(ctx)
+			return true
+		}
+
+		index := filepath.Join(file, indexFile)
+		if indexInfo, err := os.Stat(index); err == nil && !indexInfo.IsDir() && d.contains(index) {
+			d.serveFile(ctx, index, indexInfo)
+			return true
+		}
+		if d.conf.ListDir {
+			listDir(ctx, file, name != "/", d.conf.AllowHidden)
+			return true
+		}
+
+		return d.serveFallback(ctx)
+	}
+
+	d.serveFile(ctx, file, info)
+	return true
+}
+
+// serveFallback serves the index.html of the single page app, and returns false if not a spa.
+func (d *staticDir) serveFallback(ctx *Context) bool {
+	if !d.conf.SPA {
+		return false
+	}
+
+	index := filepath.Join(d.conf.Dir, indexFile)
+	info, err := os.Stat(index)
+	if err != nil || info.IsDir() || !d.contains(index) {
+		return false
+	}
+
+	d.serveFile(ctx, index, info)
+	return true
+}
+
+func (d *staticDir) serveFile(ctx *Context, file string, info os.FileInfo) {
+	if d.conf.MaxAge > 0 {
+		ctx.W.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(d.conf.MaxAge))
+	}
+	serveFile(ctx, file, info, d.contains)
+}
+
+// contains tells whether file is in the directory after following the symlinks.
+func (d *staticDir) contains(file string) bool {
+	real, err := filepath.EvalSymlinks(file)
+	if err != nil {
+		return false
+	}
+	if real, err = filepath.Abs(real); err != nil {
+		return false
+	}
+
+	rel, err := filepath.Rel(d.root, real)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// serveFile serves file with ETag and Last-Modified, file.gz is preferred if the client accepts gzip,
+// and allowed by allowGzip if not nil.
+func serveFile(ctx *Context, file string, info os.FileInfo, allowGzip func(string) bool) {
+	header := ctx.W.Header()
+	if contentType := mime.TypeByExtension(filepath.Ext(file)); len(contentType) > 0 {
+		header.Set("Content-Type", contentType)
+	}
+
+	if gzInfo, err := os.Stat(file + gzipSuffix); err == nil && !gzInfo.IsDir() &&
+		(allowGzip == nil || allowGzip(file+gzipSuffix)) {
+		header.Add("Vary", "Accept-Encoding")
+		if acceptsGzip(ctx.R) {
+			file, info = file+gzipSuffix, gzInfo
+			header.Set("Content-Encoding", "gzip")
+			if len(header.Get("Content-Type")) == 0 {
+				// don't let http.ServeContent sniff the compressed content
+				header.Set("Content-Type", "application/octet-stream")
+			}
+		}
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		writeError(ctx.W, ctx.R, err)
+		return
+	}
+	defer f.Close()
+
+	header.Set("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+	// http.ServeContent handles If-None-Match, If-Modified-Since, Range and Last-Modified
+	http.ServeContent(ctx.W, ctx.R, info.Name(), info.ModTime(), f)
+}
+
+// serveLegacyFile serves favicon.ico and robots.txt in the ImagePath of the config,
+// a missing favicon.ico falls back to default.png.
+func serveLegacyFile(ctx *Context, urlPath string) bool {
+	imagePath := stateOf(ctx.R).conf.ImagePath
+	if len(imagePath) == 0 {
+		return false
+	}
+
+	candidates := []string{filepath.Join(imagePath, path.Base(urlPath))}
+	if urlPath == faviconPath {
+		candidates = append(candidates, filepath.Join(imagePath, defaultIcon))
+	}
+	for _, file := range candidates {
+		if info, err := os.Stat(file); err == nil && !info.IsDir() {
+			serveFile(ctx, file, info, nil)
+			return true
+		}
+	}
+
+	return false
+}
+
+func listDir(ctx *Context, dir string, parent, hidden bool) {
+	f, err := os.Open(dir)
+	if err != nil {
+		writeError(ctx.W, ctx.R, err)
+		return
+	}
+	defer f.Close()
+
+	infos, err := f.Readdir(-1)
+	if err != nil {
+		writeError(ctx.W, ctx.R, err)
+		return
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
+
+	entries := make([]dirEntry, 0, len(infos))
+	for _, info := range infos {
+		name := info.Name()
+		if !hidden && strings.HasPrefix(name, ".") {
+			continue
+		}
+		if info.IsDir() {
+			name += "/"
+		}
+		entries = append(entries, dirEntry{
+			Name: name,
+			URL:  (&url.URL{Path: name}).String(),
+		})
+	}
+
+	ctx.W.Header().Set("Content-Type", textHTML+charsetUTF8)
+	if err := dirListTemplate.Execute(ctx.W, map[string]interface{}{
+		"Path":    ctx.R.URL.Path,
+		"Parent":  parent,
+		"Entries": entries,
+	}); err != nil {
+		logx.Error(err)
+	}
+}
+
+// redirectToDir redirects to the directory path ending with slash, relative to the request path,
+// since the request path like //evil.com/.. makes an open redirect.
+func redirectToDir(ctx *Context) {
+	target := (&url.URL{Path: path.Base(ctx.R.URL.Path) + "/"}).String()
+	if len(ctx.R.URL.RawQuery) > 0 {
+		target += "?" + ctx.R.URL.RawQuery
+	}
+	http.Redirect(ctx.W, ctx.R, target, http.StatusMovedPermanently)
+}
+
+// hasHiddenSegment tells whether any segment of the slash separated name begins with a dot.
+func hasHiddenSegment(name string) bool {
+	for _, segment := range strings.Split(name, "/") {
+		if strings.HasPrefix(segment, ".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		fields := strings.SplitN(strings.TrimSpace(part), ";", 2)
+		if strings.TrimSpace(fields[0]) != "gzip" {
+			continue
+		}
+		if len(fields) == 2 && strings.Replace(fields[1], " ", "", -1) == "q=0" {
+			return false
+		}
+		return true
+	}
+
+	return false
+}
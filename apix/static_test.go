@@ -0,0 +1,114 @@
+package apix
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/weblazy/core/config"
+)
+
+func TestServeStatic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apix")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "app", "assets"), 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "app", "index.html"), []byte("<html>app</html>"), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "app", "assets", "app.js"), []byte("0123456789"), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "app", "assets", "app.js.gz"), []byte("gzipped"), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0644))
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "app", ".git"), 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "app", ".git", "config"), []byte("git"), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "app", ".env"), []byte("env"), 0644))
+	assert.Nil(t, os.Symlink(filepath.Join(dir, "secret.txt"), filepath.Join(dir, "app", "leak.txt")))
+	assert.Nil(t, os.Symlink(filepath.Join(dir, "app", "assets", "app.js"), filepath.Join(dir, "app", "link.js")))
+
+	mux := NewControllerRegister()
+	assert.Nil(t, mux.Add("/static/api", &filterTestController{}))
+	assert.NotNil(t, mux.AddStatic(config.StaticConfig{Prefix: "static", Dir: dir}))
+	assert.Nil(t, mux.AddStatic(config.StaticConfig{Prefix: "/static", Dir: filepath.Join(dir, "app"), ListDir: true}))
+	assert.Nil(t, mux.AddStatic(config.StaticConfig{Prefix: "/spa/", Dir: filepath.Join(dir, "app"), SPA: true, MaxAge: 60}))
+	assert.NotNil(t, mux.AddStatic(config.StaticConfig{Prefix: "/spa", Dir: dir}))
+
+	serve := func(path string, headers ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		for i := 0; i+1 < len(headers); i += 2 {
+			r.Header.Set(headers[i], headers[i+1])
+		}
+		w := httptest.NewRecorder()
+		mux.serveHTTP(w, r)
+		return w
+	}
+
+	w := serve("/static/assets/app.js")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0123456789", w.Body.String())
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	assert.NotEmpty(t, w.Header().Get("Last-Modified"))
+
+	w = serve("/static/assets/app.js", "If-None-Match", etag)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	w = serve("/static/assets/app.js", "Range", "bytes=2-4")
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "234", w.Body.String())
+
+	w = serve("/static/assets/app.js", "Accept-Encoding", "br, gzip")
+	assert.Equal(t, "gzipped", w.Body.String())
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Contains(t, w.Header().Get("Content-Type"), "javascript")
+
+	w = serve("/static/assets")
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "/static/assets/", w.Header().Get("Location"))
+
+	w = serve("/static/assets/")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `<a href="app.js">app.js</a>`)
+	w = serve("/static/")
+	assert.NotContains(t, w.Body.String(), ".git")
+	assert.NotContains(t, w.Body.String(), ".env")
+
+	// the redirect is relative, the request path can't lead to other hosts
+	root := NewControllerRegister()
+	assert.Nil(t, root.AddStatic(config.StaticConfig{Prefix: "/", Dir: dir}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.URL.Path = "//evil.com/.."
+	w = httptest.NewRecorder()
+	root.serveHTTP(w, r)
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.False(t, strings.HasPrefix(w.Header().Get("Location"), "//"))
+
+	// the hidden files and the symlinks out of the directory are not served
+	w = serve("/static/.git/config")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = serve("/static/.env")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = serve("/static/leak.txt")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = serve("/static/link.js")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0123456789", w.Body.String())
+
+	w = serve("/static/../secret.txt")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// missing files are passed to the controllers
+	w = serve("/static/api")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serve("/static/missing.js")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = serve("/spa/users/7")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "<html>app</html>", w.Body.String())
+	assert.Equal(t, "public, max-age=60", w.Header().Get("Cache-Control"))
+}
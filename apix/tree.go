@@ -0,0 +1,271 @@
+package apix
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	paramToken    = ':'
+	wildcardToken = '*'
+)
+
+type (
+	// Tree is a radix tree of url patterns, static parts are compressed by common prefix,
+	// supports named params like /users/:id and trailing wildcards like /files/*path,
+	// a wildcard without name like /files/* matches but doesn't capture.
+	Tree struct {
+		root *node
+	}
+
+	node struct {
+		prefix     string
+		children   []*node
+		paramName  string
+		paramChild *node
+		wildName   string
+		wildChild  *node
+		leaf       interface{}
+		pattern    string
+	}
+
+	param struct {
+		key   string
+		value string
+	}
+)
+
+// NewTree returns a new Tree.
+func NewTree() *Tree {
+	return &Tree{
+		root: new(node),
+	}
+}
+
+// AddRouter registers runObject on the given pattern.
+func (t *Tree) AddRouter(pattern string, runObject interface{}) error {
+	if len(pattern) == 0 || pattern[0] != '/' {
+		return fmt.Errorf("pattern %q must begin with '/'", pattern)
+	}
+
+	n := t.root
+	path := pattern
+	for len(path) > 0 {
+		i := strings.IndexAny(path, ":*")
+		if i < 0 {
+			n = n.insertStatic(path)
+			break
+		}
+
+		if i > 0 {
+			if path[i-1] != '/' {
+				return fmt.Errorf("param in pattern %q must follow a '/'", pattern)
+			}
+			n = n.insertStatic(path[:i])
+		}
+
+		token := path[i]
+		path = path[i+1:]
+		end := strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+		name := path[:end]
+		path = path[end:]
+		if len(name) == 0 && token == paramToken {
+			return fmt.Errorf("param in pattern %q must have a name", pattern)
+		}
+
+		var err error
+		if token == paramToken {
+			n, err = n.insertParam(name, pattern)
+		} else {
+			if len(path) > 0 {
+				return fmt.Errorf("wildcard in pattern %q must be at the end", pattern)
+			}
+			n, err = n.insertWildcard(name, pattern)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if n.leaf != nil {
+		return fmt.Errorf("pattern %q conflicts with %q", pattern, n.pattern)
+	}
+
+	n.leaf = runObject
+	n.pattern = pattern
+	return nil
+}
+
+// Match finds the runObject registered for the given path and the params it captured.
+func (t *Tree) Match(path string) (interface{}, map[string]string) {
+	var params []param
+	leaf := t.root.match(path, &params)
+	if leaf == nil {
+		return nil, nil
+	}
+
+	if len(params) == 0 {
+		return leaf, nil
+	}
+
+	m := make(map[string]string, len(params))
+	for _, p := range params {
+		// unnamed wildcards like /static/* are not captured
+		if len(p.key) > 0 {
+			m[p.key] = p.value
+		}
+	}
+	return leaf, m
+}
+
+func (n *node) insertStatic(path string) *node {
+	for len(path) > 0 {
+		child := n.staticChild(path[0])
+		if child == nil {
+			child = &node{prefix: path}
+			n.addChild(child)
+			return child
+		}
+
+		l := commonPrefixLen(child.prefix, path)
+		if l < len(child.prefix) {
+			child.split(l)
+		}
+		path = path[l:]
+		n = child
+	}
+
+	return n
+}
+
+func (n *node) insertParam(name, pattern string) (*node, error) {
+	if n.paramChild == nil {
+		n.paramName = name
+		n.paramChild = new(node)
+	} else if n.paramName != name {
+		return nil, fmt.Errorf("param :%s in pattern %q conflicts with :%s", name, pattern, n.paramName)
+	}
+
+	return n.paramChild, nil
+}
+
+func (n *node) insertWildcard(name, pattern string) (*node, error) {
+	if n.wildChild == nil {
+		n.wildName = name
+		n.wildChild = new(node)
+	} else if n.wildName != name {
+		return nil, fmt.Errorf("wildcard *%s in pattern %q conflicts with *%s", name, pattern, n.wildName)
+	}
+
+	return n.wildChild, nil
+}
+
+// match looks up path below n, static children take precedence over params,
+// and params take precedence over wildcards.
+func (n *node) match(path string, params *[]param) interface{} {
+	if len(path) == 0 && n.leaf != nil {
+		return n.leaf
+	}
+
+	if len(path) > 0 {
+		if child := n.staticChild(path[0]); child != nil && strings.HasPrefix(path, child.prefix) {
+			if leaf := child.match(path[len(child.prefix):], params); leaf != nil {
+				return leaf
+			}
+		}
+	}
+
+	if n.paramChild != nil && len(path) > 0 {
+		end := strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+		if end > 0 {
+			*params = append(*params, param{key: n.paramName, value: path[:end]})
+			if leaf := n.paramChild.match(path[end:], params); leaf != nil {
+				return leaf
+			}
+			*params = (*params)[:len(*params)-1]
+		}
+	}
+
+	if n.wildChild != nil && n.wildChild.leaf != nil {
+		*params = append(*params, param{key: n.wildName, value: path})
+		return n.wildChild.leaf
+	}
+
+	return nil
+}
+
+func (n *node) staticChild(c byte) *node {
+	i := sort.Search(len(n.children), func(i int) bool {
+		return n.children[i].prefix[0] >= c
+	})
+	if i < len(n.children) && n.children[i].prefix[0] == c {
+		return n.children[i]
+	}
+
+	return nil
+}
+
+func (n *node) addChild(child *node) {
+	n.children = append(n.children, child)
+	sort.Slice(n.children, func(i, j int) bool {
+		return n.children[i].prefix[0] < n.children[j].prefix[0]
+	})
+}
+
+// split breaks n at position i, moving the remainder of its prefix and everything below it into a new child.
+func (n *node) split(i int) {
+	child := &node{
+		prefix:     n.prefix[i:],
+		children:   n.children,
+		paramName:  n.paramName,
+		paramChild: n.paramChild,
+		wildName:   n.wildName,
+		wildChild:  n.wildChild,
+		leaf:       n.leaf,
+		pattern:    n.pattern,
+	}
+	*n = node{
+		prefix:   n.prefix[:i],
+		children: []*node{child},
+	}
+}
+
+func commonPrefixLen(a, b string) int {
+	max := len(a)
+	if len(b) < max {
+		max = len(b)
+	}
+
+	var i int
+	for i < max && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// Walk calls fn with every pattern registered in the tree and its runObject.
+func (t *Tree) Walk(fn func(pattern string, runObject interface{})) {
+	t.root.walk(fn)
+}
+
+func (n *node) walk(fn func(pattern string, runObject interface{})) {
+	if n.leaf != nil {
+		fn(n.pattern, n.leaf)
+	}
+	for _, child := range n.children {
+		child.walk(fn)
+	}
+	if n.paramChild != nil {
+		n.paramChild.walk(fn)
+	}
+	if n.wildChild != nil {
+		n.wildChild.walk(fn)
+	}
+}
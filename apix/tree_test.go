@@ -0,0 +1,105 @@
+package apix
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTreeMatch(t *testing.T) {
+	tree := NewTree()
+	patterns := []string{
+		"/",
+		"/users",
+		"/users/new",
+		"/users/:id",
+		"/users/:id/orders",
+		"/users/:id/orders/*rest",
+		"/userinfo",
+		"/static/*path",
+	}
+	for _, pattern := range patterns {
+		assert.Nil(t, tree.AddRouter(pattern, pattern))
+	}
+
+	tests := []struct {
+		path    string
+		pattern interface{}
+		params  map[string]string
+	}{
+		{"/", "/", nil},
+		{"/users", "/users", nil},
+		{"/users/new", "/users/new", nil},
+		{"/users/12", "/users/:id", map[string]string{"id": "12"}},
+		{"/users/12/orders", "/users/:id/orders", map[string]string{"id": "12"}},
+		{"/users/12/orders/3/items", "/users/:id/orders/*rest",
+			map[string]string{"id": "12", "rest": "3/items"}},
+		{"/userinfo", "/userinfo", nil},
+		{"/static/css/app.css", "/static/*path", map[string]string{"path": "css/app.css"}},
+		{"/user", nil, nil},
+		{"/users/12/profile", nil, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			pattern, params := tree.Match(test.path)
+			assert.Equal(t, test.pattern, pattern)
+			assert.Equal(t, test.params, params)
+		})
+	}
+}
+
+func TestTreeAddRouterConflict(t *testing.T) {
+	tree := NewTree()
+	assert.Nil(t, tree.AddRouter("/users/:id", 1))
+	assert.NotNil(t, tree.AddRouter("/users/:id", 2))
+	assert.NotNil(t, tree.AddRouter("/users/:name/orders", 3))
+	assert.NotNil(t, tree.AddRouter("/files/*path/more", 4))
+	assert.NotNil(t, tree.AddRouter("users", 5))
+	assert.NotNil(t, tree.AddRouter("/users:id", 6))
+}
+
+type treeTestController struct {
+	Controller
+}
+
+func (c *treeTestController) Show() {
+	c.W.Write([]byte("show " + c.Params["id"]))
+}
+
+func (c *treeTestController) Remove() {
+	c.W.Write([]byte("remove " + c.Params["id"]))
+}
+
+func TestControllerRegisterMethods(t *testing.T) {
+	mux := NewControllerRegister()
+	assert.Nil(t, mux.Add("/users/:id", &treeTestController{}, "get:Show;delete:Remove"))
+	assert.NotNil(t, mux.Add("/users", &treeTestController{}, "get:Missing"))
+	assert.NotNil(t, mux.Add("/users", &treeTestController{}))
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+		body   string
+	}{
+		{http.MethodGet, "/users/7", http.StatusOK, "show 7"},
+		{http.MethodDelete, "/users/7", http.StatusOK, "remove 7"},
+		{http.MethodPost, "/users/7", http.StatusMethodNotAllowed, ""},
+		{http.MethodGet, "/orders/7", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.method+test.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			mux.serveHTTP(w, httptest.NewRequest(test.method, test.path, nil))
+			assert.Equal(t, test.code, w.Code)
+			if test.code == http.StatusOK {
+				assert.Equal(t, test.body, w.Body.String())
+			}
+			if test.code == http.StatusMethodNotAllowed {
+				assert.Equal(t, "DELETE, GET, HEAD", w.Header().Get("Allow"))
+			}
+		})
+	}
+}
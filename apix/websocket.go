@@ -0,0 +1,48 @@
+package apix
+
+import (
+	"net/http"
+
+	"github.com/weblazy/core/apix/websocket"
+)
+
+// WebSocketUpgrader upgrades the requests in Controller.UpgradeWebSocket,
+// replace it to set the subprotocols, the buffer sizes or the origin check.
+var WebSocketUpgrader = &websocket.Upgrader{
+	EnableCompression: true,
+}
+
+// UpgradeWebSocket upgrades the request to websocket, the action serves the connection
+// until it returns, and the connection is closed then.
+// The headers set on c.W by the filters and the session, like Set-Cookie, are sent with the handshake,
+// along with responseHeader. If XSRF is enabled, the handshake must carry the _xsrf argument in the query,
+// since the browsers check no origin on websockets.
+// The route must be exempted from TimeoutFilter by StreamingFilter, or the upgrade fails.
+// The error response is written already if it fails, the action just returns the error.
+func (c *Controller) UpgradeWebSocket(responseHeader http.Header) (*websocket.Conn, error) {
+	if stateOf(c.R).conf.EnableXSRF && !c.CheckXSRFCookie() {
+		return nil, NewHTTPError(http.StatusForbidden, "")
+	}
+
+	header := make(http.Header)
+	for key, values := range c.W.Header() {
+		header[key] = values
+	}
+	for key, values := range responseHeader {
+		header[key] = values
+	}
+
+	conn, err := WebSocketUpgrader.Upgrade(c.W, c.R, header)
+	if err != nil {
+		return nil, err
+	}
+
+	c.EnableRender = false
+	if c.Ctx != nil {
+		c.Ctx.OnFinish(func() {
+			conn.Close()
+		})
+	}
+
+	return conn, nil
+}
@@ -0,0 +1,114 @@
+package websocket
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+const (
+	deflateExtension = "permessage-deflate"
+	// the extension response, every message is compressed on its own without the sliding window
+	// of the previous messages, so that no compression state is kept between the messages.
+	deflateResponse = deflateExtension + "; server_no_context_takeover; client_no_context_takeover"
+)
+
+var (
+	// the tail of the deflate stream removed from the messages, see RFC 7692, section 7.2.1
+	deflateTail = []byte{0x00, 0x00, 0xff, 0xff}
+	// deflateTail and an empty final block, to end the stream of a message when reading
+	deflateEnd = []byte{0x00, 0x00, 0xff, 0xff, 0x01, 0x00, 0x00, 0xff, 0xff}
+
+	flateWriterPool = sync.Pool{
+		New: func() interface{} {
+			w, _ := flate.NewWriter(nil, flate.BestSpeed)
+			return w
+		},
+	}
+	flateReaderPool = sync.Pool{
+		New: func() interface{} {
+			return flate.NewReader(nil)
+		},
+	}
+)
+
+// negotiateDeflate returns the permessage-deflate response to the Sec-WebSocket-Extensions offers,
+// empty if no offer can be accepted.
+func negotiateDeflate(offers []string) string {
+	for _, header := range offers {
+		for _, offer := range strings.Split(header, ",") {
+			params := strings.Split(offer, ";")
+			if strings.TrimSpace(params[0]) != deflateExtension {
+				continue
+			}
+			if acceptableDeflateParams(params[1:]) {
+				return deflateResponse
+			}
+		}
+	}
+
+	return ""
+}
+
+// acceptableDeflateParams tells whether the offer can be served with the full sliding window.
+func acceptableDeflateParams(params []string) bool {
+	for _, param := range params {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		switch strings.TrimSpace(kv[0]) {
+		case "server_no_context_takeover", "client_no_context_takeover", "client_max_window_bits":
+		case "server_max_window_bits":
+			// compress/flate always uses the 32k window
+			if len(kv) != 2 || strings.Trim(strings.TrimSpace(kv[1]), `"`) != "15" {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := flateWriterPool.Get().(*flate.Writer)
+	defer flateWriterPool.Put(w)
+
+	w.Reset(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSuffix(buf.Bytes(), deflateTail), nil
+}
+
+// decompress decompresses the payload of a message, limit is the max decompressed size if positive.
+func decompress(data []byte, limit int64) ([]byte, error) {
+	r := flateReaderPool.Get().(io.ReadCloser)
+	defer flateReaderPool.Put(r)
+
+	if err := r.(flate.Resetter).Reset(io.MultiReader(bytes.NewReader(data),
+		bytes.NewReader(deflateEnd)), nil); err != nil {
+		return nil, err
+	}
+
+	var reader io.Reader = r
+	if limit > 0 {
+		reader = io.LimitReader(r, limit+1)
+	}
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && int64(len(content)) > limit {
+		return nil, ErrReadLimit
+	}
+
+	return content, nil
+}
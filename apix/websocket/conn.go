@@ -0,0 +1,683 @@
+package websocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// the message types, the same as the frame opcodes.
+const (
+	// TextMessage is a utf-8 encoded text message.
+	TextMessage = 1
+	// BinaryMessage is a binary data message.
+	BinaryMessage = 2
+	// CloseMessage is a close control message, with an optional status code and reason.
+	CloseMessage = 8
+	// PingMessage is a ping control message.
+	PingMessage = 9
+	// PongMessage is a pong control message.
+	PongMessage = 10
+
+	continuationFrame = 0
+)
+
+// the close status codes defined in RFC 6455, section 7.4.1.
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005
+	CloseAbnormalClosure         = 1006
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseMandatoryExtension      = 1010
+	CloseInternalServerErr       = 1011
+	CloseServiceRestart          = 1012
+	CloseTryAgainLater           = 1013
+	CloseTLSHandshake            = 1015
+)
+
+const (
+	finalBit = 1 << 7
+	rsv1Bit  = 1 << 6
+	rsv2Bit  = 1 << 5
+	rsv3Bit  = 1 << 4
+	maskBit  = 1 << 7
+
+	maxControlPayload = 125
+	defaultWriteWait  = time.Second
+
+	// DefaultReadLimit is the max size of the messages read from the peer by default.
+	DefaultReadLimit = 32 << 20
+)
+
+var (
+	// ErrCloseSent is returned when writing on a connection after the close message is sent.
+	ErrCloseSent = errors.New("websocket: close sent")
+	// ErrReadLimit is returned when a message is larger than the read limit.
+	ErrReadLimit = errors.New("websocket: read limit exceeded")
+
+	errBadControl = errors.New("websocket: bad control message")
+)
+
+type (
+	// CloseError is returned by ReadMessage when the peer closes the connection,
+	// or when the connection is closed on a protocol error.
+	CloseError struct {
+		Code int
+		Text string
+	}
+
+	// Conn is a websocket connection. Only one goroutine may read at a time,
+	// the writes are safe to be called concurrently.
+	Conn struct {
+		conn     net.Conn
+		isServer bool
+
+		subprotocol string
+		compress    bool
+
+		br        *bufio.Reader
+		readLimit int64
+		// the read goroutine only
+		readErr      error
+		pingHandler  func(data string) error
+		pongHandler  func(data string) error
+		closeHandler func(code int, text string) error
+
+		writeLock      sync.Mutex
+		writeFrameSize int
+		writeBuf       []byte
+		closeSent      bool
+		enableWriteZip bool
+	}
+)
+
+func (e *CloseError) Error() string {
+	return "websocket: close " + strconv.Itoa(e.Code) + " " + closeText(e.Code) + ": " + e.Text
+}
+
+// IsCloseError tells whether err is a CloseError with one of codes.
+func IsCloseError(err error, codes ...int) bool {
+	var closeErr *CloseError
+	if !errors.As(err, &closeErr) {
+		return false
+	}
+
+	for _, code := range codes {
+		if closeErr.Code == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FormatCloseMessage returns the payload of a close message with code and text,
+// CloseNoStatusReceived is sent as an empty payload.
+func FormatCloseMessage(code int, text string) []byte {
+	if code == CloseNoStatusReceived {
+		return []byte{}
+	}
+
+	buf := make([]byte, 2+len(text))
+	binary.BigEndian.PutUint16(buf, uint16(code))
+	copy(buf[2:], text)
+	return buf
+}
+
+func newConn(conn net.Conn, br *bufio.Reader, isServer bool, readBufferSize, writeBufferSize int,
+	readLimit int64) *Conn {
+	if br == nil {
+		br = bufio.NewReaderSize(conn, readBufferSize)
+	}
+	if writeBufferSize <= 0 {
+		writeBufferSize = defaultBufferSize
+	}
+	if readLimit == 0 {
+		readLimit = DefaultReadLimit
+	}
+
+	c := &Conn{
+		conn:           conn,
+		isServer:       isServer,
+		br:             br,
+		readLimit:      readLimit,
+		writeFrameSize: writeBufferSize,
+		enableWriteZip: true,
+	}
+	c.SetPingHandler(nil)
+	c.SetPongHandler(nil)
+	c.SetCloseHandler(nil)
+
+	return c
+}
+
+// Subprotocol returns the negotiated subprotocol.
+func (c *Conn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// Compressed tells whether per-message compression is negotiated.
+func (c *Conn) Compressed() bool {
+	return c.compress
+}
+
+// LocalAddr returns the local network address.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote network address.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// Close closes the underlying connection without the close handshake, see WriteClose.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// SetReadDeadline sets the deadline of reading, a timed out connection is broken.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline of writing, a timed out connection is broken.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// SetReadLimit sets the max size of the messages read from the peer, DefaultReadLimit by default,
+// the connection is closed with CloseMessageTooBig on larger messages. A negative limit means no limit,
+// only set it on the trusted peers.
+func (c *Conn) SetReadLimit(limit int64) {
+	c.readLimit = limit
+}
+
+// EnableWriteCompression enables or disables compressing the written messages,
+// it takes effect only if compression is negotiated.
+func (c *Conn) EnableWriteCompression(enable bool) {
+	c.writeLock.Lock()
+	c.enableWriteZip = enable
+	c.writeLock.Unlock()
+}
+
+// SetPingHandler sets the handler of the ping messages, called from ReadMessage,
+// the default handler replies a pong with the same data.
+func (c *Conn) SetPingHandler(h func(data string) error) {
+	if h == nil {
+		h = func(data string) error {
+			err := c.WriteControl(PongMessage, []byte(data), time.Now().Add(defaultWriteWait))
+			if err == ErrCloseSent {
+				return nil
+			}
+			return err
+		}
+	}
+	c.pingHandler = h
+}
+
+// SetPongHandler sets the handler of the pong messages, called from ReadMessage,
+// the default handler does nothing.
+func (c *Conn) SetPongHandler(h func(data string) error) {
+	if h == nil {
+		h = func(string) error {
+			return nil
+		}
+	}
+	c.pongHandler = h
+}
+
+// SetCloseHandler sets the handler of the close message, called from ReadMessage
+// before it returns the CloseError, the default handler replies the close message with the code.
+func (c *Conn) SetCloseHandler(h func(code int, text string) error) {
+	if h == nil {
+		h = func(code int, text string) error {
+			err := c.WriteControl(CloseMessage, FormatCloseMessage(code, ""), time.Now().Add(defaultWriteWait))
+			if err == ErrCloseSent {
+				return nil
+			}
+			return err
+		}
+	}
+	c.closeHandler = h
+}
+
+// ReadMessage reads the next data message, the fragmented messages are reassembled,
+// and the control messages in between are passed to their handlers.
+// The error is permanent once returned, a *CloseError if the connection is closed.
+func (c *Conn) ReadMessage() (messageType int, data []byte, err error) {
+	if c.readErr != nil {
+		return 0, nil, c.readErr
+	}
+
+	messageType, data, err = c.readMessage()
+	if err != nil {
+		c.readErr = err
+	}
+
+	return messageType, data, err
+}
+
+// ReadJSON reads the next message and unmarshals it into v.
+func (c *Conn) ReadJSON(v interface{}) error {
+	_, data, err := c.ReadMessage()
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+func (c *Conn) readMessage() (int, []byte, error) {
+	var (
+		messageType int
+		compressed  bool
+		data        []byte
+	)
+
+	for {
+		f, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch f.opcode {
+		case PingMessage:
+			if err := c.pingHandler(string(f.payload)); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			if err := c.pongHandler(string(f.payload)); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case CloseMessage:
+			return 0, nil, c.handleClose(f.payload)
+		case continuationFrame:
+			if messageType == 0 {
+				return 0, nil, c.protocolError(CloseProtocolError, "continuation frame without a message")
+			}
+			if f.rsv1 {
+				return 0, nil, c.protocolError(CloseProtocolError, "rsv1 set on continuation frame")
+			}
+		default:
+			if messageType != 0 {
+				return 0, nil, c.protocolError(CloseProtocolError, "message started before the last one finished")
+			}
+			if f.rsv1 && !c.compress {
+				return 0, nil, c.protocolError(CloseProtocolError, "rsv1 set without compression")
+			}
+			messageType = f.opcode
+			compressed = f.rsv1
+		}
+
+		if c.readLimit > 0 && int64(len(data)+len(f.payload)) > c.readLimit {
+			c.writeCloseOnError(CloseMessageTooBig, "")
+			return 0, nil, ErrReadLimit
+		}
+		data = append(data, f.payload...)
+		if f.final {
+			break
+		}
+	}
+
+	if compressed {
+		var err error
+		if data, err = decompress(data, c.readLimit); err != nil {
+			if err == ErrReadLimit {
+				c.writeCloseOnError(CloseMessageTooBig, "")
+				return 0, nil, err
+			}
+			return 0, nil, c.protocolError(CloseInvalidFramePayloadData, "bad compressed data")
+		}
+	}
+
+	if messageType == TextMessage && !utf8.Valid(data) {
+		return 0, nil, c.protocolError(CloseInvalidFramePayloadData, "invalid utf-8 in text message")
+	}
+
+	return messageType, data, nil
+}
+
+func (c *Conn) handleClose(payload []byte) error {
+	code := CloseNoStatusReceived
+	var text string
+	if len(payload) == 1 {
+		return c.protocolError(CloseProtocolError, "bad close payload")
+	}
+	if len(payload) >= 2 {
+		code = int(binary.BigEndian.Uint16(payload))
+		text = string(payload[2:])
+		if !validReceivedCloseCode(code) {
+			return c.protocolError(CloseProtocolError, "bad close code "+strconv.Itoa(code))
+		}
+		if !utf8.ValidString(text) {
+			return c.protocolError(CloseInvalidFramePayloadData, "invalid utf-8 in close reason")
+		}
+	}
+
+	if err := c.closeHandler(code, text); err != nil {
+		return err
+	}
+
+	return &CloseError{
+		Code: code,
+		Text: text,
+	}
+}
+
+// protocolError closes the connection with code, and returns the CloseError.
+func (c *Conn) protocolError(code int, text string) error {
+	c.writeCloseOnError(code, text)
+	return &CloseError{
+		Code: code,
+		Text: text,
+	}
+}
+
+func (c *Conn) writeCloseOnError(code int, text string) {
+	c.WriteControl(CloseMessage, FormatCloseMessage(code, text), time.Now().Add(defaultWriteWait))
+}
+
+// WriteMessage writes a data message, the messages larger than the write buffer are fragmented.
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		if isControl(messageType) {
+			return c.WriteControl(messageType, data, time.Time{})
+		}
+		return fmt.Errorf("websocket: bad message type %d", messageType)
+	}
+
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	if c.closeSent {
+		return ErrCloseSent
+	}
+
+	compressed := c.compress && c.enableWriteZip
+	if compressed {
+		var err error
+		if data, err = compress(data); err != nil {
+			return err
+		}
+	}
+
+	opcode := messageType
+	for {
+		n := len(data)
+		if n > c.writeFrameSize {
+			n = c.writeFrameSize
+		}
+		final := n == len(data)
+		var rsv1 bool
+		if opcode != continuationFrame {
+			rsv1 = compressed
+		}
+
+		if err := c.writeFrame(opcode, rsv1, final, data[:n]); err != nil {
+			return err
+		}
+		if final {
+			return nil
+		}
+
+		data = data[n:]
+		opcode = continuationFrame
+	}
+}
+
+// WriteJSON writes v as a text message in json.
+func (c *Conn) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return c.WriteMessage(TextMessage, data)
+}
+
+// WriteControl writes a control message with the deadline, it can be called with the other writes
+// concurrently. No more messages can be written after the close message.
+func (c *Conn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	if !isControl(messageType) {
+		return fmt.Errorf("websocket: bad control message type %d", messageType)
+	}
+	if len(data) > maxControlPayload {
+		return errBadControl
+	}
+
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	if c.closeSent {
+		return ErrCloseSent
+	}
+	if messageType == CloseMessage {
+		c.closeSent = true
+	}
+
+	if err := c.conn.SetWriteDeadline(deadline); err != nil {
+		return err
+	}
+	defer c.conn.SetWriteDeadline(time.Time{})
+
+	return c.writeFrame(messageType, false, true, data)
+}
+
+// WriteClose starts the close handshake with code and text, the connection should be read
+// until ReadMessage returns the CloseError of the reply, then be closed.
+func (c *Conn) WriteClose(code int, text string) error {
+	return c.WriteControl(CloseMessage, FormatCloseMessage(code, text), time.Now().Add(defaultWriteWait))
+}
+
+// writeFrame writes a frame, with the write lock held.
+func (c *Conn) writeFrame(opcode int, rsv1, final bool, payload []byte) error {
+	buf := c.writeBuf[:0]
+	b0 := byte(opcode)
+	if final {
+		b0 |= finalBit
+	}
+	if rsv1 {
+		b0 |= rsv1Bit
+	}
+	buf = append(buf, b0)
+
+	var b1 byte
+	if !c.isServer {
+		b1 |= maskBit
+	}
+	switch n := len(payload); {
+	case n <= maxControlPayload:
+		buf = append(buf, b1|byte(n))
+	case n <= 0xffff:
+		buf = append(buf, b1|126, byte(n>>8), byte(n))
+	default:
+		buf = append(buf, b1|127)
+		var size [8]byte
+		binary.BigEndian.PutUint64(size[:], uint64(n))
+		buf = append(buf, size[:]...)
+	}
+
+	if c.isServer {
+		buf = append(buf, payload...)
+	} else {
+		// the clients mask their frames
+		key := newMaskKey()
+		buf = append(buf, key[:]...)
+		start := len(buf)
+		buf = append(buf, payload...)
+		maskBytes(key, buf[start:])
+	}
+	c.writeBuf = buf[:0]
+
+	_, err := c.conn.Write(buf)
+	return err
+}
+
+type frame struct {
+	final   bool
+	rsv1    bool
+	opcode  int
+	payload []byte
+}
+
+func (c *Conn) readFrame() (*frame, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		return nil, readError(err)
+	}
+
+	f := &frame{
+		final:  header[0]&finalBit != 0,
+		rsv1:   header[0]&rsv1Bit != 0,
+		opcode: int(header[0] & 0xf),
+	}
+	if header[0]&(rsv2Bit|rsv3Bit) != 0 {
+		return nil, c.protocolError(CloseProtocolError, "unexpected reserved bits")
+	}
+
+	switch f.opcode {
+	case continuationFrame, TextMessage, BinaryMessage:
+	case CloseMessage, PingMessage, PongMessage:
+		if !f.final {
+			return nil, c.protocolError(CloseProtocolError, "fragmented control frame")
+		}
+		if f.rsv1 {
+			return nil, c.protocolError(CloseProtocolError, "rsv1 set on control frame")
+		}
+	default:
+		return nil, c.protocolError(CloseProtocolError, "unknown opcode "+strconv.Itoa(f.opcode))
+	}
+
+	masked := header[1]&maskBit != 0
+	if masked != c.isServer {
+		// the clients must mask their frames, and the servers must not
+		return nil, c.protocolError(CloseProtocolError, "bad frame masking")
+	}
+
+	length := int64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var size [2]byte
+		if _, err := io.ReadFull(c.br, size[:]); err != nil {
+			return nil, readError(err)
+		}
+		length = int64(binary.BigEndian.Uint16(size[:]))
+	case 127:
+		var size [8]byte
+		if _, err := io.ReadFull(c.br, size[:]); err != nil {
+			return nil, readError(err)
+		}
+		length = int64(binary.BigEndian.Uint64(size[:]))
+		if length < 0 {
+			return nil, c.protocolError(CloseProtocolError, "bad frame length")
+		}
+	}
+	if isControl(f.opcode) && length > maxControlPayload {
+		return nil, c.protocolError(CloseProtocolError, "control frame too long")
+	}
+	if c.readLimit > 0 && length > c.readLimit {
+		c.writeCloseOnError(CloseMessageTooBig, "")
+		return nil, ErrReadLimit
+	}
+
+	var key [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, key[:]); err != nil {
+			return nil, readError(err)
+		}
+	}
+
+	// read as the payload arrives, not allocating by the length claimed by the peer
+	payload, err := ioutil.ReadAll(io.LimitReader(c.br, length))
+	if err != nil {
+		return nil, readError(err)
+	}
+	if int64(len(payload)) < length {
+		return nil, readError(io.ErrUnexpectedEOF)
+	}
+	f.payload = payload
+	if masked {
+		maskBytes(key, f.payload)
+	}
+
+	return f, nil
+}
+
+// readError reports the connection broken without the close handshake as CloseAbnormalClosure.
+func readError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return &CloseError{
+			Code: CloseAbnormalClosure,
+			Text: err.Error(),
+		}
+	}
+
+	return err
+}
+
+func isControl(opcode int) bool {
+	return opcode == CloseMessage || opcode == PingMessage || opcode == PongMessage
+}
+
+// validReceivedCloseCode tells whether code can be sent in a close frame, see RFC 6455, section 7.4.
+func validReceivedCloseCode(code int) bool {
+	switch code {
+	case CloseNoStatusReceived, CloseAbnormalClosure, CloseTLSHandshake:
+		return false
+	}
+
+	return (code >= CloseNormalClosure && code <= CloseTryAgainLater && code != 1004) ||
+		(code >= 3000 && code <= 4999)
+}
+
+func closeText(code int) string {
+	switch code {
+	case CloseNormalClosure:
+		return "(normal)"
+	case CloseGoingAway:
+		return "(going away)"
+	case CloseProtocolError:
+		return "(protocol error)"
+	case CloseUnsupportedData:
+		return "(unsupported data)"
+	case CloseNoStatusReceived:
+		return "(no status)"
+	case CloseAbnormalClosure:
+		return "(abnormal closure)"
+	case CloseInvalidFramePayloadData:
+		return "(invalid payload data)"
+	case ClosePolicyViolation:
+		return "(policy violation)"
+	case CloseMessageTooBig:
+		return "(message too big)"
+	case CloseMandatoryExtension:
+		return "(mandatory extension missing)"
+	case CloseInternalServerErr:
+		return "(internal server error)"
+	case CloseServiceRestart:
+		return "(service restart)"
+	case CloseTryAgainLater:
+		return "(try again later)"
+	case CloseTLSHandshake:
+		return "(TLS handshake error)"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,238 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultBufferSize = 4096
+	acceptGUID        = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	keyLen            = 16
+)
+
+type (
+	// HandshakeError is returned by Upgrade if the request is not a valid websocket handshake,
+	// the error response is written already.
+	HandshakeError struct {
+		Status  int
+		Message string
+	}
+
+	// Upgrader upgrades the http requests to websocket connections.
+	Upgrader struct {
+		// HandshakeTimeout is the deadline of writing the handshake response, no deadline if zero.
+		HandshakeTimeout time.Duration
+		// ReadBufferSize and WriteBufferSize are the sizes of the io buffers, 4096 if zero.
+		// The messages larger than WriteBufferSize are fragmented.
+		ReadBufferSize  int
+		WriteBufferSize int
+		// ReadLimit is the max size of the messages read from the clients, DefaultReadLimit if zero,
+		// negative means no limit. The larger messages close the connection with CloseMessageTooBig.
+		ReadLimit int64
+		// Subprotocols are the supported subprotocols in the order of preference.
+		Subprotocols []string
+		// EnableCompression negotiates the per-message compression, RFC 7692.
+		EnableCompression bool
+		// CheckOrigin returns true if the request Origin is acceptable, the browsers don't apply
+		// the same origin policy on websockets. If nil, the Origin must be the same as the Host.
+		CheckOrigin func(r *http.Request) bool
+	}
+)
+
+func (e HandshakeError) Error() string {
+	return "websocket: " + e.Message
+}
+
+// IsWebSocketUpgrade tells whether r asks to upgrade to websocket.
+func IsWebSocketUpgrade(r *http.Request) bool {
+	return headerContainsToken(r.Header, "Connection", "upgrade") &&
+		headerContainsToken(r.Header, "Upgrade", "websocket")
+}
+
+// Upgrade checks the handshake of r and upgrades the connection to websocket,
+// responseHeader is sent with the handshake response, like Set-Cookie.
+// The error response is written if the handshake fails.
+func (u *Upgrader) Upgrade(w http.ResponseWriter, r *http.Request, responseHeader http.Header) (*Conn, error) {
+	if r.Method != http.MethodGet {
+		return u.fail(w, http.StatusMethodNotAllowed, "request method is not GET")
+	}
+	if !headerContainsToken(r.Header, "Connection", "upgrade") {
+		return u.fail(w, http.StatusBadRequest, "'upgrade' token not found in 'Connection' header")
+	}
+	if !headerContainsToken(r.Header, "Upgrade", "websocket") {
+		return u.fail(w, http.StatusBadRequest, "'websocket' token not found in 'Upgrade' header")
+	}
+	if r.Header.Get("Sec-Websocket-Version") != "13" {
+		w.Header().Set("Sec-Websocket-Version", "13")
+		return u.fail(w, http.StatusUpgradeRequired, "unsupported version")
+	}
+
+	checkOrigin := u.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = checkSameOrigin
+	}
+	if !checkOrigin(r) {
+		return u.fail(w, http.StatusForbidden, "origin not allowed")
+	}
+
+	challengeKey := strings.TrimSpace(r.Header.Get("Sec-Websocket-Key"))
+	if !validChallengeKey(challengeKey) {
+		return u.fail(w, http.StatusBadRequest, "bad 'Sec-WebSocket-Key' header")
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return u.fail(w, http.StatusInternalServerError, "response does not implement http.Hijacker")
+	}
+
+	subprotocol := u.selectSubprotocol(r)
+	var extension string
+	if u.EnableCompression {
+		extension = negotiateDeflate(r.Header["Sec-Websocket-Extensions"])
+	}
+
+	netConn, brw, err := hijacker.Hijack()
+	if err != nil {
+		return u.fail(w, http.StatusInternalServerError, err.Error())
+	}
+	if brw.Reader.Buffered() > 0 {
+		netConn.Close()
+		return nil, errors.New("websocket: client sent data before handshake is complete")
+	}
+
+	readBufferSize := u.ReadBufferSize
+	if readBufferSize <= 0 {
+		readBufferSize = defaultBufferSize
+	}
+	br := brw.Reader
+	if br.Size() < readBufferSize {
+		br = bufio.NewReaderSize(netConn, readBufferSize)
+	}
+	c := newConn(netConn, br, true, readBufferSize, u.WriteBufferSize, u.ReadLimit)
+	c.subprotocol = subprotocol
+	c.compress = len(extension) > 0
+
+	var resp strings.Builder
+	resp.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	resp.WriteString("Sec-WebSocket-Accept: " + computeAcceptKey(challengeKey) + "\r\n")
+	if len(subprotocol) > 0 {
+		resp.WriteString("Sec-WebSocket-Protocol: " + subprotocol + "\r\n")
+	}
+	if len(extension) > 0 {
+		resp.WriteString("Sec-WebSocket-Extensions: " + extension + "\r\n")
+	}
+	for key, values := range responseHeader {
+		if key == "Sec-Websocket-Protocol" || key == "Sec-Websocket-Extensions" {
+			continue
+		}
+		for _, value := range values {
+			resp.WriteString(key + ": " + strings.NewReplacer("\r", "", "\n", "").Replace(value) + "\r\n")
+		}
+	}
+	resp.WriteString("\r\n")
+
+	if u.HandshakeTimeout > 0 {
+		netConn.SetWriteDeadline(time.Now().Add(u.HandshakeTimeout))
+	}
+	if _, err := netConn.Write([]byte(resp.String())); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	if u.HandshakeTimeout > 0 {
+		netConn.SetWriteDeadline(time.Time{})
+	}
+
+	return c, nil
+}
+
+func (u *Upgrader) fail(w http.ResponseWriter, status int, message string) (*Conn, error) {
+	err := HandshakeError{
+		Status:  status,
+		Message: message,
+	}
+	w.Header().Set("Sec-Websocket-Version", "13")
+	http.Error(w, http.StatusText(status), status)
+	return nil, err
+}
+
+func (u *Upgrader) selectSubprotocol(r *http.Request) string {
+	requested := headerTokens(r.Header, "Sec-Websocket-Protocol")
+	for _, supported := range u.Subprotocols {
+		for _, protocol := range requested {
+			if protocol == supported {
+				return protocol
+			}
+		}
+	}
+
+	return ""
+}
+
+func checkSameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if len(origin) == 0 {
+		// not a browser
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+func computeAcceptKey(challengeKey string) string {
+	h := sha1.New()
+	h.Write([]byte(challengeKey + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func validChallengeKey(key string) bool {
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	return err == nil && len(decoded) == keyLen
+}
+
+func newMaskKey() [4]byte {
+	var key [4]byte
+	rand.Read(key[:])
+	return key
+}
+
+func maskBytes(key [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= key[i&3]
+	}
+}
+
+func headerTokens(header http.Header, name string) []string {
+	var tokens []string
+	for _, value := range header[http.CanonicalHeaderKey(name)] {
+		for _, token := range strings.Split(value, ",") {
+			if token = strings.TrimSpace(token); len(token) > 0 {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+
+	return tokens
+}
+
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, t := range headerTokens(header, name) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,201 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// dial connects to the echo server at url as a websocket client.
+func dial(t *testing.T, url string, header http.Header) (*Conn, *http.Response) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	assert.Nil(t, err)
+
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{'k'}, keyLen))
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	assert.Nil(t, req.Write(conn))
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	assert.Nil(t, err)
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		return nil, resp
+	}
+	assert.Equal(t, computeAcceptKey(key), resp.Header.Get("Sec-Websocket-Accept"))
+
+	c := newConn(conn, br, false, defaultBufferSize, defaultBufferSize, 0)
+	c.compress = len(resp.Header.Get("Sec-Websocket-Extensions")) > 0
+	return c, resp
+}
+
+func newEchoServer(upgrader *Upgrader) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, http.Header{"X-Test": {"yes"}})
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteMessage(messageType, data); err != nil {
+				return
+			}
+		}
+	}))
+}
+
+func TestEcho(t *testing.T) {
+	server := newEchoServer(&Upgrader{
+		Subprotocols:      []string{"chat"},
+		EnableCompression: true,
+	})
+	defer server.Close()
+
+	for _, compressed := range []bool{false, true} {
+		header := http.Header{"Sec-Websocket-Protocol": {"other, chat"}}
+		if compressed {
+			header.Set("Sec-Websocket-Extensions", "permessage-deflate; client_max_window_bits")
+		}
+		c, resp := dial(t, server.URL, header)
+		assert.Equal(t, "chat", resp.Header.Get("Sec-Websocket-Protocol"))
+		assert.Equal(t, "yes", resp.Header.Get("X-Test"))
+		assert.Equal(t, compressed, c.Compressed())
+
+		assert.Nil(t, c.WriteMessage(TextMessage, []byte("hello")))
+		messageType, data, err := c.ReadMessage()
+		assert.Nil(t, err)
+		assert.Equal(t, TextMessage, messageType)
+		assert.Equal(t, "hello", string(data))
+
+		// fragmented in both directions
+		c.writeFrameSize = 100
+		large := bytes.Repeat([]byte("0123456789"), 1000)
+		assert.Nil(t, c.WriteMessage(BinaryMessage, large))
+		messageType, data, err = c.ReadMessage()
+		assert.Nil(t, err)
+		assert.Equal(t, BinaryMessage, messageType)
+		assert.Equal(t, large, data)
+
+		var pong string
+		c.SetPongHandler(func(data string) error {
+			pong = data
+			return nil
+		})
+		assert.Nil(t, c.WriteControl(PingMessage, []byte("ping"), time.Time{}))
+		assert.Nil(t, c.WriteJSON(map[string]int{"n": 1}))
+		var v map[string]int
+		assert.Nil(t, c.ReadJSON(&v))
+		assert.Equal(t, "ping", pong)
+		assert.Equal(t, 1, v["n"])
+
+		assert.Nil(t, c.WriteClose(CloseGoingAway, "bye"))
+		_, _, err = c.ReadMessage()
+		assert.True(t, IsCloseError(err, CloseGoingAway))
+		assert.Equal(t, ErrCloseSent, c.WriteMessage(TextMessage, []byte("late")))
+		c.Close()
+	}
+}
+
+func TestProtocolErrors(t *testing.T) {
+	server := newEchoServer(&Upgrader{ReadLimit: 1 << 16})
+	defer server.Close()
+
+	tests := []struct {
+		name  string
+		frame []byte
+		code  int
+	}{
+		{"unmasked", []byte{0x81, 0x01, 'a'}, CloseProtocolError},
+		{"reserved opcode", []byte{0x83, 0x80, 0, 0, 0, 0}, CloseProtocolError},
+		{"fragmented control", []byte{0x09, 0x80, 0, 0, 0, 0}, CloseProtocolError},
+		{"bad close code", []byte{0x88, 0x82, 0, 0, 0, 0, 0x03, 0xed}, CloseProtocolError},
+		{"invalid utf-8", []byte{0x81, 0x81, 0, 0, 0, 0, 0xff}, CloseInvalidFramePayloadData},
+		{"orphan continuation", []byte{0x80, 0x81, 0, 0, 0, 0, 'a'}, CloseProtocolError},
+		{"too big", []byte{0x82, 0xff, 0, 0, 0, 0, 0, 2, 0, 0}, CloseMessageTooBig},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, _ := dial(t, server.URL, nil)
+			defer c.Close()
+
+			_, err := c.conn.Write(test.frame)
+			assert.Nil(t, err)
+			c.SetCloseHandler(func(int, string) error {
+				return nil
+			})
+			_, _, err = c.ReadMessage()
+			assert.True(t, IsCloseError(err, test.code), "%v", err)
+		})
+	}
+}
+
+func TestReadLimit(t *testing.T) {
+	server := newEchoServer(&Upgrader{EnableCompression: true})
+	defer server.Close()
+
+	// the header claims 1TB without the payload, rejected before reading
+	c, _ := dial(t, server.URL, nil)
+	defer c.Close()
+	_, err := c.conn.Write([]byte{0x82, 0xff, 0, 0, 1, 0, 0, 0, 0, 0})
+	assert.Nil(t, err)
+	_, _, err = c.ReadMessage()
+	assert.True(t, IsCloseError(err, CloseMessageTooBig), "%v", err)
+
+	// 64MB of zeros compressed into a small message
+	c, _ = dial(t, server.URL, http.Header{"Sec-Websocket-Extensions": {"permessage-deflate"}})
+	defer c.Close()
+	assert.True(t, c.Compressed())
+	bomb := make([]byte, 2*DefaultReadLimit)
+	compressed, err := compress(bomb)
+	assert.Nil(t, err)
+	assert.True(t, len(compressed) < DefaultReadLimit/100)
+	c.writeFrameSize = len(compressed) + 1
+	assert.Nil(t, c.WriteMessage(BinaryMessage, bomb))
+	_, _, err = c.ReadMessage()
+	assert.True(t, IsCloseError(err, CloseMessageTooBig), "%v", err)
+}
+
+func TestHandshakeErrors(t *testing.T) {
+	server := newEchoServer(&Upgrader{})
+	defer server.Close()
+
+	_, resp := dial(t, server.URL, http.Header{"Sec-Websocket-Version": {"8"}})
+	assert.Equal(t, http.StatusUpgradeRequired, resp.StatusCode)
+	assert.Equal(t, "13", resp.Header.Get("Sec-Websocket-Version"))
+
+	_, resp = dial(t, server.URL, http.Header{"Origin": {"http://evil.example.com"}})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp, err := http.Get(server.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestNegotiateDeflate(t *testing.T) {
+	assert.Equal(t, deflateResponse, negotiateDeflate([]string{"permessage-deflate"}))
+	assert.Equal(t, deflateResponse, negotiateDeflate([]string{
+		"permessage-deflate; server_max_window_bits=10, permessage-deflate; server_max_window_bits=15"}))
+	assert.Equal(t, "", negotiateDeflate([]string{"permessage-deflate; server_max_window_bits=10"}))
+	assert.Equal(t, "", negotiateDeflate([]string{"x-webkit-deflate-frame"}))
+}
@@ -0,0 +1,91 @@
+package apix
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/weblazy/core/apix/websocket"
+)
+
+type websocketTestController struct {
+	Controller
+}
+
+func (c *websocketTestController) Echo() error {
+	conn, err := c.UpgradeWebSocket(http.Header{"X-Test": {"yes"}})
+	if err != nil {
+		return err
+	}
+
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				return nil
+			}
+			return err
+		}
+		if err := conn.WriteMessage(messageType, data); err != nil {
+			return err
+		}
+	}
+}
+
+func TestUpgradeWebSocket(t *testing.T) {
+	mux := NewControllerRegister()
+	assert.Nil(t, mux.Add("/ws", &websocketTestController{}, "get:Echo"))
+	assert.Nil(t, mux.InsertFilter("/*", BeforeRouter, func(ctx *Context) {
+		if ctx.IsWebSocket() && ctx.R.URL.Query().Get("token") != "secret" {
+			ctx.AbortWithError(NewHTTPError(http.StatusUnauthorized, ""))
+		}
+	}))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	handshake := func(query string) (net.Conn, *bufio.Reader, *http.Response) {
+		conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+		assert.Nil(t, err)
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/ws"+query, nil)
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		req.Header.Set("Sec-WebSocket-Version", "13")
+		req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		assert.Nil(t, req.Write(conn))
+		br := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(br, req)
+		assert.Nil(t, err)
+		return conn, br, resp
+	}
+
+	conn, _, resp := handshake("")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	conn.Close()
+
+	conn, br, resp := handshake("?token=secret")
+	defer conn.Close()
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-Websocket-Accept"))
+	assert.Equal(t, "yes", resp.Header.Get("X-Test"))
+	assert.NotEmpty(t, resp.Header.Get("X-Request-Id"))
+
+	// a masked text frame "hi" with the zero mask
+	_, err := conn.Write([]byte{0x81, 0x82, 0, 0, 0, 0, 'h', 'i'})
+	assert.Nil(t, err)
+	frame := make([]byte, 4)
+	_, err = io.ReadFull(br, frame)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x81, 0x02, 'h', 'i'}, frame)
+
+	// close with 1000, replied by the server
+	_, err = conn.Write([]byte{0x88, 0x82, 0, 0, 0, 0, 0x03, 0xe8})
+	assert.Nil(t, err)
+	_, err = io.ReadFull(br, frame)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x88, 0x02, 0x03, 0xe8}, frame)
+}
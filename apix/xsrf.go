@@ -0,0 +1,93 @@
+package apix
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"html/template"
+	"net/http"
+)
+
+const (
+	xsrfCookieName = "_xsrf"
+	xsrfFormField  = "_xsrf"
+	xsrfTokenBytes = 16
+)
+
+var (
+	// ErrXSRFKeyNotSet is returned by NewServer if EnableXSRF is set without XSRFKey.
+	ErrXSRFKeyNotSet = errors.New("XSRFKey must be set to enable xsrf")
+
+	xsrfHeaders = []string{"X-Xsrftoken", "X-Csrftoken"}
+)
+
+// XSRFToken returns the xsrf token of the client, a new token is generated
+// and set to the signed _xsrf cookie if the client doesn't have a valid one.
+func (c *Controller) XSRFToken() string {
+	if len(c._xsrfToken) > 0 {
+		return c._xsrfToken
+	}
+
+	key := stateOf(c.R).conf.XSRFKey
+	token, ok := c.GetSecureCookie(key, xsrfCookieName)
+	if !ok {
+		token = newXSRFToken()
+		c.SetSecureCookie(key, xsrfCookieName, token, c.XSRFExpire, "/", "",
+			c.R.TLS != nil, true)
+	}
+	c._xsrfToken = token
+
+	return token
+}
+
+// CheckXSRFCookie checks the xsrf token of the request against the _xsrf cookie,
+// the token is read from the _xsrf form field, or the X-Xsrftoken or X-Csrftoken header.
+// 403 is written if the check fails.
+func (c *Controller) CheckXSRFCookie() bool {
+	if !c.EnableXSRF {
+		return true
+	}
+
+	token := c.R.FormValue(xsrfFormField)
+	for i := 0; len(token) == 0 && i < len(xsrfHeaders); i++ {
+		token = c.R.Header.Get(xsrfHeaders[i])
+	}
+	if len(token) == 0 {
+		writeError(c.W, c.R, NewHTTPError(http.StatusForbidden, "'_xsrf' argument missing from request"))
+		return false
+	}
+
+	if !hmac.Equal([]byte(token), []byte(c.XSRFToken())) {
+		writeError(c.W, c.R, NewHTTPError(http.StatusForbidden, "XSRF cookie does not match the request argument"))
+		return false
+	}
+
+	return true
+}
+
+// XSRFFormHTML returns the hidden input of the xsrf token to put in forms.
+func (c *Controller) XSRFFormHTML() template.HTML {
+	return template.HTML(`<input type="hidden" name="` + xsrfFormField + `" value="` +
+		template.HTMLEscapeString(c.XSRFToken()) + `" />`)
+}
+
+// isUnsafeMethod tells whether the method may change the state of the server,
+// which requires the xsrf check.
+func isUnsafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return false
+	default:
+		return true
+	}
+}
+
+func newXSRFToken() string {
+	b := make([]byte, xsrfTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,116 @@
+package apix
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/weblazy/core/config"
+)
+
+type xsrfTestController struct {
+	Controller
+}
+
+// the count of the finished xsrfTestControllers
+var xsrfFinished int32
+
+func (c *xsrfTestController) Finish() {
+	atomic.AddInt32(&xsrfFinished, 1)
+}
+
+func (c *xsrfTestController) Get() {
+	c.W.Write([]byte(c.XSRFToken()))
+}
+
+func (c *xsrfTestController) Post() {
+	c.W.Write([]byte("ok"))
+}
+
+func TestSecureCookie(t *testing.T) {
+	w := httptest.NewRecorder()
+	c := &Controller{BaseController: BaseController{W: w}}
+	c.SetSecureCookie("secret", "user", "kevin|admin", 60)
+	cookie := w.Result().Cookies()[0]
+	assert.Equal(t, 60, cookie.MaxAge)
+
+	get := func(value, secret string) (string, bool) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.AddCookie(&http.Cookie{Name: "user", Value: value})
+		c := &Controller{BaseController: BaseController{R: r}}
+		return c.GetSecureCookie(secret, "user")
+	}
+
+	value, ok := get(cookie.Value, "secret")
+	assert.True(t, ok)
+	assert.Equal(t, "kevin|admin", value)
+	_, ok = get(cookie.Value, "other")
+	assert.False(t, ok)
+	_, ok = get(cookie.Value, "")
+	assert.False(t, ok)
+
+	raw, err := url.QueryUnescape(cookie.Value)
+	assert.Nil(t, err)
+	parts := strings.Split(raw, secureCookieSeparator)
+	tampered := base64.URLEncoding.EncodeToString([]byte("bob|admin"))
+	_, ok = get(url.QueryEscape(strings.Join([]string{tampered, parts[1], parts[2]}, "|")), "secret")
+	assert.False(t, ok)
+	// moving the separator doesn't keep the signature
+	_, ok = get(url.QueryEscape(strings.Join([]string{parts[0] + parts[1][:1], parts[1][1:], parts[2]}, "|")),
+		"secret")
+	assert.False(t, ok)
+
+	expires := strconv.FormatInt(time.Now().Add(-time.Second).Unix(), 10)
+	expired := strings.Join([]string{parts[0], expires, signCookie("secret", parts[0], expires)}, "|")
+	_, ok = get(url.QueryEscape(expired), "secret")
+	assert.False(t, ok)
+}
+
+func TestXSRF(t *testing.T) {
+	prev := ApiConfig
+	defer func() {
+		ApiConfig = prev
+	}()
+	ApiConfig.EnableXSRF = true
+	ApiConfig.XSRFKey = "secret"
+
+	mux := NewControllerRegister()
+	assert.Nil(t, mux.Add("/form", &xsrfTestController{}))
+
+	w := httptest.NewRecorder()
+	mux.serveHTTP(w, httptest.NewRequest(http.MethodGet, "/form", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	token := w.Body.String()
+	cookie := w.Result().Cookies()[0]
+	assert.Equal(t, xsrfCookieName, cookie.Name)
+
+	post := func(token string, cookie *http.Cookie) int {
+		r := httptest.NewRequest(http.MethodPost, "/form", nil)
+		r.Header.Set("X-Xsrftoken", token)
+		r.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		mux.serveHTTP(w, r)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, post(token, cookie))
+	finished := atomic.LoadInt32(&xsrfFinished)
+	assert.Equal(t, http.StatusForbidden, post("", cookie))
+	assert.Equal(t, http.StatusForbidden, post(newXSRFToken(), cookie))
+	// finished on the rejections as well
+	assert.Equal(t, finished+2, atomic.LoadInt32(&xsrfFinished))
+	// a cookie forged with an empty key
+	forged := httptest.NewRecorder()
+	(&Controller{BaseController: BaseController{W: forged}}).SetSecureCookie("", xsrfCookieName, token)
+	assert.Equal(t, http.StatusForbidden, post(token, forged.Result().Cookies()[0]))
+
+	_, err := NewServer(config.ApiConfig{EnableXSRF: true}, NewControllerRegister())
+	assert.Equal(t, ErrXSRFKeyNotSet, err)
+}
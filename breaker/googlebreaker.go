@@ -7,6 +7,7 @@ import (
 
 	"github.com/weblazy/core/collection"
 	"github.com/weblazy/core/mathx"
+	"github.com/weblazy/core/syncx"
 )
 
 const (
@@ -17,10 +18,18 @@ const (
 	protection = 5
 )
 
+// the multiplier of the accepts, shared by all the google breakers
+var breakerK = syncx.ForAtomicFloat64(k)
+
+// SetK sets the multiplier of the accepted requests of the breakers, 1.5 by default,
+// the larger k is, the less requests are dropped on failures.
+func SetK(k float64) {
+	breakerK.Set(k)
+}
+
 // googleBreaker is a netflixBreaker pattern from google.
 // see Client-Side Throttling section in https://landing.google.com/sre/sre-book/chapters/handling-overload/
 type googleBreaker struct {
-	k     float64
 	state int32
 	stat  *collection.RollingWindow
 	proba *mathx.Proba
@@ -31,7 +40,6 @@ func newGoogleBreaker() *googleBreaker {
 	st := collection.NewRollingWindow(buckets, bucketDuration)
 	return &googleBreaker{
 		stat:  st,
-		k:     k,
 		state: StateClosed,
 		proba: mathx.NewProba(),
 	}
@@ -39,7 +47,7 @@ func newGoogleBreaker() *googleBreaker {
 
 func (b *googleBreaker) accept() error {
 	accepts, total := b.history()
-	weightedAccepts := b.k * float64(accepts)
+	weightedAccepts := breakerK.Load() * float64(accepts)
 	// https://landing.google.com/sre/sre-book/chapters/handling-overload/#eq2101
 	dropRatio := math.Max(0, (float64(total-protection)-weightedAccepts)/float64(total+1))
 	if dropRatio <= 0 {
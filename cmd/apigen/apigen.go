@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/weblazy/core/apix/gen"
+	"github.com/weblazy/core/apix/openapi"
+)
+
+const usage = `Usage:
+  apigen router -c <controller dir> -o <router file>
+      generates the router file from the controllers and their @router annotations
+  apigen new -n <name> -c <controller dir> -m <model dir>
+      scaffolds a controller with CRUD actions and its model
+  apigen swagger -r <router dir> -o <output file> [-t <title>] [-v <version>]
+      generates the OpenAPI 3 document of the routes generated by apigen router
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "router":
+		fs := flag.NewFlagSet("router", flag.ExitOnError)
+		controllerDir := fs.String("c", "controllers", "The directory of the controllers")
+		output := fs.String("o", "routers/router.go", "The router file to generate")
+		fs.Parse(os.Args[2:])
+		if err = gen.GenerateRouter(*controllerDir, *output); err == nil {
+			fmt.Println("generated", *output)
+		}
+	case "new":
+		fs := flag.NewFlagSet("new", flag.ExitOnError)
+		name := fs.String("n", "", "The name of the controller, like User")
+		controllerDir := fs.String("c", "controllers", "The directory of the controllers")
+		modelDir := fs.String("m", "models", "The directory of the models")
+		fs.Parse(os.Args[2:])
+		if err = gen.ScaffoldController(*name, *controllerDir, *modelDir); err == nil {
+			fmt.Printf("scaffolded %s in %s and %s, run apigen router to route it\n",
+				*name, *controllerDir, *modelDir)
+		}
+	case "swagger":
+		fs := flag.NewFlagSet("swagger", flag.ExitOnError)
+		routerDir := fs.String("r", "routers", "The directory of the router file generated by apigen router")
+		output := fs.String("o", "swagger.json", "The OpenAPI document to generate")
+		title := fs.String("t", "api", "The title of the api")
+		version := fs.String("v", "1.0.0", "The version of the api")
+		fs.Parse(os.Args[2:])
+		if err = gen.GenerateOpenAPI(*routerDir, *output, openapi.Info{
+			Title:   *title,
+			Version: *version,
+		}); err == nil {
+			fmt.Println("generated", *output)
+		}
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/weblazy/core/config"
+)
+
+const usage = `Usage:
+  confctl encrypt -v <value> | -f <config file>
+      prints ENC(...) of the value, or encrypts the DEC(plain) values in the config file
+  confctl decrypt -v <ENC(...)> | -f <config file>
+      prints the plain value, or replaces the ENC(...) values in the config file with DEC(plain) to edit
+  confctl rotate -f <config file> -n <new key file>
+      re-encrypts the ENC(...) values in the config file with the new key
+
+The key is read from $` + config.SecretKeyEnv + `, or the file of $` + config.SecretKeyFileEnv + `.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "encrypt":
+		fs := flag.NewFlagSet("encrypt", flag.ExitOnError)
+		value := fs.String("v", "", "The plain value to encrypt")
+		file := fs.String("f", "", "The config file with the DEC(plain) values")
+		fs.Parse(os.Args[2:])
+		err = run(*value, *file, config.EncryptValue, config.EncryptFile)
+	case "decrypt":
+		fs := flag.NewFlagSet("decrypt", flag.ExitOnError)
+		value := fs.String("v", "", "The ENC(...) value to decrypt")
+		file := fs.String("f", "", "The config file with the ENC(...) values")
+		fs.Parse(os.Args[2:])
+		err = run(*value, *file, config.DecryptValue, config.DecryptFile)
+	case "rotate":
+		fs := flag.NewFlagSet("rotate", flag.ExitOnError)
+		file := fs.String("f", "", "The config file with the ENC(...) values")
+		newKeyFile := fs.String("n", "", "The file of the new key")
+		fs.Parse(os.Args[2:])
+		err = rotate(*file, *newKeyFile)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(value, file string, valueFn func(string, []byte) (string, error),
+	fileFn func(string, []byte) (int, error)) error {
+	if len(value) == 0 && len(file) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	key, err := config.LoadSecretKey()
+	if err != nil {
+		return err
+	}
+
+	if len(value) > 0 {
+		result, err := valueFn(value, key)
+		if err != nil {
+			return err
+		}
+		fmt.Println(result)
+		return nil
+	}
+
+	count, err := fileFn(file, key)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("replaced %d values in %s\n", count, file)
+	return nil
+}
+
+func rotate(file, newKeyFile string) error {
+	if len(file) == 0 || len(newKeyFile) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	oldKey, err := config.LoadSecretKey()
+	if err != nil {
+		return err
+	}
+	content, err := ioutil.ReadFile(newKeyFile)
+	if err != nil {
+		return err
+	}
+	newKey, err := config.ParseSecretKey(content)
+	if err != nil {
+		return err
+	}
+
+	count, err := config.RotateFile(file, oldKey, newKey)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("rotated %d values in %s, switch %s to %s\n", count, file, config.SecretKeyFileEnv, newKeyFile)
+	return nil
+}
@@ -1,14 +1,14 @@
 package config
 
 import (
-	"encoding/json"
-
 	"github.com/weblazy/core/fs"
 	"github.com/weblazy/core/logx"
 )
 
 const (
 	VERSION = "1.9.2"
+
+	jsonTag = "json"
 )
 
 type ConfigInterface interface {
@@ -22,14 +22,87 @@ type Config struct {
 	ServerName string
 }
 
+// StaticConfig serves the files in Dir under the url Prefix.
+type StaticConfig struct {
+	Prefix string
+	Dir    string
+	// list the directories without index.html
+	ListDir bool `json:",optional"`
+	// serve index.html of Dir for the missing files, for the single page apps
+	SPA bool `json:",optional"`
+	// the max-age of Cache-Control in seconds, zero means no Cache-Control header
+	MaxAge int `json:",optional"`
+	// serve the hidden files and directories, like .well-known
+	AllowHidden bool `json:",optional"`
+}
+
+// SessionConfig configures the sessions of controllers, see apix/session.
+type SessionConfig struct {
+	Provider   string `json:",default=memory,options=memory|file|redis"`
+	CookieName string `json:",default=sessionid"`
+	// seconds, the session expires after MaxLifetime without access
+	MaxLifetime int64 `json:",default=3600"`
+	// seconds, the interval to clean up the expired sessions
+	GCLifetime int64 `json:",default=60"`
+	// seconds, zero means the cookie is removed when the browser is closed
+	CookieLifetime int    `json:",optional"`
+	Domain         string `json:",optional"`
+	Secure         bool   `json:",optional"`
+	// pass the session id with http header instead of cookie, for the clients without cookie
+	EnableSidInHTTPHeader   bool   `json:",optional"`
+	SessionNameInHTTPHeader string `json:",default=Session-Id"`
+	// the directory of file provider
+	SavePath string `json:",default=sessions"`
+	// the redis of redis provider, the same as redis.RedisConf,
+	// which is not imported to keep the config package free of the redis client
+	Redis struct {
+		Host string
+		Type string `json:",default=node,options=node|cluster"`
+		Pass string `json:",optional"`
+	} `json:",optional"`
+	// the prefix of the redis keys
+	KeyPrefix string `json:",default=session:"`
+}
+
 type ApiConfig struct {
 	Config
+	Host      string `json:",optional"`
 	Port      int64
 	MaxMemory int64
 	Timeout   int64
 	ImagePath string
 	TplPath   string
 	ConfPath  string
+	// the directory of the templates rendered by controllers, views by default
+	ViewPath string `json:",optional"`
+	// json or combined(apache combined log format followed by the latency in seconds), json by default
+	AccessLogFormat string `json:",default=json,options=json|combined"`
+	// the proxies allowed to set X-Forwarded-For and X-Real-IP, ip or cidr
+	TrustedProxies []string `json:",optional"`
+	// check the xsrf token on POST, PUT, PATCH and DELETE etc. with the cookie signed by XSRFKey,
+	// XSRFExpire is the max age of the cookie in seconds, XSRFKey is required with EnableXSRF
+	EnableXSRF bool   `json:",optional"`
+	XSRFKey    string `json:",optional"`
+	XSRFExpire int    `json:",optional"`
+	// enable the sessions of controllers
+	SessionOn bool          `json:",optional"`
+	Session   SessionConfig `json:",optional"`
+	// http.Server timeouts in milliseconds, zero means no timeout
+	ReadTimeout  int64 `json:",optional"`
+	WriteTimeout int64 `json:",optional"`
+	IdleTimeout  int64 `json:",optional"`
+	// serve https if both CertFile and KeyFile are set
+	CertFile string `json:",optional"`
+	KeyFile  string `json:",optional"`
+	HTTP2    bool   `json:",optional"`
+	// serve the OpenAPI document of the routes on DocsPath, /swagger.json by default
+	EnableDocs bool   `json:",optional"`
+	DocsPath   string `json:",optional"`
+	// the static directories, the files are served before the routes of controllers
+	Static []StaticConfig `json:",optional"`
+	// the templates in ViewPath rendered for the errors of the status codes, like {"404": "errors/404.html"},
+	// if the clients accept html, otherwise the errors are written as json
+	ErrorPages map[string]string `json:",optional"`
 }
 
 type RpcConfig struct {
@@ -37,22 +110,28 @@ type RpcConfig struct {
 	Port int64
 }
 
-func UnmarshalWithLog(configFile string, config interface{}) {
+// Load loads configFile into config with the json tag options, like default, options, optional and range,
+// the format is told by the extension of configFile, see LoadBytes.
+// The error names the config file and the offending fields.
+func Load(configFile string, config interface{}, opts ...LoadOption) error {
 	data, err := fs.ReadFile(configFile)
 	if err != nil {
-		logx.Fatal(err)
+		return err
 	}
-	json.Unmarshal(data, config)
+
+	return loadFile(configFile, data, config, opts...)
+}
+
+func UnmarshalWithLog(configFile string, config interface{}, opts ...LoadOption) {
+	Unmarshal(configFile, config, opts...)
 	c := config.(ConfigInterface)
 	c.MustSetUp()
 }
 
-func Unmarshal(configFile string, config interface{}) {
-	data, err := fs.ReadFile(configFile)
-	if err != nil {
+func Unmarshal(configFile string, config interface{}, opts ...LoadOption) {
+	if err := Load(configFile, config, opts...); err != nil {
 		logx.Fatal(err)
 	}
-	json.Unmarshal(data, config)
 }
 
 func (c Config) MustSetUp() {
@@ -0,0 +1,314 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/weblazy/core/mapping"
+)
+
+var (
+	envRegex     = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::([^}]*))?\}`)
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+type (
+	// LoadOption customizes the overlays of Load.
+	LoadOption func(opts *loadOptions)
+
+	loadOptions struct {
+		envPrefix string
+		overrides []string
+		secretKey []byte
+	}
+
+	// Overrides are the path=value pairs overriding the config fields, like Log.Level=error,
+	// it's a flag.Value to collect the repeated flags:
+	//	var overrides config.Overrides
+	//	flag.Var(&overrides, "set", "override the config field, like -set Log.Level=error")
+	Overrides []string
+)
+
+// UseEnv overrides the config fields with the environment variables named by prefix and the field paths,
+// like APP_LOG_LEVEL for Log.Level if prefix is APP.
+func UseEnv(prefix string) LoadOption {
+	return func(opts *loadOptions) {
+		opts.envPrefix = prefix
+	}
+}
+
+// UseOverrides overrides the config fields with the path=value pairs, after the environment variables.
+func UseOverrides(overrides ...string) LoadOption {
+	return func(opts *loadOptions) {
+		opts.overrides = append(opts.overrides, overrides...)
+	}
+}
+
+func (o *Overrides) String() string {
+	return strings.Join(*o, ",")
+}
+
+func (o *Overrides) Set(value string) error {
+	if !strings.Contains(value, "=") {
+		return errors.New("expect path=value")
+	}
+
+	*o = append(*o, value)
+	return nil
+}
+
+// LoadBytes loads content into config by the format of ext, .yaml, .yml, .toml or json for the others.
+// The ${ENV_VAR} and ${ENV_VAR:default} in content are replaced with the environment variables first,
+// the values are not escaped, so quote them in the json files.
+// The ENC(...) string values are decrypted with the key of UseSecretKey or LoadSecretKey, see EncryptValue.
+func LoadBytes(content []byte, ext string, config interface{}, opts ...LoadOption) error {
+	var options loadOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	content = ExpandEnv(content)
+	var m map[string]interface{}
+	var err error
+	switch strings.ToLower(ext) {
+	case ".yaml", ".yml":
+		m, err = mapping.YamlBytesToMap(content)
+	case ".toml":
+		m, err = mapping.TomlBytesToMap(content)
+	default:
+		m, err = mapping.JsonBytesToMap(content)
+	}
+	if err != nil {
+		return err
+	}
+
+	t := mapping.Deref(reflect.TypeOf(config))
+	if t.Kind() != reflect.Struct {
+		return fmt.Errorf("%v must be a struct pointer", config)
+	}
+	if len(options.envPrefix) > 0 {
+		if err := overlayEnv(m, t, options.envPrefix, nil); err != nil {
+			return err
+		}
+	}
+	for _, override := range options.overrides {
+		if err := overlay(m, t, override); err != nil {
+			return err
+		}
+	}
+	if err := decryptSecrets(m, "", &options.secretKey); err != nil {
+		return err
+	}
+
+	return mapping.UnmarshalKey(m, config)
+}
+
+// ExpandEnv replaces ${ENV_VAR} in content with the environment variable,
+// and ${ENV_VAR:default} with default if the variable is not set.
+func ExpandEnv(content []byte) []byte {
+	return envRegex.ReplaceAllFunc(content, func(match []byte) []byte {
+		groups := envRegex.FindSubmatch(match)
+		if value, ok := os.LookupEnv(string(groups[1])); ok {
+			return []byte(value)
+		}
+
+		return groups[2]
+	})
+}
+
+func loadFile(configFile string, data []byte, config interface{}, opts ...LoadOption) error {
+	if err := LoadBytes(data, filepath.Ext(configFile), config, opts...); err != nil {
+		return fmt.Errorf("config file %s: %s", configFile, err)
+	}
+
+	return nil
+}
+
+// overlayEnv sets the fields of t in m with the environment variables, keys is the path of t.
+func overlayEnv(m map[string]interface{}, t reflect.Type, prefix string, keys []string) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key, ok := fieldKey(field)
+		if !ok {
+			continue
+		}
+
+		ft := mapping.Deref(field.Type)
+		if field.Anonymous && len(field.Tag.Get(jsonTag)) == 0 && ft.Kind() == reflect.Struct {
+			if err := overlayEnv(m, ft, prefix, keys); err != nil {
+				return err
+			}
+			continue
+		}
+		if len(field.PkgPath) > 0 {
+			continue
+		}
+
+		path := append(keys[:len(keys):len(keys)], key)
+		if isStruct(ft) {
+			if err := overlayEnv(m, ft, prefix, path); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := strings.ToUpper(prefix + "_" + strings.Join(path, "_"))
+		env, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		value, err := overlayValue(ft, env)
+		if err != nil {
+			return fmt.Errorf("env %s: %s", name, err)
+		}
+		setPath(m, path, value)
+	}
+
+	return nil
+}
+
+// overlay sets the field in m by the override like Log.Level=error.
+func overlay(m map[string]interface{}, t reflect.Type, override string) error {
+	kv := strings.SplitN(override, "=", 2)
+	if len(kv) != 2 {
+		return fmt.Errorf("override %q: expect path=value", override)
+	}
+
+	var path []string
+	for _, name := range strings.Split(strings.TrimSpace(kv[0]), ".") {
+		if !isStruct(t) {
+			return fmt.Errorf("override %q: %s is not a struct", override, strings.Join(path, "."))
+		}
+
+		field, key, ok := findField(t, name)
+		if !ok {
+			return fmt.Errorf("override %q: unknown field %s", override, name)
+		}
+		t = mapping.Deref(field.Type)
+		path = append(path, key)
+	}
+
+	value, err := overlayValue(t, kv[1])
+	if err != nil {
+		return fmt.Errorf("override %q: %s", override, err)
+	}
+	setPath(m, path, value)
+
+	return nil
+}
+
+// overlayValue converts str to the value decoded from the config files for the fields of type t,
+// the structs, maps and slices are in json, the string slices may also be comma separated.
+func overlayValue(t reflect.Type, str string) (interface{}, error) {
+	if t == durationType {
+		return str, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return str, nil
+	case reflect.Bool:
+		return strconv.ParseBool(strings.TrimSpace(str))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return json.Number(strings.TrimSpace(str)), nil
+	default:
+		str = strings.TrimSpace(str)
+		if t.Kind() == reflect.Slice && mapping.Deref(t.Elem()).Kind() == reflect.String &&
+			!strings.HasPrefix(str, "[") {
+			var items []interface{}
+			for _, item := range strings.Split(str, ",") {
+				if item = strings.TrimSpace(item); len(item) > 0 {
+					items = append(items, item)
+				}
+			}
+			return items, nil
+		}
+
+		// reuse the json object decoding
+		m, err := mapping.JsonBytesToMap([]byte(`{"v":` + str + `}`))
+		if err != nil {
+			return nil, fmt.Errorf("invalid json %s", str)
+		}
+		return m["v"], nil
+	}
+}
+
+// setPath sets value in m by path, the keys are matched case-insensitively like the unmarshaling.
+func setPath(m map[string]interface{}, path []string, value interface{}) {
+	for _, key := range path[:len(path)-1] {
+		var next map[string]interface{}
+		for k, v := range m {
+			if strings.EqualFold(k, key) {
+				if sub, ok := v.(map[string]interface{}); ok {
+					next = sub
+					break
+				}
+				delete(m, k)
+			}
+		}
+		if next == nil {
+			next = make(map[string]interface{})
+			m[key] = next
+		}
+		m = next
+	}
+
+	key := path[len(path)-1]
+	for k := range m {
+		if strings.EqualFold(k, key) {
+			delete(m, k)
+		}
+	}
+	m[key] = value
+}
+
+// findField finds the field of t by the key name case-insensitively, the embedded fields included.
+func findField(t reflect.Type, name string) (reflect.StructField, string, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key, ok := fieldKey(field)
+		if !ok {
+			continue
+		}
+
+		ft := mapping.Deref(field.Type)
+		if field.Anonymous && len(field.Tag.Get(jsonTag)) == 0 && ft.Kind() == reflect.Struct {
+			if f, k, ok := findField(ft, name); ok {
+				return f, k, true
+			}
+			continue
+		}
+		if len(field.PkgPath) == 0 && strings.EqualFold(key, name) {
+			return field, key, true
+		}
+	}
+
+	return reflect.StructField{}, "", false
+}
+
+// fieldKey returns the key of field in the config files, false if the field is skipped.
+func fieldKey(field reflect.StructField) (string, bool) {
+	key := strings.TrimSpace(strings.Split(field.Tag.Get(jsonTag), ",")[0])
+	if key == "-" {
+		return "", false
+	}
+	if len(key) == 0 {
+		key = field.Name
+	}
+
+	return key, true
+}
+
+func isStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != reflect.TypeOf(time.Time{})
+}
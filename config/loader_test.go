@@ -0,0 +1,68 @@
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadBytes(t *testing.T) {
+	type config struct {
+		Config
+		Port    int64
+		Proxies []string `json:",optional"`
+	}
+
+	tests := []struct {
+		ext     string
+		content string
+	}{
+		{".json", `{"AppName": "${TEST_APP_NAME}", "Log": {"Level": "${TEST_LOG_LEVEL:error}"}, "Port": 8080}`},
+		{".yaml", "AppName: ${TEST_APP_NAME}\nLog:\n  Level: ${TEST_LOG_LEVEL:error}\nPort: 8080\n"},
+		{".toml", "AppName = \"${TEST_APP_NAME}\"\nPort = 8080\n[Log]\nLevel = \"${TEST_LOG_LEVEL:error}\"\n"},
+	}
+
+	os.Setenv("TEST_APP_NAME", "api")
+	defer os.Unsetenv("TEST_APP_NAME")
+	for _, test := range tests {
+		t.Run(test.ext, func(t *testing.T) {
+			var c config
+			assert.Nil(t, LoadBytes([]byte(test.content), test.ext, &c))
+			assert.Equal(t, "api", c.AppName)
+			assert.Equal(t, "error", c.Log.Level)
+			assert.Equal(t, "console", c.Log.Mode)
+			assert.Equal(t, int64(8080), c.Port)
+		})
+	}
+}
+
+func TestLoadBytesOverlay(t *testing.T) {
+	type config struct {
+		Config
+		Port    int64
+		Proxies []string `json:",optional"`
+	}
+
+	os.Setenv("APP_LOG_LEVEL", "severe")
+	os.Setenv("APP_PROXIES", "10.0.0.1, 10.0.0.2")
+	os.Setenv("APP_PORT", "8081")
+	defer func() {
+		os.Unsetenv("APP_LOG_LEVEL")
+		os.Unsetenv("APP_PROXIES")
+		os.Unsetenv("APP_PORT")
+	}()
+
+	var c config
+	assert.Nil(t, LoadBytes([]byte(`{"log": {"level": "info"}, "port": 8080}`), ".json", &c,
+		UseEnv("APP"), UseOverrides("port=9090", "Log.Mode=file")))
+	assert.Equal(t, "severe", c.Log.Level)
+	assert.Equal(t, "file", c.Log.Mode)
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, c.Proxies)
+	assert.Equal(t, int64(9090), c.Port)
+
+	err := LoadBytes([]byte(`{"port": 8080}`), ".json", &c, UseOverrides("Log.Level=trace"))
+	assert.Equal(t, `Log.Level: value "trace" is not one of debug|info|error|severe`, err.Error())
+	err = LoadBytes([]byte(`{"port": 8080}`), ".json", &c, UseOverrides("Host=localhost"))
+	assert.Equal(t, `override "Host=localhost": unknown field Host`, err.Error())
+}
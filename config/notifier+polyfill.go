@@ -0,0 +1,7 @@
+// +build !linux
+
+package config
+
+func newNotifier(string) (notifier, error) {
+	return nil, errNotifyUnsupported
+}
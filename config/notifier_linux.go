@@ -0,0 +1,89 @@
+// +build linux
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const inotifyMask = unix.IN_CLOSE_WRITE | unix.IN_MODIFY | unix.IN_CREATE | unix.IN_MOVED_TO |
+	unix.IN_MOVED_FROM | unix.IN_DELETE
+
+// inotifyNotifier watches the directory of the file, so that the files replaced by rename,
+// like the ones saved by vim or the kubernetes ConfigMap volumes, are still watched.
+type inotifyNotifier struct {
+	file   *os.File
+	name   string
+	events chan struct{}
+}
+
+func newNotifier(configFile string) (notifier, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := unix.InotifyAddWatch(fd, filepath.Dir(configFile), inotifyMask); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	n := &inotifyNotifier{
+		// the file is non-blocking, so that the pending read returns on close
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		events: make(chan struct{}, 1),
+	}
+	if info, err := os.Lstat(configFile); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		// the targets of symlinks are changed by the other files in the directory
+		n.name = filepath.Base(configFile)
+	}
+	go n.read()
+
+	return n, nil
+}
+
+func (n *inotifyNotifier) Close() error {
+	return n.file.Close()
+}
+
+func (n *inotifyNotifier) Events() <-chan struct{} {
+	return n.events
+}
+
+func (n *inotifyNotifier) read() {
+	buf := make([]byte, (unix.SizeofInotifyEvent+unix.NAME_MAX+1)*16)
+	for {
+		size, err := n.file.Read(buf)
+		if err != nil {
+			return
+		}
+
+		var changed bool
+		for offset := 0; offset+unix.SizeofInotifyEvent <= size; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			start := offset + unix.SizeofInotifyEvent
+			end := start + int(event.Len)
+			if end > size {
+				break
+			}
+
+			name := strings.TrimRight(string(buf[start:end]), "\x00")
+			if len(n.name) == 0 || name == n.name {
+				changed = true
+			}
+			offset = end
+		}
+
+		if changed {
+			select {
+			case n.events <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
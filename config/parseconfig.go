@@ -1,27 +1,60 @@
 package config
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
 	"reflect"
 	"regexp"
 	"strconv"
-	"time"
+	"strings"
 
-	"github.com/weblazy/core/database/redis"
+	"github.com/weblazy/core/mapping"
 	"github.com/weblazy/core/rpcx"
 )
 
 type (
+	// Configure tells the config source of SetConfigureModel.
 	Configure struct {
-		Env          string             //dev,pre,pro环境变量
-		ConfigureRpc rpcx.RpcClientConf //配置中心Rpc
-		Username     string
-		Password     string
-		Network      string //outside外网,inside内网,解决外网内网连接不一致的情况
+		Env string `json:",options=dev|pre|pro"` //dev,pre,pro环境变量
+		// file or kv
+		Source string `json:",default=file,options=file|kv"`
+		// the directory of the file source
+		Dir string `json:",optional"`
+		// the kv source, like http://127.0.0.1:8500, see KVSource
+		Address  string `json:",optional"`
+		Prefix   string `json:",optional"`
+		Token    string `json:",optional"`
+		Username string `json:",optional"`
+		Password string `json:",optional"`
+		// the network of the service, the references are read from env/Network/kind/name first, see UseNetwork
+		Network string `json:",optional,options=outside|inside"` //outside外网,inside内网,解决外网内网连接不一致的情况
+
+		// Deprecated: use Source kv and Address instead,
+		// ConfigureRpc.Server is taken as the Address of the kv source if Address is not set.
+		ConfigureRpc rpcx.RpcClientConf `json:",optional"` //配置中心Rpc
+	}
+
+	// ResolveOption customizes Resolve and NewRemote.
+	ResolveOption func(opts *resolveOptions)
+
+	resolveOptions struct {
+		network string
+	}
+
+	resolver struct {
+		ctx     context.Context
+		source  ConfigSource
+		env     string
+		network string
+		// the versions of the referenced keys
+		versions map[string]uint64
 	}
 )
 
@@ -31,40 +64,122 @@ const (
 	mongoType = "mongo"
 	rpcType   = "rpc"
 	arrType   = "arr"
+
+	allTag = "all"
 )
 
 var (
 	env = flag.String("e", "", "The env file")
-	// configureModel *configure.ConfigureModel
+
+	referenceRegex = regexp.MustCompile(`^\{\{\s*(.+?)\s*\}\}$`)
 )
 
+// UseNetwork reads the references {{kind:name}} from env/network/kind/name first, and env/kind/name
+// if not found, to resolve the addresses differing in the inside and outside networks.
+func UseNetwork(network string) ResolveOption {
+	return func(opts *resolveOptions) {
+		opts.network = network
+	}
+}
+
+// NewSource returns the ConfigSource of c.
+func (c Configure) NewSource() ConfigSource {
+	source, address := c.Source, c.Address
+	if len(address) == 0 && len(c.ConfigureRpc.Server) > 0 {
+		source, address = "kv", c.ConfigureRpc.Server
+		if !strings.Contains(address, "://") {
+			address = "http://" + address
+		}
+	}
+
+	if source == "kv" {
+		return &KVSource{
+			Address:  address,
+			Prefix:   c.Prefix,
+			Token:    c.Token,
+			Username: c.Username,
+			Password: c.Password,
+		}
+	}
+
+	return NewFileSource(c.Dir)
+}
+
+// SetConfigureModel loads configString into config, or with the -e flag, resolves config from
+// the source of the Configure in the -e file, writes it to the json file named by the all tag of the Name field,
+// and exits.
 func SetConfigureModel(configString string, config interface{}) error {
-	var err error
 	if *env != "" {
 		var c Configure
-		// MustLoad(*env, &c) //加载
-		// configureModel = configure.NewConfigureModel(rpcx.MustNewClient(c.ConfigureRpc), c.Username, c.Password, c.Env, c.Network)
-		time.Sleep(time.Duration(1) * time.Second)
-		err = parseConfig(config, c.Env)
-		if err != nil {
-			panic(err)
+		if err := Load(*env, &c); err != nil {
+			return err
+		}
+		if err := Resolve(c.NewSource(), c.Env, config, UseNetwork(c.Network)); err != nil {
+			return err
 		}
 		name, err := parseName(config)
 		if err != nil {
-			panic(err)
+			return err
 		}
-		err = write(name, config)
-		os.Exit(0)
-	} else {
-		data, err := readFile(configString)
-		if err != nil {
+		if err := write(name, config); err != nil {
 			return err
 		}
-		json.Unmarshal(data, config)
+		os.Exit(0)
+	}
+
+	data, err := readFile(configString)
+	if err != nil {
+		return err
 	}
+	return loadFile(configString, data, config)
+}
+
+// Resolve sets the fields of config by their tags of env, or the all tag for all the environments, like:
+//
+//	Port  int64              `dev:"8080" pro:"80"`
+//	Cache redis.RedisConf    `all:"{{redis:cache}}"`
+//	DB    string             `dev:"{{mysql:user}}" pro:"{{mysql:user-master}}"`
+//	Users rpcx.RpcClientConf `all:"{{rpc:user}}"`
+//	Nodes []string           `all:"{{arr:nodes}}"`
+//
+// The references {{kind:name}} are read from source by the keys env/kind/name, the kinds are redis, mysql,
+// mongo, rpc and arr, and {{name}} is read by env/name. The structs are in json, the slices are in json or
+// comma separated, rpc may be just the server address. The fields without tags are left as they are.
+func Resolve(source ConfigSource, env string, config interface{}, opts ...ResolveOption) error {
+	_, err := resolve(context.Background(), source, env, config, newResolveOptions(opts))
 	return err
 }
 
+func newResolveOptions(opts []ResolveOption) resolveOptions {
+	var options resolveOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return options
+}
+
+func resolve(ctx context.Context, source ConfigSource, env string, config interface{},
+	opts resolveOptions) (*resolver, error) {
+	if env != "dev" && env != "pre" && env != "pro" {
+		return nil, fmt.Errorf("The env argument must be in dev,pre,pro")
+	}
+
+	v := reflect.ValueOf(config)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("The ptr argument must be a structure pointer")
+	}
+
+	r := &resolver{
+		ctx:      ctx,
+		source:   source,
+		env:      env,
+		network:  opts.network,
+		versions: make(map[string]uint64),
+	}
+	return r, r.resolveStruct(v.Elem(), "")
+}
+
 func readFile(path string) ([]byte, error) {
 	fi, err := os.Open(path)
 	if err != nil {
@@ -83,13 +198,14 @@ func write(name string, config interface{}) error {
 	if err != nil {
 		return err
 	}
+	defer fd.Close()
 	data, err := json.Marshal(config)
 	if err != nil {
 		return err
 	}
 	buf := []byte(data)
-	fd.Write(buf)
-	return nil
+	_, err = fd.Write(buf)
+	return err
 }
 
 func parseName(ptr interface{}) (string, error) {
@@ -109,170 +225,180 @@ func parseName(ptr interface{}) (string, error) {
 	if name == "" {
 		return "", fmt.Errorf("Name field No Tag named all")
 	}
-	// resp, err := configureModel.Server(name)
-	// if resp == nil || err != nil {
-	// 	return "", fmt.Errorf("No Server named %s", name)
-	// }
-
-	// if resp.ServerType == "api" {
-	// 	v.FieldByName("Host").SetString("0.0.0.0")
-	// 	v.FieldByName("Port").SetInt(resp.Port)
-	// } else if resp.ServerType == "rpc" {
-	// 	v.FieldByName("ListenOn").SetString(fmt.Sprintf("0.0.0.0:%d", resp.Port))
-	// }
 	return name, nil
 }
 
-func parseConfig(ptr interface{}, env string) error {
-	if env != "dev" && env != "pre" && env != "pro" {
-		return fmt.Errorf("The env argument must be in dev,pre,pro")
-	}
-	t := reflect.TypeOf(ptr)
-	v := reflect.ValueOf(ptr).Elem()
-	// 入参类型校验
-	if t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
-		return fmt.Errorf("The ptr argument must be a structure pointer")
-	}
-	count := v.NumField()
-	for i := 0; i < count; i++ {
+func (r *resolver) resolveStruct(v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		fieldInfo := t.Field(i)
+		if len(fieldInfo.PkgPath) > 0 && !fieldInfo.Anonymous {
+			continue
+		}
+
 		field := v.Field(i)
-		fieldInfo := v.Type().Field(i)
 		name := fieldInfo.Name
-		tag := fieldInfo.Tag
-		value := tag.Get("all")
+		if len(prefix) > 0 {
+			name = prefix + "." + name
+		}
+		value := fieldInfo.Tag.Get(allTag)
 		if value == "" {
-			value = tag.Get(env)
+			value = fieldInfo.Tag.Get(r.env)
 		}
-		kind := fieldInfo.Type.Kind()
-		err := setValue(kind, field, value, env, name)
-		if err != nil {
-			return err
+
+		if value == "" {
+			if isStruct(fieldInfo.Type) {
+				if fieldInfo.Anonymous {
+					name = prefix
+				}
+				if err := r.resolveStruct(field, name); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if !field.CanSet() {
+			continue
 		}
 
+		if result := referenceRegex.FindStringSubmatch(value); len(result) > 0 {
+			if err := r.resolveReference(field, name, result[1]); err != nil {
+				return err
+			}
+		} else if err := setValue(field, []byte(value)); err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
 	}
+
 	return nil
 }
 
-func setValue(kind reflect.Kind, field reflect.Value, value, env, name string) error {
-	var err error
+// resolveReference sets field with the value of the reference like redis:cache.
+func (r *resolver) resolveReference(field reflect.Value, name, reference string) error {
+	var kind string
+	parts := strings.SplitN(reference, ":", 2)
+	if len(parts) == 2 {
+		kind = parts[0]
+		if err := checkReferenceKind(kind, field.Type()); err != nil {
+			return fmt.Errorf("%s: {{%s}} %s", name, reference, err)
+		}
+		reference = parts[1]
+	}
+
+	key, value, err := r.get(path.Join(kind, reference))
+	if err != nil {
+		return fmt.Errorf("%s: %s, %s", name, key, err)
+	}
+
+	if kind == rpcType && field.Kind() == reflect.Struct && !bytes.HasPrefix(bytes.TrimSpace(value), []byte("{")) {
+		// the server address only
+		server := field.FieldByName("Server")
+		if !server.IsValid() || server.Kind() != reflect.String {
+			return fmt.Errorf("%s: %s is not a json object", name, key)
+		}
+		server.SetString(string(bytes.TrimSpace(value)))
+		return nil
+	}
+
+	if err := setValue(field, value); err != nil {
+		return fmt.Errorf("%s: %s, %s", name, key, err)
+	}
+
+	return nil
+}
+
+// get reads the key of the network first if set, and returns the key read.
+func (r *resolver) get(key string) (string, []byte, error) {
+	if len(r.network) > 0 {
+		networkKey := path.Join(r.env, r.network, key)
+		value, version, err := r.source.Get(r.ctx, networkKey)
+		if err == nil {
+			r.versions[networkKey] = version
+			return networkKey, value, nil
+		} else if err != ErrSourceNotFound {
+			return networkKey, nil, err
+		}
+	}
+
+	key = path.Join(r.env, key)
+	value, version, err := r.source.Get(r.ctx, key)
+	if err != nil {
+		return key, nil, err
+	}
+	r.versions[key] = version
+
+	return key, value, nil
+}
+
+func checkReferenceKind(kind string, t reflect.Type) error {
 	switch kind {
-	case reflect.Bool:
-		res, _ := strconv.ParseBool(value)
-		field.Set(reflect.ValueOf(res))
-	case reflect.Int:
-		res, _ := strconv.ParseInt(value, 10, 0)
-		field.Set(reflect.ValueOf(int(res)))
-	case reflect.Int8:
-		res, _ := strconv.ParseInt(value, 10, 8)
-		field.Set(reflect.ValueOf(int8(res)))
-	case reflect.Int16:
-		res, _ := strconv.ParseInt(value, 10, 16)
-		field.Set(reflect.ValueOf(int16(res)))
-	case reflect.Int32:
-		res, _ := strconv.ParseInt(value, 10, 32)
-		field.Set(reflect.ValueOf(int32(res)))
-	case reflect.Int64:
-		res, _ := strconv.ParseInt(value, 10, 64)
-		field.Set(reflect.ValueOf(res))
-	case reflect.Uint:
-		res, _ := strconv.ParseUint(value, 10, 0)
-		field.Set(reflect.ValueOf(uint(res)))
-	case reflect.Uint8:
-		res, _ := strconv.ParseUint(value, 10, 8)
-		field.Set(reflect.ValueOf(uint8(res)))
-	case reflect.Uint16:
-		res, _ := strconv.ParseUint(value, 10, 16)
-		field.Set(reflect.ValueOf(uint16(res)))
-	case reflect.Uint32:
-		res, _ := strconv.ParseUint(value, 10, 32)
-		field.Set(reflect.ValueOf(uint32(res)))
-	case reflect.Uint64:
-		res, _ := strconv.ParseUint(value, 10, 64)
-		field.Set(reflect.ValueOf(res))
-	case reflect.Float32:
-		res, _ := strconv.ParseFloat(value, 32)
-		field.Set(reflect.ValueOf(float32(res)))
-	case reflect.Float64:
-		res, _ := strconv.ParseFloat(value, 64)
-		field.Set(reflect.ValueOf(res))
+	case redisType:
+		if t.Kind() != reflect.Struct {
+			return errors.New("must be set to a struct")
+		}
+	case mysqlType, mongoType, rpcType:
+		if t.Kind() != reflect.Struct && t.Kind() != reflect.String {
+			return errors.New("must be set to a struct or string")
+		}
+	case arrType:
+		if t.Kind() != reflect.Slice {
+			return errors.New("must be set to a slice")
+		}
+	default:
+		return fmt.Errorf("has unknown kind %s", kind)
+	}
+
+	return nil
+}
+
+// setValue sets field with value, the structs, maps and slices are in json,
+// the string slices may also be comma separated.
+func setValue(field reflect.Value, value []byte) error {
+	str := strings.TrimSpace(string(value))
+	switch field.Kind() {
 	case reflect.String:
-		// r := regexp.MustCompile("{{(.*)}}")
-		// result := r.FindAllStringSubmatch(value, -1)
-		// if len(result) > 0 {
-		// 	resp, err := configureModel.Source(result[0][1])
-		// 	if resp == nil || err != nil {
-		// 		return err
-		// 	}
-		// 	value = resp.Source
-		// }
-		field.Set(reflect.ValueOf(value))
+		field.SetString(str)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(str)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(str, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(str, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(str, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
 	case reflect.Struct:
-		pointer := field.Addr().Interface()
-		if value != "" {
-			r := regexp.MustCompile("{{(.*)}}")
-			result := r.FindAllStringSubmatch(value, -1)
-			if len(result) > 0 {
-				resp, err := parseStruct(pointer, result[0][1])
-				if err != nil {
-					return err
+		return mapping.UnmarshalJsonBytes(value, field.Addr().Interface())
+	case reflect.Slice:
+		if field.Type().Elem().Kind() == reflect.String && !strings.HasPrefix(str, "[") {
+			var items []string
+			for _, item := range strings.Split(str, ",") {
+				if item = strings.TrimSpace(item); len(item) > 0 {
+					items = append(items, item)
 				}
-				field.Set(resp)
-			}
-		} else {
-			err = parseConfig(pointer, env)
-			if err != nil {
-				return err
 			}
+			field.Set(reflect.ValueOf(items).Convert(field.Type()))
+			return nil
 		}
+		return json.Unmarshal(value, field.Addr().Interface())
 	default:
-		if value != "" {
-			return fmt.Errorf("%s field type is not supported, please use json string instead", name)
-		}
+		return json.Unmarshal(value, field.Addr().Interface())
 	}
-	return nil
-}
 
-func parseStruct(value interface{}, name string) (reflect.Value, error) {
-	var result reflect.Value
-	switch value.(type) {
-	// case *baseconst.AuthConfig:
-	// resp, err := configureModel.Source(name)
-	// if err != nil {
-	// 	return result, err
-	// }
-	// if resp == nil {
-	// 	return result, fmt.Errorf("%s name is not found", name)
-	// }
-	// var auth baseconst.AuthConfig
-	// json.Unmarshal([]byte(resp.Source), &auth)
-	// result = reflect.ValueOf(auth)
-	// return result, nil
-	case *rpcx.RpcClientConf:
-		// resp, err := configureModel.Rpc(name)
-		// if err != nil {
-		// 	return result, err
-		// }
-		// if resp == nil {
-		// 	return result, fmt.Errorf("%s name is not found", name)
-		// }
-		// result = reflect.ValueOf(rpcx.RpcClientConf{
-		// 	Server: resp.Source,
-		// 	App:    "app",
-		// 	Token:  "token",
-		// })
-		// return result, nil
-	case *redis.RedisConf:
-		// resp, err := configureModel.Source(name)
-		// if err != nil {
-		// 	return result, err
-		// }
-		// if resp == nil {
-		// 	return result, fmt.Errorf("%s name is not found", name)
-		// }
-		var redis redis.RedisConf
-		// json.Unmarshal([]byte(resp.Source), &redis)
-		result = reflect.ValueOf(redis)
-		return result, nil
-	}
-	return result, fmt.Errorf("%s type is not found", name)
+	return nil
 }
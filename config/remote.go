@@ -0,0 +1,152 @@
+package config
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/weblazy/core/logx"
+)
+
+// the interval of retrying the failed long polls, keep it as var for unit test
+var remoteRetryInterval = time.Second
+
+// Remote resolves the config from a ConfigSource like Resolve, and keeps it updated by long polling
+// the referenced keys. The changes are published like the ones of Watcher.
+type Remote struct {
+	source     ConfigSource
+	env        string
+	options    resolveOptions
+	configType reflect.Type
+	ctx        context.Context
+	cancel     context.CancelFunc
+	reloadLock sync.Mutex
+	// the watched keys, guarded by reloadLock
+	watching    map[string]struct{}
+	lock        sync.RWMutex
+	current     interface{}
+	subscribers []subscriber
+}
+
+// NewRemote resolves config of env from source, then watches the referenced keys.
+// The fields without tags are kept in the reloaded configs, so config may be loaded from a file first.
+// The keys read first on the reloads are watched as well, like the ones of the network added later.
+func NewRemote(source ConfigSource, env string, config interface{}, opts ...ResolveOption) (*Remote, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	options := newResolveOptions(opts)
+	res, err := resolve(ctx, source, env, config, options)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	r := &Remote{
+		source:     source,
+		env:        env,
+		options:    options,
+		configType: reflect.TypeOf(config).Elem(),
+		ctx:        ctx,
+		cancel:     cancel,
+		watching:   make(map[string]struct{}),
+		current:    config,
+	}
+	r.watchKeys(res.versions)
+
+	return r, nil
+}
+
+// Close stops watching.
+func (r *Remote) Close() {
+	r.cancel()
+}
+
+// Current returns the latest valid config.
+func (r *Remote) Current() interface{} {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.current
+}
+
+// Subscribe calls fn on the changes of the fields in paths, see Watcher.Subscribe.
+func (r *Remote) Subscribe(fn func(Change), paths ...string) {
+	r.lock.Lock()
+	r.subscribers = append(r.subscribers, subscriber{
+		paths: paths,
+		fn:    fn,
+	})
+	r.lock.Unlock()
+}
+
+func (r *Remote) watch(key string, version uint64) {
+	for {
+		_, newVersion, err := r.source.Wait(r.ctx, key, version)
+		if r.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logx.Errorf("config: failed to watch %s, %s", key, err)
+			select {
+			case <-r.ctx.Done():
+				return
+			case <-time.After(remoteRetryInterval):
+				continue
+			}
+		}
+
+		version = newVersion
+		r.reload(key)
+	}
+}
+
+// watchKeys watches the keys not watched yet, it's called on creating or with reloadLock held.
+func (r *Remote) watchKeys(versions map[string]uint64) {
+	for key, version := range versions {
+		if _, ok := r.watching[key]; !ok {
+			r.watching[key] = struct{}{}
+			go r.watch(key, version)
+		}
+	}
+}
+
+func (r *Remote) reload(key string) {
+	// the keys may change together, resolve them one by one
+	r.reloadLock.Lock()
+	defer r.reloadLock.Unlock()
+
+	// the fields without tags are kept, like the ones loaded from files
+	value := reflect.New(r.configType)
+	value.Elem().Set(reflect.ValueOf(r.Current()).Elem())
+	config := value.Interface()
+	res, err := resolve(r.ctx, r.source, r.env, config, r.options)
+	if err != nil {
+		logx.Errorf("config: rejected the change of %s, %s", key, err)
+		return
+	}
+	r.watchKeys(res.versions)
+
+	r.lock.Lock()
+	old := r.current
+	fields := diffConfig(old, config)
+	if len(fields) > 0 {
+		r.current = config
+	}
+	subscribers := r.subscribers
+	r.lock.Unlock()
+	if len(fields) == 0 {
+		return
+	}
+
+	paths := make([]string, len(fields))
+	for i, field := range fields {
+		paths[i] = field.Path
+	}
+	logx.Infof("config: reloaded %s, changed %s", key, strings.Join(paths, ", "))
+
+	publish(subscribers, Change{
+		Old:    old,
+		New:    config,
+		Fields: fields,
+	})
+}
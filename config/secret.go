@@ -0,0 +1,168 @@
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/weblazy/core/aescode"
+)
+
+const (
+	// SecretKeyEnv is the environment variable of the key decrypting the ENC(...) values,
+	// 16, 24 or 32 bytes, or base64 encoded.
+	SecretKeyEnv = "CONFIG_SECRET_KEY"
+	// SecretKeyFileEnv is the environment variable of the key file path, used if SecretKeyEnv is not set.
+	SecretKeyFileEnv = "CONFIG_SECRET_KEY_FILE"
+
+	encryptedPrefix = "ENC("
+	decryptedPrefix = "DEC("
+)
+
+var (
+	// ErrSecretKeyNotSet is returned if the config has ENC(...) values but the key is not provided.
+	ErrSecretKeyNotSet = errors.New("secret key not set, set " + SecretKeyEnv + " or " + SecretKeyFileEnv)
+
+	// EncryptedRegex matches the ENC(...) values in the config files.
+	EncryptedRegex = regexp.MustCompile(`ENC\(([A-Za-z0-9+/=]+)\)`)
+)
+
+// UseSecretKey decrypts the ENC(...) values with key instead of the one in the environment variables.
+func UseSecretKey(key []byte) LoadOption {
+	return func(opts *loadOptions) {
+		opts.secretKey = key
+	}
+}
+
+// LoadSecretKey returns the key in SecretKeyEnv, or in the file of SecretKeyFileEnv.
+func LoadSecretKey() ([]byte, error) {
+	if key, ok := os.LookupEnv(SecretKeyEnv); ok {
+		return ParseSecretKey([]byte(key))
+	}
+
+	if file, ok := os.LookupEnv(SecretKeyFileEnv); ok {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		return ParseSecretKey(content)
+	}
+
+	return nil, ErrSecretKeyNotSet
+}
+
+// ParseSecretKey returns the AES key in content, which is 16, 24 or 32 bytes, or base64 encoded.
+func ParseSecretKey(content []byte) ([]byte, error) {
+	key := strings.TrimSpace(string(content))
+	if decoded, err := base64.StdEncoding.DecodeString(key); err == nil && isAESKey(decoded) {
+		return decoded, nil
+	}
+	if isAESKey([]byte(key)) {
+		return []byte(key), nil
+	}
+
+	return nil, errors.New("secret key must be 16, 24 or 32 bytes, or base64 encoded")
+}
+
+// EncryptValue encrypts plain with AES-GCM into ENC(...).
+func EncryptValue(plain string, key []byte) (string, error) {
+	sealed, err := aescode.GcmEncryptString(plain, key)
+	if err != nil {
+		return "", err
+	}
+
+	return encryptedPrefix + sealed + ")", nil
+}
+
+// DecryptValue decrypts the ENC(...) value.
+func DecryptValue(value string, key []byte) (string, error) {
+	if !isEncrypted(value) {
+		return "", fmt.Errorf("%q is not an ENC(...) value", value)
+	}
+
+	return aescode.GcmDecryptString(value[len(encryptedPrefix):len(value)-1], key)
+}
+
+// decryptSecrets replaces the ENC(...) strings in v with the decrypted values,
+// the key is loaded on the first one.
+func decryptSecrets(v interface{}, path string, key *[]byte) error {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		// sorted to report the same error on the same content
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			decrypted, err := decryptSecret(val[k], joinPath(path, k), key)
+			if err != nil {
+				return err
+			}
+			val[k] = decrypted
+		}
+	case []interface{}:
+		for i, item := range val {
+			decrypted, err := decryptSecret(item, path+"["+strconv.Itoa(i)+"]", key)
+			if err != nil {
+				return err
+			}
+			val[i] = decrypted
+		}
+	}
+
+	return nil
+}
+
+func decryptSecret(v interface{}, path string, key *[]byte) (interface{}, error) {
+	str, ok := v.(string)
+	if !ok {
+		return v, decryptSecrets(v, path, key)
+	}
+
+	if !isEncrypted(str) {
+		return v, nil
+	}
+
+	if len(*key) == 0 {
+		secretKey, err := LoadSecretKey()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		*key = secretKey
+	}
+
+	plain, err := DecryptValue(str, *key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to decrypt, %s", path, err)
+	}
+
+	return plain, nil
+}
+
+func isEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix) && strings.HasSuffix(value, ")")
+}
+
+func isAESKey(key []byte) bool {
+	switch len(key) {
+	case 16, 24, 32:
+		return true
+	default:
+		return false
+	}
+}
+
+func joinPath(prefix, key string) string {
+	if len(prefix) == 0 {
+		return key
+	}
+
+	return prefix + "." + key
+}
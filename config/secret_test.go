@@ -0,0 +1,40 @@
+package config
+
+import (
+	"encoding/base64"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadBytesSecrets(t *testing.T) {
+	type config struct {
+		User  string
+		Pass  string
+		Nodes []string
+	}
+
+	key := []byte("0123456789abcdef")
+	pass, err := EncryptValue("secret", key)
+	assert.Nil(t, err)
+	node, err := EncryptValue("10.0.0.1", key)
+	assert.Nil(t, err)
+	content := []byte("User: root\nPass: " + pass + "\nNodes:\n  - " + node + "\n")
+
+	var c config
+	assert.Nil(t, LoadBytes(content, ".yaml", &c, UseSecretKey(key)))
+	assert.Equal(t, config{User: "root", Pass: "secret", Nodes: []string{"10.0.0.1"}}, c)
+
+	os.Setenv(SecretKeyEnv, base64.StdEncoding.EncodeToString(key))
+	assert.Nil(t, LoadBytes(content, ".yaml", &c))
+	os.Setenv(SecretKeyEnv, "fedcba9876543210")
+	err = LoadBytes(content, ".yaml", &c)
+	assert.Contains(t, err.Error(), "Nodes[0]: failed to decrypt")
+	os.Unsetenv(SecretKeyEnv)
+	assert.Equal(t, "Nodes[0]: "+ErrSecretKeyNotSet.Error(), LoadBytes(content, ".yaml", &c).Error())
+
+	// the DEC(...) values are not encrypted by EncryptFile yet, loaded as they are
+	assert.Nil(t, LoadBytes([]byte(`{"Pass": "DEC(secret)"}`), ".json", &c, UseSecretKey(key)))
+	assert.Equal(t, "DEC(secret)", c.Pass)
+}
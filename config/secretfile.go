@@ -0,0 +1,354 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	doubleQuoted literalStyle = iota
+	// the single quoted yaml strings, the quotes are escaped as ''
+	singleQuoted
+	// the literal toml strings, nothing is escaped
+	literalQuoted
+	// the plain yaml scalars
+	plainScalar
+)
+
+// plainRegex matches the values written as plain yaml scalars as they are.
+var plainRegex = regexp.MustCompile(`^[A-Za-z0-9+/=()._@-]+$`)
+
+type (
+	literalStyle int
+
+	// stringLiteral is a string value in a config file.
+	stringLiteral struct {
+		// the span of the literal in the content, including the quotes
+		start int
+		end   int
+		// the unescaped value
+		value string
+		style literalStyle
+	}
+)
+
+// EncryptFile replaces the DEC(plain) string values in file with the ENC(...) ones encrypted by key.
+// The values are unescaped and escaped by the format of file, .yaml, .yml, .toml or json for the others,
+// the other content is kept as is. It returns the count of the values.
+func EncryptFile(file string, key []byte) (int, error) {
+	return replaceFile(file, func(value string) (string, bool, error) {
+		if !isDecrypted(value) {
+			return "", false, nil
+		}
+
+		sealed, err := EncryptValue(value[len(decryptedPrefix):len(value)-1], key)
+		return sealed, true, err
+	})
+}
+
+// DecryptFile replaces the ENC(...) string values in file with DEC(plain) to edit them,
+// run EncryptFile after the edits. It returns the count of the values.
+func DecryptFile(file string, key []byte) (int, error) {
+	return replaceFile(file, func(value string) (string, bool, error) {
+		if !isEncrypted(value) {
+			return "", false, nil
+		}
+
+		plain, err := DecryptValue(value, key)
+		if err != nil {
+			return "", false, err
+		}
+
+		return decryptedPrefix + plain + ")", true, nil
+	})
+}
+
+// RotateFile re-encrypts the ENC(...) string values in file from oldKey to newKey.
+// It returns the count of the values.
+func RotateFile(file string, oldKey, newKey []byte) (int, error) {
+	return replaceFile(file, func(value string) (string, bool, error) {
+		if !isEncrypted(value) {
+			return "", false, nil
+		}
+
+		plain, err := DecryptValue(value, oldKey)
+		if err != nil {
+			return "", false, err
+		}
+
+		sealed, err := EncryptValue(plain, newKey)
+		return sealed, true, err
+	})
+}
+
+// replaceFile replaces the string values in file with the ones returned by fn if ok,
+// the file is not changed if any of them fails.
+func replaceFile(file string, fn func(value string) (replaced string, ok bool, err error)) (int, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return 0, err
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+
+	var buf bytes.Buffer
+	var count, last int
+	for _, literal := range scanLiterals(content, filepath.Ext(file)) {
+		value, ok, err := fn(literal.value)
+		if err != nil {
+			line := bytes.Count(content[:literal.start], []byte("\n")) + 1
+			return 0, fmt.Errorf("%s:%d: %s", file, line, err)
+		}
+		if !ok {
+			continue
+		}
+
+		buf.Write(content[last:literal.start])
+		buf.WriteString(quoteLiteral(value, literal.style))
+		last = literal.end
+		count++
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	buf.Write(content[last:])
+
+	return count, ioutil.WriteFile(file, buf.Bytes(), info.Mode())
+}
+
+// scanLiterals returns the string values in content by the format of ext, the keys are skipped.
+// The literals failing to unescape are skipped as well, they fail on loading.
+func scanLiterals(content []byte, ext string) []stringLiteral {
+	switch strings.ToLower(ext) {
+	case ".yaml", ".yml":
+		return scanYamlLiterals(content)
+	case ".toml":
+		return scanTomlLiterals(content)
+	default:
+		return scanJsonLiterals(content)
+	}
+}
+
+func scanJsonLiterals(content []byte) []stringLiteral {
+	var literals []stringLiteral
+	for i := 0; i < len(content); i++ {
+		if content[i] != '"' {
+			continue
+		}
+
+		end := closingQuote(content, i)
+		if end < 0 {
+			break
+		}
+		var value string
+		if err := json.Unmarshal(content[i:end], &value); err == nil && !isKey(content, end, ':') {
+			literals = append(literals, stringLiteral{start: i, end: end, value: value, style: doubleQuoted})
+		}
+		i = end - 1
+	}
+
+	return literals
+}
+
+func scanTomlLiterals(content []byte) []stringLiteral {
+	var literals []stringLiteral
+	for i := 0; i < len(content); i++ {
+		switch {
+		case content[i] == '#':
+			i = lineEnd(content, i) - 1
+		case bytes.HasPrefix(content[i:], []byte(`"""`)), bytes.HasPrefix(content[i:], []byte("'''")):
+			// the multi-line strings are kept as they are
+			end := bytes.Index(content[i+3:], content[i:i+3])
+			if end < 0 {
+				return literals
+			}
+			i += end + 5
+		case content[i] == '"':
+			end := closingQuote(content, i)
+			if end < 0 {
+				return literals
+			}
+			var v struct {
+				V string
+			}
+			if _, err := toml.Decode("V = "+string(content[i:end]), &v); err == nil && !isKey(content, end, '=') {
+				literals = append(literals, stringLiteral{start: i, end: end, value: v.V, style: doubleQuoted})
+			}
+			i = end - 1
+		case content[i] == '\'':
+			end := bytes.IndexByte(content[i+1:], '\'')
+			if end < 0 {
+				return literals
+			}
+			end += i + 2
+			if !isKey(content, end, '=') {
+				literals = append(literals, stringLiteral{
+					start: i,
+					end:   end,
+					value: string(content[i+1 : end-1]),
+					style: literalQuoted,
+				})
+			}
+			i = end - 1
+		}
+	}
+
+	return literals
+}
+
+// scanYamlLiterals returns the quoted scalars and the plain ones of ENC(...) or DEC(...) in content,
+// the plain scalars are taken to the end of the line, so they are not supported in the flow collections.
+func scanYamlLiterals(content []byte) []stringLiteral {
+	var literals []stringLiteral
+	for i := 0; i < len(content); i++ {
+		switch {
+		case content[i] == '#' && (i == 0 || isBlank(content[i-1])):
+			i = lineEnd(content, i) - 1
+		case !isYamlScalarStart(content, i):
+		case content[i] == '"':
+			end := closingQuote(content, i)
+			if end < 0 {
+				return literals
+			}
+			var value string
+			if err := yaml.Unmarshal(content[i:end], &value); err == nil && !isKey(content, end, ':') {
+				literals = append(literals, stringLiteral{start: i, end: end, value: value, style: doubleQuoted})
+			}
+			i = end - 1
+		case content[i] == '\'':
+			end := closingSingleQuote(content, i)
+			if end < 0 {
+				return literals
+			}
+			if !isKey(content, end, ':') {
+				literals = append(literals, stringLiteral{
+					start: i,
+					end:   end,
+					value: strings.Replace(string(content[i+1:end-1]), "''", "'", -1),
+					style: singleQuoted,
+				})
+			}
+			i = end - 1
+		case bytes.HasPrefix(content[i:], []byte(encryptedPrefix)),
+			bytes.HasPrefix(content[i:], []byte(decryptedPrefix)):
+			line := content[i:lineEnd(content, i)]
+			if comment := bytes.Index(line, []byte(" #")); comment >= 0 {
+				line = line[:comment]
+			}
+			value := strings.TrimRight(string(line), " \t\r")
+			literals = append(literals, stringLiteral{start: i, end: i + len(value), value: value, style: plainScalar})
+			i += len(line) - 1
+		}
+	}
+
+	return literals
+}
+
+// quoteLiteral returns value as a literal in style, the double quoted strings are valid in json, yaml and toml.
+func quoteLiteral(value string, style literalStyle) string {
+	switch style {
+	case plainScalar:
+		if plainRegex.MatchString(value) {
+			return value
+		}
+	case singleQuoted:
+		if !strings.Contains(value, "\n") {
+			return "'" + strings.Replace(value, "'", "''", -1) + "'"
+		}
+	case literalQuoted:
+		if !strings.ContainsAny(value, "'\n") {
+			return "'" + value + "'"
+		}
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(value)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// closingQuote returns the index after the double quote closing the one at start, -1 if not closed.
+func closingQuote(content []byte, start int) int {
+	for i := start + 1; i < len(content); i++ {
+		switch content[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+
+	return -1
+}
+
+// closingSingleQuote returns the index after the single quote closing the one at start, -1 if not closed.
+func closingSingleQuote(content []byte, start int) int {
+	for i := start + 1; i < len(content); i++ {
+		if content[i] != '\'' {
+			continue
+		}
+		if i+1 < len(content) && content[i+1] == '\'' {
+			i++
+			continue
+		}
+		return i + 1
+	}
+
+	return -1
+}
+
+// isKey tells whether the literal ending at end is a key followed by sep.
+func isKey(content []byte, end int, sep byte) bool {
+	for i := end; i < len(content); i++ {
+		if !isBlank(content[i]) {
+			return content[i] == sep
+		}
+	}
+
+	return false
+}
+
+// isYamlScalarStart tells whether a scalar may start at i, after an indicator or at the line start.
+func isYamlScalarStart(content []byte, i int) bool {
+	for j := i - 1; j >= 0; j-- {
+		switch content[j] {
+		case ' ', '\t':
+		case '\n':
+			return true
+		case ':', '-', '?', '[', '{', ',':
+			return j < i-1 || content[j] != ':'
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func isBlank(b byte) bool {
+	return b == ' ' || b == '\t'
+}
+
+func isDecrypted(value string) bool {
+	return strings.HasPrefix(value, decryptedPrefix) && strings.HasSuffix(value, ")")
+}
+
+func lineEnd(content []byte, start int) int {
+	if end := bytes.IndexByte(content[start:], '\n'); end >= 0 {
+		return start + end
+	}
+
+	return len(content)
+}
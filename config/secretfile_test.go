@@ -0,0 +1,140 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secret")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "app.json")
+	assert.Nil(t, ioutil.WriteFile(file, []byte(`{"User": "root", "Pass": "DEC(secret)"}`), 0600))
+	key := []byte("0123456789abcdef")
+	newKey := []byte("0123456789abcdef01234567")
+
+	count, err := EncryptFile(file, key)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	count, err = RotateFile(file, key, newKey)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	_, err = DecryptFile(file, key)
+	assert.NotNil(t, err)
+
+	var c struct {
+		User string
+		Pass string
+	}
+	content, err := ioutil.ReadFile(file)
+	assert.Nil(t, err)
+	assert.Nil(t, LoadBytes(content, ".json", &c, UseSecretKey(newKey)))
+	assert.Equal(t, "secret", c.Pass)
+
+	count, err = DecryptFile(file, newKey)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	content, err = ioutil.ReadFile(file)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"User": "root", "Pass": "DEC(secret)"}`, string(content))
+}
+
+func TestSecretFileEscapes(t *testing.T) {
+	type config struct {
+		User  string
+		Pass  string
+		Token string
+		Nodes []string
+	}
+
+	tests := []struct {
+		name    string
+		ext     string
+		content string
+		// the content written back by DecryptFile if not the same
+		decrypted string
+		expect    config
+	}{
+		{
+			name: "json",
+			ext:  ".json",
+			content: `{
+  "User": "DEC(",
+  "DEC(key)": "root",
+  "Pass": "DEC(p)a\"s\\s)",
+  "Token": "DEC(té\n)",
+  "Nodes": ["DEC(a)b)", "DEC(c\\)"]
+}`,
+			expect: config{User: "DEC(", Pass: `p)a"s\s`, Token: "té\n", Nodes: []string{"a)b", `c\`}},
+		},
+		{
+			name: "yaml",
+			ext:  ".yaml",
+			content: `# Pass: DEC(comment)
+User: root
+Pass: "DEC(p)a\"s\\s)"
+Token: 'DEC(it''s \ raw)'
+Nodes:
+  - DEC(a)b) # the node
+  - DEC(c"\)
+`,
+			decrypted: `# Pass: DEC(comment)
+User: root
+Pass: "DEC(p)a\"s\\s)"
+Token: 'DEC(it''s \ raw)'
+Nodes:
+  - DEC(a)b) # the node
+  - "DEC(c\"\\)"
+`,
+			expect: config{User: "root", Pass: `p)a"s\s`, Token: `it's \ raw`, Nodes: []string{"a)b", `c"\`}},
+		},
+		{
+			name: "toml",
+			ext:  ".toml",
+			content: `# Pass = "DEC(comment)"
+User = "root"
+Pass = "DEC(p)a\"s\\s)"
+Token = 'DEC(c:\raw)'
+Nodes = ["DEC(a)b)", '''DEC(multi)''']
+`,
+			expect: config{User: "root", Pass: `p)a"s\s`, Token: `c:\raw`, Nodes: []string{"a)b", "DEC(multi)"}},
+		},
+	}
+
+	key := []byte("0123456789abcdef")
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "secret")
+			assert.Nil(t, err)
+			defer os.RemoveAll(dir)
+
+			file := filepath.Join(dir, "app"+test.ext)
+			assert.Nil(t, ioutil.WriteFile(file, []byte(test.content), 0600))
+			_, err = EncryptFile(file, key)
+			assert.Nil(t, err)
+
+			content, err := ioutil.ReadFile(file)
+			assert.Nil(t, err)
+			assert.NotContains(t, string(content), "DEC(p)")
+			var c config
+			assert.Nil(t, LoadBytes(content, test.ext, &c, UseSecretKey(key)))
+			assert.Equal(t, test.expect, c)
+
+			_, err = DecryptFile(file, key)
+			assert.Nil(t, err)
+			content, err = ioutil.ReadFile(file)
+			assert.Nil(t, err)
+			if len(test.decrypted) > 0 {
+				assert.Equal(t, test.decrypted, string(content))
+			} else {
+				assert.Equal(t, test.content, string(content))
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultKVWaitTime = 30 * time.Second
+	consulIndexHeader = "X-Consul-Index"
+)
+
+var (
+	// ErrSourceNotFound is returned if the key is not found in the ConfigSource.
+	ErrSourceNotFound = errors.New("config source not found")
+
+	// the interval of checking the files on Wait, keep it as var for unit test
+	fileWaitInterval = time.Second
+)
+
+type (
+	// ConfigSource provides the config values by the keys like pro/redis/cache,
+	// the versions tell the changes of the values.
+	ConfigSource interface {
+		// Get returns the value of key and its version.
+		Get(ctx context.Context, key string) (value []byte, version uint64, err error)
+		// Wait long polls key, it returns the value once the version is different from version,
+		// or returns the error of ctx.
+		Wait(ctx context.Context, key string, version uint64) (value []byte, newVersion uint64, err error)
+	}
+
+	// FileSource reads the values from the files under Dir, key pro/redis/cache is read from
+	// Dir/pro/redis/cache, or Dir/pro/redis/cache.json if not exists.
+	FileSource struct {
+		Dir string
+	}
+
+	// KVSource reads the values from a KV store with the consul KV http api,
+	// key pro/redis/cache is read from Address/v1/kv/Prefix/pro/redis/cache.
+	KVSource struct {
+		// Address is like http://127.0.0.1:8500
+		Address string
+		Prefix  string
+		// Token is sent in X-Consul-Token, or the basic auth with Username and Password is used
+		Token    string
+		Username string
+		Password string
+		// WaitTime is the max duration of a long poll request, 30s if zero.
+		WaitTime time.Duration
+		// Client is http.DefaultClient if nil.
+		Client *http.Client
+	}
+)
+
+// NewFileSource returns a FileSource reading the files under dir.
+func NewFileSource(dir string) *FileSource {
+	return &FileSource{
+		Dir: dir,
+	}
+}
+
+func (s *FileSource) Get(ctx context.Context, key string) ([]byte, uint64, error) {
+	file, info, err := s.stat(key)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	value, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return value, fileVersion(info), nil
+}
+
+// Wait checks the modification time of the file every second, the files don't support long polls.
+func (s *FileSource) Wait(ctx context.Context, key string, version uint64) ([]byte, uint64, error) {
+	ticker := time.NewTicker(fileWaitInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, info, err := s.stat(key); err == nil && fileVersion(info) != version {
+			return s.Get(ctx, key)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, 0, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *FileSource) stat(key string) (string, os.FileInfo, error) {
+	file := filepath.Join(s.Dir, filepath.FromSlash(path.Clean("/"+key)))
+	info, err := os.Stat(file)
+	if os.IsNotExist(err) {
+		file += ".json"
+		info, err = os.Stat(file)
+	}
+	if os.IsNotExist(err) {
+		return "", nil, ErrSourceNotFound
+	} else if err != nil {
+		return "", nil, err
+	}
+
+	return file, info, nil
+}
+
+// NewKVSource returns a KVSource of the KV store at address.
+func NewKVSource(address, prefix string) *KVSource {
+	return &KVSource{
+		Address: address,
+		Prefix:  prefix,
+	}
+}
+
+func (s *KVSource) Get(ctx context.Context, key string) ([]byte, uint64, error) {
+	return s.request(ctx, key, nil)
+}
+
+// Wait sends the blocking queries of the KV store until the value changes.
+func (s *KVSource) Wait(ctx context.Context, key string, version uint64) ([]byte, uint64, error) {
+	waitTime := s.WaitTime
+	if waitTime <= 0 {
+		waitTime = defaultKVWaitTime
+	}
+
+	for {
+		value, newVersion, err := s.request(ctx, key, url.Values{
+			"index": []string{strconv.FormatUint(version, 10)},
+			"wait":  []string{strconv.FormatInt(int64(waitTime/time.Millisecond), 10) + "ms"},
+		})
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, 0, ctxErr
+			}
+			return nil, 0, err
+		}
+		// the same index is returned on timeout
+		if newVersion != version {
+			return value, newVersion, nil
+		}
+	}
+}
+
+func (s *KVSource) request(ctx context.Context, key string, query url.Values) ([]byte, uint64, error) {
+	if query == nil {
+		query = make(url.Values)
+	}
+	query.Set("raw", "")
+
+	u := strings.TrimSuffix(s.Address, "/") + "/v1/kv/" + strings.TrimPrefix(path.Join(s.Prefix, key), "/") +
+		"?" + query.Encode()
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req = req.WithContext(ctx)
+	if len(s.Token) > 0 {
+		req.Header.Set("X-Consul-Token", s.Token)
+	} else if len(s.Username) > 0 {
+		req.SetBasicAuth(s.Username, s.Password)
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	value, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, 0, ErrSourceNotFound
+	default:
+		return nil, 0, fmt.Errorf("unexpected status %d, %s", resp.StatusCode, strings.TrimSpace(string(value)))
+	}
+
+	version, err := strconv.ParseUint(resp.Header.Get(consulIndexHeader), 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("bad %s header", consulIndexHeader)
+	}
+
+	return value, version, nil
+}
+
+func fileVersion(info os.FileInfo) uint64 {
+	return uint64(info.ModTime().UnixNano())
+}
@@ -0,0 +1,240 @@
+package config
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/weblazy/core/database/redis"
+	"github.com/weblazy/core/rpcx"
+)
+
+type (
+	resolvedConfig struct {
+		Name  string             `all:"user"`
+		Port  int64              `dev:"8080" pro:"80"`
+		Cache redis.RedisConf    `all:"{{redis:cache}}"`
+		DB    string             `dev:"{{mysql:user}}" pro:"{{mysql:user-master}}"`
+		Users rpcx.RpcClientConf `all:"{{rpc:user}}"`
+		Nodes []string           `all:"{{arr:nodes}}"`
+		Mode  string
+	}
+
+	// fakeKV serves the consul KV http api with the blocking queries.
+	fakeKV struct {
+		lock    sync.Mutex
+		index   uint64
+		values  map[string]string
+		indexes map[string]uint64
+		changed chan struct{}
+	}
+)
+
+func newFakeKV() *fakeKV {
+	return &fakeKV{
+		values:  make(map[string]string),
+		indexes: make(map[string]uint64),
+		changed: make(chan struct{}),
+	}
+}
+
+func (kv *fakeKV) put(key, value string) {
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+
+	kv.index++
+	kv.values[key] = value
+	kv.indexes[key] = kv.index
+	close(kv.changed)
+	kv.changed = make(chan struct{})
+}
+
+func (kv *fakeKV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+	index, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64)
+	wait, _ := time.ParseDuration(r.URL.Query().Get("wait"))
+	timeout := time.After(wait)
+
+	for {
+		kv.lock.Lock()
+		value, ok := kv.values[key]
+		current := kv.indexes[key]
+		changed := kv.changed
+		kv.lock.Unlock()
+
+		if index == 0 || current != index {
+			w.Header().Set(consulIndexHeader, strconv.FormatUint(current, 10))
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte(value))
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-timeout:
+			w.Header().Set(consulIndexHeader, strconv.FormatUint(current, 10))
+			w.Write([]byte(value))
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func TestResolveKVSource(t *testing.T) {
+	kv := newFakeKV()
+	kv.put("app/pro/redis/cache", `{"Host": "127.0.0.1:6379"}`)
+	kv.put("app/pro/mysql/user-master", "root@tcp(127.0.0.1:3306)/user")
+	kv.put("app/pro/rpc/user", "127.0.0.1:3456")
+	kv.put("app/pro/arr/nodes", "a, b")
+	svr := httptest.NewServer(kv)
+	defer svr.Close()
+
+	c := resolvedConfig{Mode: "file"}
+	assert.Nil(t, Resolve(NewKVSource(svr.URL, "app"), "pro", &c))
+	assert.Equal(t, resolvedConfig{
+		Name:  "user",
+		Port:  80,
+		Cache: redis.RedisConf{Host: "127.0.0.1:6379", Type: "node"},
+		DB:    "root@tcp(127.0.0.1:3306)/user",
+		Users: rpcx.RpcClientConf{Server: "127.0.0.1:3456"},
+		Nodes: []string{"a", "b"},
+		Mode:  "file",
+	}, c)
+
+	err := Resolve(NewKVSource(svr.URL, "app"), "dev", &c)
+	assert.Equal(t, "Cache: dev/redis/cache, config source not found", err.Error())
+	err = Resolve(NewKVSource(svr.URL, "app"), "test", &c)
+	assert.NotNil(t, err)
+}
+
+func TestRemote(t *testing.T) {
+	kv := newFakeKV()
+	kv.put("dev/redis/cache", `{"Host": "127.0.0.1:6379"}`)
+	kv.put("dev/mysql/user", "user-1")
+	kv.put("dev/rpc/user", `{"Server": "127.0.0.1:3456", "App": "user"}`)
+	kv.put("dev/arr/nodes", `["a"]`)
+	svr := httptest.NewServer(kv)
+	defer svr.Close()
+
+	source := NewKVSource(svr.URL, "")
+	source.WaitTime = 50 * time.Millisecond
+	c := resolvedConfig{Mode: "file"}
+	r, err := NewRemote(source, "dev", &c)
+	assert.Nil(t, err)
+	defer r.Close()
+
+	changes := make(chan Change, 10)
+	r.Subscribe(func(change Change) {
+		changes <- change
+	}, "DB")
+
+	// rejected, the old config is retained
+	kv.put("dev/redis/cache", `{"Host": "127.0.0.1:6379", "Type": "sentinel"}`)
+	kv.put("dev/mysql/user", "user-2")
+	assertNoChange(t, changes)
+	assert.Equal(t, &c, r.Current())
+
+	kv.put("dev/redis/cache", `{"Host": "127.0.0.1:6379"}`)
+	select {
+	case change := <-changes:
+		assert.Equal(t, []FieldChange{{Path: "DB", Old: "user-1", New: "user-2"}}, change.Fields)
+		assert.Equal(t, "file", change.New.(*resolvedConfig).Mode)
+	case <-time.After(2 * time.Second):
+		t.Fatal("no change")
+	}
+}
+
+func TestRemoteNewKeys(t *testing.T) {
+	kv := newFakeKV()
+	kv.put("dev/redis/cache", `{"Host": "127.0.0.1:6379"}`)
+	kv.put("dev/mysql/user", "user-1")
+	kv.put("dev/rpc/user", "127.0.0.1:3456")
+	kv.put("dev/arr/nodes", `["a"]`)
+	svr := httptest.NewServer(kv)
+	defer svr.Close()
+
+	source := NewKVSource(svr.URL, "")
+	source.WaitTime = 50 * time.Millisecond
+	var c resolvedConfig
+	r, err := NewRemote(source, "dev", &c, UseNetwork("inside"))
+	assert.Nil(t, err)
+	defer r.Close()
+
+	changes := make(chan Change, 10)
+	r.Subscribe(func(change Change) {
+		changes <- change
+	}, "DB")
+	expectDB := func(db string) {
+		select {
+		case change := <-changes:
+			assert.Equal(t, db, change.New.(*resolvedConfig).DB)
+		case <-time.After(2 * time.Second):
+			t.Fatal("no change")
+		}
+	}
+
+	// the key of the network is not watched yet, read on the reload of the other key
+	kv.put("dev/inside/mysql/user", "inside-1")
+	kv.put("dev/mysql/user", "user-2")
+	expectDB("inside-1")
+
+	// watched after the reload
+	kv.put("dev/inside/mysql/user", "inside-2")
+	expectDB("inside-2")
+}
+
+func TestConfigureSource(t *testing.T) {
+	var c Configure
+	assert.Nil(t, LoadBytes([]byte(`{"Env": "dev"}`), ".json", &c))
+	assert.Equal(t, NewFileSource(""), c.NewSource())
+
+	assert.Nil(t, LoadBytes([]byte(`{"Env": "dev", "Network": "inside",
+		"ConfigureRpc": {"Server": "127.0.0.1:8500", "App": "app", "Token": "token"}}`), ".json", &c))
+	assert.Equal(t, &KVSource{Address: "http://127.0.0.1:8500"}, c.NewSource())
+
+	err := LoadBytes([]byte(`{"Env": "dev", "Network": "lan"}`), ".json", &c)
+	assert.NotNil(t, err)
+}
+
+func TestFileSource(t *testing.T) {
+	fileWaitInterval = 10 * time.Millisecond
+	defer func() {
+		fileWaitInterval = time.Second
+	}()
+
+	dir, err := ioutil.TempDir("", "source")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "dev", "redis"), 0755))
+	file := filepath.Join(dir, "dev", "redis", "cache.json")
+	assert.Nil(t, ioutil.WriteFile(file, []byte(`{"Host": "localhost:6379"}`), 0644))
+
+	source := NewFileSource(dir)
+	value, version, err := source.Get(context.Background(), "dev/redis/cache")
+	assert.Nil(t, err)
+	assert.Equal(t, `{"Host": "localhost:6379"}`, string(value))
+	_, _, err = source.Get(context.Background(), "dev/redis/session")
+	assert.Equal(t, ErrSourceNotFound, err)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		ioutil.WriteFile(file, []byte(`{"Host": "redis:6379"}`), 0644)
+		os.Chtimes(file, time.Now(), time.Now().Add(time.Second))
+	}()
+	value, _, err = source.Wait(context.Background(), "dev/redis/cache", version)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"Host": "redis:6379"}`, string(value))
+}
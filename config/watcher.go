@@ -0,0 +1,354 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/weblazy/core/fs"
+	"github.com/weblazy/core/logx"
+	"github.com/weblazy/core/threading"
+)
+
+const (
+	defaultPollInterval = 5 * time.Second
+	// the editors and kubernetes write the files in several steps, reload after they settle
+	reloadDelay = 100 * time.Millisecond
+)
+
+var errNotifyUnsupported = errors.New("file notification is not supported")
+
+type (
+	// FieldChange is a changed field of the config, Path is like Log.Level, the slices and maps change as a whole.
+	FieldChange struct {
+		Path string
+		Old  interface{}
+		New  interface{}
+	}
+
+	// Change is published to the subscribers after the config file is reloaded,
+	// Old and New point to the configs of the type passed to NewWatcher, they must not be modified.
+	Change struct {
+		Old    interface{}
+		New    interface{}
+		Fields []FieldChange
+	}
+
+	// WatchOption customizes the Watcher.
+	WatchOption func(w *Watcher)
+
+	// Watcher reloads the config file on changes and publishes the changes to the subscribers,
+	// the invalid edits are logged and rejected with the old config retained. Like:
+	//	w.Subscribe(func(c config.Change) {
+	//		logx.SetLevelName(c.New.(*ApiConfig).Log.Level)
+	//	}, "Log.Level")
+	Watcher struct {
+		configFile   string
+		configType   reflect.Type
+		loadOptions  []LoadOption
+		validate     func(config interface{}) error
+		pollInterval time.Duration
+		polling      bool
+		lock         sync.RWMutex
+		current      interface{}
+		content      []byte
+		subscribers  []subscriber
+		done         chan struct{}
+		closeOnce    sync.Once
+	}
+
+	subscriber struct {
+		paths []string
+		fn    func(Change)
+	}
+
+	notifier interface {
+		Events() <-chan struct{}
+		Close() error
+	}
+)
+
+// WithLoadOptions loads the config file with opts, like UseEnv.
+func WithLoadOptions(opts ...LoadOption) WatchOption {
+	return func(w *Watcher) {
+		w.loadOptions = append(w.loadOptions, opts...)
+	}
+}
+
+// WithPolling checks the config file every interval instead of the file notifications,
+// for the file systems not notifying the changes, like some network file systems.
+func WithPolling(interval time.Duration) WatchOption {
+	return func(w *Watcher) {
+		w.polling = true
+		w.pollInterval = interval
+	}
+}
+
+// WithValidator rejects the reloaded configs failing validate, besides the ones failing the tag options.
+func WithValidator(validate func(config interface{}) error) WatchOption {
+	return func(w *Watcher) {
+		w.validate = validate
+	}
+}
+
+// NewWatcher loads configFile into config like Load, then watches the changes of configFile,
+// with inotify on linux, or by polling on the other systems.
+// The reloaded configs are new values of the type of config, see Current.
+func NewWatcher(configFile string, config interface{}, opts ...WatchOption) (*Watcher, error) {
+	w := &Watcher{
+		configFile:   configFile,
+		configType:   reflect.TypeOf(config).Elem(),
+		pollInterval: defaultPollInterval,
+		done:         make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	content, err := fs.ReadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.load(content, config); err != nil {
+		return nil, err
+	}
+	w.current = config
+	w.content = content
+
+	var events <-chan struct{}
+	if !w.polling {
+		n, err := newNotifier(configFile)
+		if err != nil {
+			logx.Errorf("config: watch %s by polling every %s, %s", configFile, w.pollInterval, err)
+			w.polling = true
+		} else {
+			events = n.Events()
+			go func() {
+				<-w.done
+				n.Close()
+			}()
+		}
+	}
+	go w.run(events)
+
+	return w, nil
+}
+
+// MustNewWatcher is like NewWatcher, but exits on errors.
+func MustNewWatcher(configFile string, config interface{}, opts ...WatchOption) *Watcher {
+	w, err := NewWatcher(configFile, config, opts...)
+	if err != nil {
+		logx.Fatal(err)
+	}
+
+	return w
+}
+
+// Close stops watching.
+func (w *Watcher) Close() {
+	w.closeOnce.Do(func() {
+		close(w.done)
+	})
+}
+
+// Current returns the latest valid config.
+func (w *Watcher) Current() interface{} {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	return w.current
+}
+
+// Subscribe calls fn on the changes of the fields in paths, like Log or Log.Level,
+// or on all the changes if no paths. The paths are matched case-insensitively.
+func (w *Watcher) Subscribe(fn func(Change), paths ...string) {
+	w.lock.Lock()
+	w.subscribers = append(w.subscribers, subscriber{
+		paths: paths,
+		fn:    fn,
+	})
+	w.lock.Unlock()
+}
+
+// Changed tells whether the field at path, or the fields under path, changed.
+func (c Change) Changed(path string) bool {
+	for _, field := range c.Fields {
+		if matchPath(field.Path, path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (w *Watcher) run(events <-chan struct{}) {
+	var poll <-chan time.Time
+	if w.polling {
+		ticker := time.NewTicker(w.pollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	delay := time.NewTimer(reloadDelay)
+	delay.Stop()
+	defer delay.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-events:
+			delay.Reset(reloadDelay)
+		case <-delay.C:
+			w.reload()
+		case <-poll:
+			w.reload()
+		}
+	}
+}
+
+func (w *Watcher) reload() {
+	content, err := fs.ReadFile(w.configFile)
+	if err != nil {
+		logx.Errorf("config: failed to read %s, %s", w.configFile, err)
+		return
+	}
+
+	w.lock.RLock()
+	unchanged := bytes.Equal(content, w.content)
+	old := w.current
+	w.lock.RUnlock()
+	if unchanged {
+		return
+	}
+
+	config := reflect.New(w.configType).Interface()
+	if err := w.load(content, config); err != nil {
+		logx.Errorf("config: rejected the change of %s, %s", w.configFile, err)
+		return
+	}
+
+	fields := diffConfig(old, config)
+	w.lock.Lock()
+	w.content = content
+	if len(fields) > 0 {
+		w.current = config
+	}
+	subscribers := w.subscribers
+	w.lock.Unlock()
+	if len(fields) == 0 {
+		return
+	}
+
+	paths := make([]string, len(fields))
+	for i, field := range fields {
+		paths[i] = field.Path
+	}
+	logx.Infof("config: reloaded %s, changed %s", w.configFile, strings.Join(paths, ", "))
+
+	publish(subscribers, Change{
+		Old:    old,
+		New:    config,
+		Fields: fields,
+	})
+}
+
+func (w *Watcher) load(content []byte, config interface{}) error {
+	if err := loadFile(w.configFile, content, config, w.loadOptions...); err != nil {
+		return err
+	}
+
+	if w.validate != nil {
+		if err := w.validate(config); err != nil {
+			return fmt.Errorf("config file %s: %s", w.configFile, err)
+		}
+	}
+
+	return nil
+}
+
+func (c Change) changedAny(paths []string) bool {
+	for _, path := range paths {
+		if c.Changed(path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// publish calls the subscribers of the changed paths.
+func publish(subscribers []subscriber, change Change) {
+	for _, sub := range subscribers {
+		if len(sub.paths) > 0 && !change.changedAny(sub.paths) {
+			continue
+		}
+
+		threading.RunSafe(func() {
+			sub.fn(change)
+		})
+	}
+}
+
+// diffConfig returns the changed fields between the config pointers.
+func diffConfig(old, new interface{}) []FieldChange {
+	var changes []FieldChange
+	diffValue("", reflect.ValueOf(old).Elem(), reflect.ValueOf(new).Elem(), &changes)
+	return changes
+}
+
+func diffValue(path string, old, new reflect.Value, changes *[]FieldChange) {
+	if old.Kind() == reflect.Ptr {
+		if old.IsNil() || new.IsNil() {
+			if old.IsNil() != new.IsNil() {
+				*changes = append(*changes, FieldChange{Path: path, Old: old.Interface(), New: new.Interface()})
+			}
+			return
+		}
+
+		diffValue(path, old.Elem(), new.Elem(), changes)
+		return
+	}
+
+	if !isStruct(old.Type()) {
+		if !reflect.DeepEqual(old.Interface(), new.Interface()) {
+			*changes = append(*changes, FieldChange{Path: path, Old: old.Interface(), New: new.Interface()})
+		}
+		return
+	}
+
+	t := old.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key, ok := fieldKey(field)
+		if !ok {
+			continue
+		}
+
+		if field.Anonymous && len(field.Tag.Get(jsonTag)) == 0 && isStruct(field.Type) {
+			diffValue(path, old.Field(i), new.Field(i), changes)
+			continue
+		}
+		if len(field.PkgPath) > 0 {
+			continue
+		}
+
+		fieldPath := key
+		if len(path) > 0 {
+			fieldPath = path + "." + key
+		}
+		diffValue(fieldPath, old.Field(i), new.Field(i), changes)
+	}
+}
+
+func matchPath(fieldPath, path string) bool {
+	if len(fieldPath) < len(path) {
+		return false
+	}
+
+	return strings.EqualFold(fieldPath[:len(path)], path) &&
+		(len(fieldPath) == len(path) || fieldPath[len(path)] == '.')
+}
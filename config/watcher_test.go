@@ -0,0 +1,88 @@
+package config
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type watchedConfig struct {
+	Config
+	Port    int64
+	Timeout int64 `json:",default=1000"`
+}
+
+func TestWatcher(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []WatchOption
+	}{
+		{"notify", nil},
+		{"polling", []WatchOption{WithPolling(10 * time.Millisecond)}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "config")
+			assert.Nil(t, err)
+			defer os.RemoveAll(dir)
+
+			file := filepath.Join(dir, "app.yaml")
+			assert.Nil(t, ioutil.WriteFile(file, []byte("Port: 8080\nLog:\n  Level: info\n"), 0644))
+
+			var c watchedConfig
+			opts := append(test.opts, WithValidator(func(config interface{}) error {
+				if config.(*watchedConfig).Port == 1 {
+					return errors.New("reserved port")
+				}
+				return nil
+			}))
+			w, err := NewWatcher(file, &c, opts...)
+			assert.Nil(t, err)
+			defer w.Close()
+			assert.Equal(t, int64(8080), c.Port)
+
+			changes := make(chan Change, 10)
+			w.Subscribe(func(change Change) {
+				changes <- change
+			}, "Log")
+
+			// rejected edits
+			assert.Nil(t, ioutil.WriteFile(file, []byte("Port: 8080\nLog:\n  Level: trace\n"), 0644))
+			assertNoChange(t, changes)
+			assert.Nil(t, ioutil.WriteFile(file, []byte("Port: 1\nLog:\n  Level: error\n"), 0644))
+			assertNoChange(t, changes)
+			assert.Equal(t, &c, w.Current())
+
+			// replaced by rename like the editors do
+			tmp := filepath.Join(dir, "app.yaml.tmp")
+			assert.Nil(t, ioutil.WriteFile(tmp, []byte("Port: 8081\nLog:\n  Level: error\n"), 0644))
+			assert.Nil(t, os.Rename(tmp, file))
+			select {
+			case change := <-changes:
+				assert.Equal(t, []FieldChange{
+					{Path: "Log.Level", Old: "info", New: "error"},
+					{Path: "Port", Old: int64(8080), New: int64(8081)},
+				}, change.Fields)
+				assert.True(t, change.Changed("log"))
+				assert.False(t, change.Changed("Timeout"))
+				assert.Equal(t, change.New, w.Current())
+			case <-time.After(2 * time.Second):
+				t.Fatal("no change")
+			}
+		})
+	}
+}
+
+func assertNoChange(t *testing.T, changes chan Change) {
+	select {
+	case change := <-changes:
+		t.Fatalf("unexpected change %v", change.Fields)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
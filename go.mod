@@ -3,10 +3,14 @@ module github.com/weblazy/core
 go 1.12
 
 require (
+	github.com/BurntSushi/toml v0.3.1
 	github.com/DATA-DOG/go-sqlmock v1.4.1
+	github.com/alicebob/miniredis/v2 v2.11.4
+	github.com/andybalholm/brotli v1.0.4
 	github.com/globalsign/mgo v0.0.0-20181015135952-eeefdecb41b8
 	github.com/go-redis/redis v6.15.7+incompatible
 	github.com/go-sql-driver/mysql v1.5.0
+	github.com/golang/protobuf v1.3.3
 	github.com/lib/pq v1.3.0
 	github.com/spaolacci/murmur3 v1.1.0
 	github.com/stretchr/testify v1.4.0
@@ -16,6 +20,7 @@ require (
 	golang.org/x/sys v0.0.0-20191022100944-742c48ecaeb7
 	golang.org/x/tools v0.0.0-20190524140312-2c0ae7006135 // indirect
 	google.golang.org/grpc v1.28.0
+	gopkg.in/yaml.v2 v2.2.8
 	honnef.co/go/tools v0.0.0-20190523083050-ea95bdfd59fc // indirect
 	k8s.io/apimachinery v0.18.0
 	k8s.io/klog v1.0.0
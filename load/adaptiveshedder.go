@@ -7,8 +7,7 @@ import (
 	"time"
 
 	"github.com/weblazy/core/collection"
-	// "github.com/weblazy/core/stat"
-	// "github.com/weblazy/core/rpcx"
+	"github.com/weblazy/core/logx"
 	"github.com/weblazy/core/syncx"
 	"github.com/weblazy/core/timex"
 )
@@ -30,9 +29,9 @@ var (
 	// default to be enabled
 	enabled = syncx.ForAtomicBool(true)
 	// make it a variable for unit test
-	// systemOverloadChecker = func(cpuThreshold int64) bool {
-	// 	return stat.CpuUsage() >= cpuThreshold
-	// }
+	systemOverloadChecker = func(cpuThreshold int64) bool {
+		return CpuUsage() >= cpuThreshold
+	}
 )
 
 type (
@@ -51,10 +50,14 @@ type (
 		window       time.Duration
 		buckets      int
 		cpuThreshold int64
+		dropping     bool
+		// shared by the shedders of a group to change the threshold live
+		cpuThresholdRef *int64
 	}
 
 	adaptiveShedder struct {
-		cpuThreshold    int64
+		cpuThreshold    *int64
+		dropping        bool
 		windows         int64
 		flying          int64
 		avgFlying       float64
@@ -83,9 +86,13 @@ func NewAdaptiveShedder(opts ...ShedderOption) Shedder {
 	for _, opt := range opts {
 		opt(&options)
 	}
+	if options.cpuThresholdRef == nil {
+		options.cpuThresholdRef = &options.cpuThreshold
+	}
 	bucketDuration := options.window / time.Duration(options.buckets)
 	return &adaptiveShedder{
-		cpuThreshold:    options.cpuThreshold,
+		cpuThreshold:    options.cpuThresholdRef,
+		dropping:        options.dropping,
 		windows:         int64(time.Second / bucketDuration),
 		dropTime:        syncx.NewAtomicDuration(),
 		droppedRecently: syncx.NewAtomicBool(),
@@ -97,12 +104,12 @@ func NewAdaptiveShedder(opts ...ShedderOption) Shedder {
 }
 
 func (as *adaptiveShedder) Allow() (Promise, error) {
-	// if as.shouldDrop() {
-	// 	as.dropTime.Set(timex.Now())
-	// 	as.droppedRecently.Set(true)
+	if as.dropping && as.shouldDrop() {
+		as.dropTime.Set(timex.Now())
+		as.droppedRecently.Set(true)
 
-	// 	return nil, ErrServiceOverloaded
-	// }
+		return nil, ErrServiceOverloaded
+	}
 
 	as.addFlying(1)
 
@@ -171,21 +178,21 @@ func (as *adaptiveShedder) minRt() float64 {
 	return result
 }
 
-// func (as *adaptiveShedder) shouldDrop() bool {
-// 	if as.systemOverloaded() || as.stillHot() {
-// 		if as.highThru() {
-// 			flying := atomic.LoadInt64(&as.flying)
-// 			as.avgFlyingLock.Lock()
-// 			avgFlying := as.avgFlying
-// 			as.avgFlyingLock.Unlock()
-// 			// logx.Errorf("dropreq, cpu: %d, maxPass: %d, minRt: %.2f, hot: %t, flying: %d, avgFlying: %.2f",
-// 			// 	stat.CpuUsage(), as.maxPass(), as.minRt(), as.stillHot(), flying, avgFlying)
-// 			return true
-// 		}
-// 	}
+func (as *adaptiveShedder) shouldDrop() bool {
+	if as.systemOverloaded() || as.stillHot() {
+		if as.highThru() {
+			flying := atomic.LoadInt64(&as.flying)
+			as.avgFlyingLock.Lock()
+			avgFlying := as.avgFlying
+			as.avgFlyingLock.Unlock()
+			logx.Errorf("dropreq, cpu: %d, maxPass: %d, minRt: %.2f, hot: %t, flying: %d, avgFlying: %.2f",
+				CpuUsage(), as.maxPass(), as.minRt(), as.stillHot(), flying, avgFlying)
+			return true
+		}
+	}
 
-// 	return false
-// }
+	return false
+}
 
 func (as *adaptiveShedder) stillHot() bool {
 	if !as.droppedRecently.True() {
@@ -205,9 +212,9 @@ func (as *adaptiveShedder) stillHot() bool {
 	return hot
 }
 
-// func (as *adaptiveShedder) systemOverloaded() bool {
-// 	return systemOverloadChecker(as.cpuThreshold)
-// }
+func (as *adaptiveShedder) systemOverloaded() bool {
+	return systemOverloadChecker(atomic.LoadInt64(as.cpuThreshold))
+}
 
 func WithBuckets(buckets int) ShedderOption {
 	return func(opts *shedderOptions) {
@@ -221,12 +228,27 @@ func WithCpuThreshold(threshold int64) ShedderOption {
 	}
 }
 
+// WithDropping makes the shedder drop the requests when overloaded, otherwise all the requests pass.
+// The cpu usage is of the whole host from /proc/stat, not of the container limited by cgroup,
+// so enable it on the hosts or the containers owning the cpus.
+func WithDropping() ShedderOption {
+	return func(opts *shedderOptions) {
+		opts.dropping = true
+	}
+}
+
 func WithWindow(window time.Duration) ShedderOption {
 	return func(opts *shedderOptions) {
 		opts.window = window
 	}
 }
 
+func withCpuThresholdRef(threshold *int64) ShedderOption {
+	return func(opts *shedderOptions) {
+		opts.cpuThresholdRef = threshold
+	}
+}
+
 type promise struct {
 	start   time.Duration
 	shedder *adaptiveShedder
@@ -0,0 +1,69 @@
+package load
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdaptiveShedderShouldDrop(t *testing.T) {
+	overloaded := true
+	prev := systemOverloadChecker
+	defer func() {
+		systemOverloadChecker = prev
+	}()
+	systemOverloadChecker = func(int64) bool {
+		return overloaded
+	}
+
+	shedder := NewAdaptiveShedder(WithDropping()).(*adaptiveShedder)
+	// below the max flight, 10 with the empty windows
+	shedder.flying = 5
+	shedder.avgFlying = 5
+	assert.False(t, shedder.shouldDrop())
+
+	shedder.flying = 50
+	shedder.avgFlying = 50
+	assert.True(t, shedder.shouldDrop())
+	_, err := shedder.Allow()
+	assert.Equal(t, ErrServiceOverloaded, err)
+
+	// still hot after dropping
+	overloaded = false
+	assert.True(t, shedder.shouldDrop())
+	shedder.droppedRecently.Set(false)
+	assert.False(t, shedder.shouldDrop())
+
+	// all the requests pass without WithDropping
+	overloaded = true
+	shedder = NewAdaptiveShedder().(*adaptiveShedder)
+	shedder.flying = 50
+	shedder.avgFlying = 50
+	promise, err := shedder.Allow()
+	assert.Nil(t, err)
+	promise.Pass()
+}
+
+func TestShedderGroupSetCpuThreshold(t *testing.T) {
+	var threshold int64
+	prev := systemOverloadChecker
+	defer func() {
+		systemOverloadChecker = prev
+	}()
+	systemOverloadChecker = func(cpuThreshold int64) bool {
+		threshold = cpuThreshold
+		return false
+	}
+
+	group := NewShedderGroup(WithDropping(), WithCpuThreshold(800))
+	first := group.GetShedder("a").(nopCloser).Shedder.(*adaptiveShedder)
+	assert.Equal(t, first, group.GetShedder("a").(nopCloser).Shedder)
+	first.systemOverloaded()
+	assert.Equal(t, int64(800), threshold)
+
+	group.SetCpuThreshold(500)
+	first.systemOverloaded()
+	assert.Equal(t, int64(500), threshold)
+	group.GetShedder("b").(nopCloser).Shedder.(*adaptiveShedder).systemOverloaded()
+	assert.Equal(t, int64(500), threshold)
+}
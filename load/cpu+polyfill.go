@@ -0,0 +1,9 @@
+// +build !linux
+
+package load
+
+// CpuUsage returns 0 on the platforms without /proc/stat, the shedders only drop
+// the requests while they are still hot then.
+func CpuUsage() int64 {
+	return 0
+}
@@ -0,0 +1,103 @@
+// +build linux
+
+package load
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	procStat         = "/proc/stat"
+	cpuRefreshPeriod = 250 * time.Millisecond
+	// moving average hyperparameter beta for smoothing the cpu usage
+	cpuBeta = 0.95
+)
+
+var (
+	cpuUsage int64
+	cpuOnce  sync.Once
+)
+
+// CpuUsage returns the cpu usage of the machine in permille, 1000 means all the cores are busy.
+// The usage is sampled from /proc/stat in background since the first call.
+func CpuUsage() int64 {
+	cpuOnce.Do(startCpuSampling)
+	return atomic.LoadInt64(&cpuUsage)
+}
+
+func startCpuSampling() {
+	total, idle, err := readCpuTimes()
+	if err != nil {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(cpuRefreshPeriod)
+		defer ticker.Stop()
+
+		var avg float64
+		for range ticker.C {
+			curTotal, curIdle, err := readCpuTimes()
+			if err != nil || curTotal <= total {
+				continue
+			}
+
+			usage := float64(1000 * (curTotal - total - (curIdle - idle)) / (curTotal - total))
+			avg = avg*cpuBeta + usage*(1-cpuBeta)
+			atomic.StoreInt64(&cpuUsage, int64(avg))
+			total, idle = curTotal, curIdle
+		}
+	}()
+}
+
+// readCpuTimes returns the total and the idle cpu time from the cpu line of /proc/stat.
+func readCpuTimes() (total, idle uint64, err error) {
+	f, err := os.Open(procStat)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	return parseCpuTimes(f)
+}
+
+func parseCpuTimes(r io.Reader) (total, idle uint64, err error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || fields[0] != "cpu" {
+			continue
+		}
+
+		// guest and guest_nice are counted in user and nice already
+		if len(fields) > 9 {
+			fields = fields[:9]
+		}
+		for i, field := range fields[1:] {
+			val, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return 0, 0, err
+			}
+			total += val
+			// idle and iowait
+			if i == 3 || i == 4 {
+				idle += val
+			}
+		}
+		return total, idle, nil
+	}
+
+	if err := scanner.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	return 0, 0, errors.New("no cpu line in " + procStat)
+}
@@ -0,0 +1,33 @@
+// +build linux
+
+package load
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCpuTimes(t *testing.T) {
+	total, idle, err := parseCpuTimes(strings.NewReader(
+		"cpu  100 10 50 800 40 0 0 0 30 5\ncpu0 50 5 25 400 20 0 0 0 15 0\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1000), total)
+	assert.Equal(t, uint64(840), idle)
+
+	_, _, err = parseCpuTimes(strings.NewReader("cpu  100 x 50 800 40\n"))
+	assert.NotNil(t, err)
+	_, _, err = parseCpuTimes(strings.NewReader("intr 1 2 3 4 5\n"))
+	assert.NotNil(t, err)
+}
+
+func TestReadCpuTimes(t *testing.T) {
+	total, idle, err := readCpuTimes()
+	assert.Nil(t, err)
+	assert.True(t, total > 0)
+	assert.True(t, idle <= total)
+
+	usage := CpuUsage()
+	assert.True(t, usage >= 0 && usage <= 1000)
+}
@@ -2,20 +2,33 @@ package load
 
 import (
 	"io"
+	"sync/atomic"
 
 	"github.com/weblazy/core/syncx"
 )
 
 type ShedderGroup struct {
-	options []ShedderOption
-	manager *syncx.ResourceManager
+	options      []ShedderOption
+	cpuThreshold int64
+	manager      *syncx.ResourceManager
 }
 
+// NewShedderGroup returns a ShedderGroup creating the shedders with opts, the shedders don't drop any requests
+// unless WithDropping is given.
 func NewShedderGroup(opts ...ShedderOption) *ShedderGroup {
-	return &ShedderGroup{
-		options: opts,
-		manager: syncx.NewResourceManager(),
+	options := shedderOptions{
+		cpuThreshold: defaultCpuThreshold,
 	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	g := &ShedderGroup{
+		cpuThreshold: options.cpuThreshold,
+		manager:      syncx.NewResourceManager(),
+	}
+	g.options = append(opts[:len(opts):len(opts)], withCpuThresholdRef(&g.cpuThreshold))
+	return g
 }
 
 func (g *ShedderGroup) GetShedder(key string) Shedder {
@@ -27,6 +40,11 @@ func (g *ShedderGroup) GetShedder(key string) Shedder {
 	return shedder.(Shedder)
 }
 
+// SetCpuThreshold changes the cpu threshold of all the shedders in the group, in 1000m notation.
+func (g *ShedderGroup) SetCpuThreshold(threshold int64) {
+	atomic.StoreInt64(&g.cpuThreshold, threshold)
+}
+
 type nopCloser struct {
 	Shedder
 }
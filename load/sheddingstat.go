@@ -3,7 +3,8 @@ package load
 import (
 	"sync/atomic"
 	"time"
-	// "github.com/weblazy/core/stat"
+
+	"github.com/weblazy/core/logx"
 )
 
 type (
@@ -53,14 +54,14 @@ func (s *SheddingStat) run() {
 	ticker := time.NewTicker(time.Minute)
 	defer ticker.Stop()
 	for range ticker.C {
-		// c := stat.CpuUsage()
+		c := CpuUsage()
 		st := s.reset()
 		if st.Drop == 0 {
-			// logx.Statf("(%s) shedding_stat [1m], cpu: %d, total: %d, pass: %d, drop: %d",
-			// 	s.name, c, st.Total, st.Pass, st.Drop)
+			logx.Statf("(%s) shedding_stat [1m], cpu: %d, total: %d, pass: %d, drop: %d",
+				s.name, c, st.Total, st.Pass, st.Drop)
 		} else {
-			// logx.Statf("(%s) shedding_stat_drop [1m], cpu: %d, total: %d, pass: %d, drop: %d",
-			// 	s.name, c, st.Total, st.Pass, st.Drop)
+			logx.Statf("(%s) shedding_stat_drop [1m], cpu: %d, total: %d, pass: %d, drop: %d",
+				s.name, c, st.Total, st.Pass, st.Drop)
 		}
 	}
 }
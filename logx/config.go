@@ -4,8 +4,17 @@ type Config struct {
 	ServiceName         string `json:",optional"`
 	Mode                string `json:",default=console,options=console|file|volume"`
 	Path                string `json:",default=logs"`
-	Level               string `json:",default=info,options=info|error|severe"`
+	Level               string `json:",default=info,options=debug|info|error|severe"`
 	Compress            bool   `json:",optional"`
 	KeepDays            int    `json:",optional"`
 	StackCooldownMillis int    `json:",default=100"`
+	// Rotation is the rule to rotate the log files, combined rotates daily and at MaxSize.
+	Rotation string `json:",default=daily,options=daily|hourly|size|combined"`
+	// MaxSize is the size in megabytes to rotate at, required by size and combined.
+	MaxSize int `json:",optional"`
+	// MaxBackups is the max count of the backups kept by size and combined, zero means no limit.
+	MaxBackups int `json:",optional"`
+	// MaxTotalSize is the max total size in megabytes of the backups kept by size and combined,
+	// zero means no limit.
+	MaxTotalSize int `json:",optional"`
 }
@@ -0,0 +1,21 @@
+package logx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/weblazy/core/mapping"
+)
+
+func TestConfigLevel(t *testing.T) {
+	for _, level := range []string{"debug", "info", "error", "severe"} {
+		var c Config
+		assert.Nil(t, mapping.UnmarshalJsonBytes([]byte(`{"Level": "`+level+`"}`), &c))
+		assert.Equal(t, level, c.Level)
+		assert.Nil(t, SetLevelName(c.Level))
+	}
+	SetLevel(InfoLevel)
+
+	var c Config
+	assert.NotNil(t, mapping.UnmarshalJsonBytes([]byte(`{"Level": "trace"}`), &c))
+}
@@ -1,74 +1,148 @@
 package logx
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"time"
+
+	"github.com/weblazy/core/tracex"
 )
 
 const customCallerDepth = 3
 
 type customLog struct {
-	logEntry
+	duration string
+	trace    string
+	span     string
+	request  string
+	fields   []Field
 }
 
 func WithDuration(d time.Duration) Logger {
-	logger := new(customLog)
-	logger.Duration = d.String()
-	return logger
+	return new(customLog).WithDuration(d)
+}
+
+// WithFields returns a Logger writing fields in each entry.
+func WithFields(fields ...Field) Logger {
+	return new(customLog).WithFields(fields...)
+}
+
+// WithContext returns a Logger writing the request id and the trace span in ctx in each entry.
+func WithContext(ctx context.Context) Logger {
+	return new(customLog).WithContext(ctx)
 }
 
 func (l *customLog) Error(v ...interface{}) {
 	if shouldLog(ErrorLevel) {
-		l.write(errorLog, levelError, formatWithCaller(fmt.Sprint(v...), customCallerDepth))
+		l.write(errorLog, levelError, formatWithCaller(fmt.Sprint(v...), customCallerDepth), nil)
 	}
 }
 
 func (l *customLog) Errorf(format string, v ...interface{}) {
 	if shouldLog(ErrorLevel) {
-		l.write(errorLog, levelError, formatWithCaller(fmt.Sprintf(format, v...), customCallerDepth))
+		l.write(errorLog, levelError, formatWithCaller(fmt.Sprintf(format, v...), customCallerDepth), nil)
+	}
+}
+
+func (l *customLog) Errorw(msg string, fields ...Field) {
+	if shouldLog(ErrorLevel) {
+		l.write(errorLog, levelError, formatWithCaller(msg, customCallerDepth), fields)
 	}
 }
 
 func (l *customLog) Debug(v ...interface{}) {
 	if shouldLog(DebugLevel) {
-		l.write(debugLog, levelDebug, formatWithCaller(fmt.Sprint(v...), customCallerDepth))
+		l.write(debugLog, levelDebug, formatWithCaller(fmt.Sprint(v...), customCallerDepth), nil)
 	}
 }
 
 func (l *customLog) Debugf(format string, v ...interface{}) {
 	if shouldLog(DebugLevel) {
-		l.write(debugLog, levelDebug, formatWithCaller(fmt.Sprintf(format, v...), customCallerDepth))
+		l.write(debugLog, levelDebug, formatWithCaller(fmt.Sprintf(format, v...), customCallerDepth), nil)
+	}
+}
+
+func (l *customLog) Debugw(msg string, fields ...Field) {
+	if shouldLog(DebugLevel) {
+		l.write(debugLog, levelDebug, formatWithCaller(msg, customCallerDepth), fields)
 	}
 }
 
 func (l *customLog) Info(v ...interface{}) {
 	if shouldLog(InfoLevel) {
-		l.write(infoLog, levelInfo, fmt.Sprint(v...))
+		l.write(infoLog, levelInfo, fmt.Sprint(v...), nil)
 	}
 }
 
 func (l *customLog) Infof(format string, v ...interface{}) {
 	if shouldLog(InfoLevel) {
-		l.write(infoLog, levelInfo, fmt.Sprintf(format, v...))
+		l.write(infoLog, levelInfo, fmt.Sprintf(format, v...), nil)
+	}
+}
+
+func (l *customLog) Infow(msg string, fields ...Field) {
+	if shouldLog(InfoLevel) {
+		l.write(infoLog, levelInfo, msg, fields)
 	}
 }
 
 func (l *customLog) Slow(v ...interface{}) {
 	if shouldLog(ErrorLevel) {
-		l.write(slowLog, levelSlow, fmt.Sprint(v...))
+		l.write(slowLog, levelSlow, fmt.Sprint(v...), nil)
 	}
 }
 
 func (l *customLog) Slowf(format string, v ...interface{}) {
 	if shouldLog(ErrorLevel) {
-		l.write(slowLog, levelSlow, fmt.Sprintf(format, v...))
+		l.write(slowLog, levelSlow, fmt.Sprintf(format, v...), nil)
+	}
+}
+
+func (l *customLog) Sloww(msg string, fields ...Field) {
+	if shouldLog(ErrorLevel) {
+		l.write(slowLog, levelSlow, msg, fields)
 	}
 }
 
-func (l *customLog) write(writer io.Writer, level, content string) {
-	l.Timestamp = getTimestamp()
-	l.Level = level
-	l.Content = content
-	outputJson(writer, l.logEntry)
+func (l *customLog) WithDuration(d time.Duration) Logger {
+	logger := *l
+	logger.duration = d.String()
+	return &logger
+}
+
+func (l *customLog) WithFields(fields ...Field) Logger {
+	logger := *l
+	logger.fields = append(l.fields[:len(l.fields):len(l.fields)], fields...)
+	return &logger
+}
+
+func (l *customLog) WithContext(ctx context.Context) Logger {
+	logger := *l
+	if request := tracex.RequestIDFromContext(ctx); len(request) > 0 {
+		logger.request = request
+	}
+	if span, ok := tracex.SpanFromContext(ctx); ok {
+		logger.trace = span.TraceID
+		logger.span = span.SpanID
+	}
+	return &logger
+}
+
+func (l *customLog) write(writer io.Writer, level, content string, fields []Field) {
+	if len(fields) > 0 {
+		fields = append(l.fields[:len(l.fields):len(l.fields)], fields...)
+	} else {
+		fields = l.fields
+	}
+
+	outputJson(writer, logEntry{
+		Timestamp: getTimestamp(),
+		Level:     level,
+		Duration:  l.duration,
+		Trace:     l.trace,
+		Span:      l.span,
+		Request:   l.request,
+		Content:   content,
+	}, fields...)
 }
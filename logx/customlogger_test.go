@@ -0,0 +1,89 @@
+package logx
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/weblazy/core/iox"
+	"github.com/weblazy/core/tracex"
+)
+
+func TestWithFields(t *testing.T) {
+	var buf bytes.Buffer
+	restore := captureInfoLog(&buf)
+	defer restore()
+
+	ctx := tracex.ContextWithRequestID(context.Background(), "req-1")
+	ctx = tracex.ContextWithSpan(ctx, tracex.Span{TraceID: "trace-1", SpanID: "span-1"})
+	logger := WithFields(String("user", "kevin"), Int("age", 18)).WithContext(ctx)
+	logger.WithDuration(time.Second).Infow("login \"ok\"",
+		Float64("score", 1.5),
+		Float64("nan", math.NaN()),
+		Bool("admin", true),
+		Duration("elapsed", 1500*time.Millisecond),
+		Err(errors.New("none")),
+		Any("tags", []string{"a", "b"}))
+
+	var entry map[string]interface{}
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &entry))
+	delete(entry, "@timestamp")
+	assert.Equal(t, map[string]interface{}{
+		"level":    levelInfo,
+		"duration": "1s",
+		"trace":    "trace-1",
+		"span":     "span-1",
+		"request":  "req-1",
+		"content":  "login \"ok\"",
+		"user":     "kevin",
+		"age":      float64(18),
+		"score":    1.5,
+		"nan":      "NaN",
+		"admin":    true,
+		"elapsed":  "1.5s",
+		"error":    "none",
+		"tags":     []interface{}{"a", "b"},
+	}, entry)
+
+	// the fields of logger are not changed by the derived ones
+	buf.Reset()
+	logger.WithFields(String("user", "bob"))
+	logger.Info("hello")
+	entry = nil
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "kevin", entry["user"])
+	assert.Nil(t, entry["error"])
+}
+
+func TestWithFieldsDisabled(t *testing.T) {
+	var buf bytes.Buffer
+	restore := captureInfoLog(&buf)
+	defer restore()
+	SetLevel(ErrorLevel)
+	defer SetLevel(InfoLevel)
+
+	logger := WithFields(String("user", "kevin"))
+	allocs := testing.AllocsPerRun(100, func() {
+		logger.Infow("login", String("name", "kevin"), Int("age", 18), Duration("elapsed", time.Second))
+	})
+	assert.Equal(t, float64(0), allocs)
+	assert.Equal(t, 0, buf.Len())
+}
+
+func captureInfoLog(buf *bytes.Buffer) func() {
+	prevLog := infoLog
+	prevInitialized := atomic.LoadUint32(&initialized)
+	infoLog = iox.NopCloser(buf)
+	atomic.StoreUint32(&initialized, 1)
+
+	return func() {
+		infoLog = prevLog
+		atomic.StoreUint32(&initialized, prevInitialized)
+	}
+}
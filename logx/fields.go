@@ -0,0 +1,141 @@
+package logx
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+const (
+	stringType fieldType = iota
+	intType
+	floatType
+	boolType
+	durationType
+	timeType
+	errorType
+	anyType
+
+	errorKey = "error"
+)
+
+type (
+	fieldType uint8
+
+	// Field is a typed key-value pair written in the log entries, create it with String, Int, Err and so on.
+	// The values are kept as they are and only encoded if the level is enabled.
+	Field struct {
+		Key     string
+		typ     fieldType
+		integer int64
+		str     string
+		value   interface{}
+	}
+)
+
+// String returns a string Field.
+func String(key, value string) Field {
+	return Field{Key: key, typ: stringType, str: value}
+}
+
+// Int returns an int Field.
+func Int(key string, value int) Field {
+	return Int64(key, int64(value))
+}
+
+// Int64 returns an int64 Field.
+func Int64(key string, value int64) Field {
+	return Field{Key: key, typ: intType, integer: value}
+}
+
+// Float64 returns a float64 Field, NaN and Inf are written as strings.
+func Float64(key string, value float64) Field {
+	return Field{Key: key, typ: floatType, integer: int64(math.Float64bits(value))}
+}
+
+// Bool returns a bool Field.
+func Bool(key string, value bool) Field {
+	var integer int64
+	if value {
+		integer = 1
+	}
+
+	return Field{Key: key, typ: boolType, integer: integer}
+}
+
+// Duration returns a Field written like 1.5s.
+func Duration(key string, value time.Duration) Field {
+	return Field{Key: key, typ: durationType, integer: int64(value)}
+}
+
+// Time returns a Field written in the format of @timestamp.
+func Time(key string, value time.Time) Field {
+	return Field{Key: key, typ: timeType, integer: value.UnixNano()}
+}
+
+// Err returns a Field of err with the key error, null if err is nil.
+func Err(err error) Field {
+	return Field{Key: errorKey, typ: errorType, value: err}
+}
+
+// Any returns a Field of value encoded in json.
+func Any(key string, value interface{}) Field {
+	return Field{Key: key, typ: anyType, value: value}
+}
+
+// appendFields appends fields to the json object in buf, which ends with }.
+func appendFields(buf []byte, fields []Field) []byte {
+	if len(fields) == 0 {
+		return buf
+	}
+
+	buf = buf[:len(buf)-1]
+	for _, field := range fields {
+		buf = append(buf, ',')
+		buf = appendJsonString(buf, field.Key)
+		buf = append(buf, ':')
+		buf = field.appendValue(buf)
+	}
+
+	return append(buf, '}')
+}
+
+func (f Field) appendValue(buf []byte) []byte {
+	switch f.typ {
+	case stringType:
+		return appendJsonString(buf, f.str)
+	case intType:
+		return strconv.AppendInt(buf, f.integer, 10)
+	case floatType:
+		value := math.Float64frombits(uint64(f.integer))
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return appendJsonString(buf, strconv.FormatFloat(value, 'g', -1, 64))
+		}
+		return strconv.AppendFloat(buf, value, 'g', -1, 64)
+	case boolType:
+		return strconv.AppendBool(buf, f.integer == 1)
+	case durationType:
+		return appendJsonString(buf, time.Duration(f.integer).String())
+	case timeType:
+		return appendJsonString(buf, time.Unix(0, f.integer).Format(timeFormat))
+	case errorType:
+		if f.value == nil {
+			return append(buf, "null"...)
+		}
+		return appendJsonString(buf, f.value.(error).Error())
+	default:
+		content, err := json.Marshal(f.value)
+		if err != nil {
+			return appendJsonString(buf, fmt.Sprint(f.value))
+		}
+		return append(buf, content...)
+	}
+}
+
+func appendJsonString(buf []byte, str string) []byte {
+	// marshaling a string never fails
+	content, _ := json.Marshal(str)
+	return append(buf, content...)
+}
@@ -1,6 +1,7 @@
 package logx
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -46,6 +47,7 @@ const (
 	fileMode    = "file"
 	volumeMode  = "volume"
 
+	levelAccess = "access"
 	levelInfo   = "info"
 	levelDebug  = "debug"
 	levelError  = "error"
@@ -53,6 +55,10 @@ const (
 	levelSlow   = "slow"
 	levelStat   = "stat"
 
+	hourlyRotation   = "hourly"
+	sizeRotation     = "size"
+	combinedRotation = "combined"
+
 	backupFileDelimiter = "-"
 	callerInnerDepth    = 5
 	flags               = 0x0
@@ -62,9 +68,11 @@ var (
 	ErrLogPathNotSet        = errors.New("log path must be set")
 	ErrLogNotInitialized    = errors.New("log not initialized")
 	ErrLogServiceNameNotSet = errors.New("log service name must be set")
+	ErrLogMaxSizeNotSet     = errors.New("log max size must be set to rotate by size")
 
 	writeConsole bool
 	logLevel     uint32
+	accessLog    io.WriteCloser
 	infoLog      io.WriteCloser
 	debugLog     io.WriteCloser
 	errorLog     io.WriteCloser
@@ -83,6 +91,9 @@ type (
 		Timestamp string `json:"@timestamp"`
 		Level     string `json:"level"`
 		Duration  string `json:"duration,omitempty"`
+		Trace     string `json:"trace,omitempty"`
+		Span      string `json:"span,omitempty"`
+		Request   string `json:"request,omitempty"`
 		Content   string `json:"content"`
 	}
 
@@ -90,19 +101,32 @@ type (
 		gzipEnabled           bool
 		logStackCooldownMills int
 		keepDays              int
+		rotation              string
+		maxSize               int
+		maxBackups            int
+		maxTotalSize          int
 	}
 
 	LogOption func(options *logOptions)
 
+	// Logger writes the entries with the duration, fields and trace ids it carries.
+	// The methods ending with w take the message and the fields, they don't allocate if the level is disabled.
 	Logger interface {
 		Info(...interface{})
 		Infof(string, ...interface{})
+		Infow(string, ...Field)
 		Debug(...interface{})
 		Debugf(string, ...interface{})
+		Debugw(string, ...Field)
 		Error(...interface{})
 		Errorf(string, ...interface{})
+		Errorw(string, ...Field)
 		Slow(...interface{})
 		Slowf(string, ...interface{})
+		Sloww(string, ...Field)
+		WithDuration(time.Duration) Logger
+		WithFields(...Field) Logger
+		WithContext(context.Context) Logger
 	}
 )
 
@@ -177,6 +201,7 @@ func Disable() {
 		atomic.StoreUint32(&initialized, 1)
 
 		infoLog = iox.NopCloser(ioutil.Discard)
+		accessLog = infoLog
 		errorLog = iox.NopCloser(ioutil.Discard)
 		severeLog = iox.NopCloser(ioutil.Discard)
 		slowLog = iox.NopCloser(ioutil.Discard)
@@ -185,6 +210,16 @@ func Disable() {
 	})
 }
 
+// Access writes v to the access log as it is, without the json envelope,
+// so that the access entries can be in any format, like json or apache combined log format.
+func Access(v ...interface{}) {
+	accessSync(fmt.Sprint(v...))
+}
+
+func Accessf(format string, v ...interface{}) {
+	accessSync(fmt.Sprintf(format, v...))
+}
+
 func Error(v ...interface{}) {
 	ErrorCaller(1, v...)
 }
@@ -231,6 +266,25 @@ func SetLevel(level uint32) {
 	atomic.StoreUint32(&logLevel, level)
 }
 
+// SetLevelName sets the level by the name in Config.Level, like debug, info, error or severe,
+// it's used to change the level live on config changes.
+func SetLevelName(level string) error {
+	switch level {
+	case levelInfo:
+		SetLevel(InfoLevel)
+	case levelDebug:
+		SetLevel(DebugLevel)
+	case levelError:
+		SetLevel(ErrorLevel)
+	case levelSevere:
+		SetLevel(SevereLevel)
+	default:
+		return fmt.Errorf("unknown log level %q", level)
+	}
+
+	return nil
+}
+
 func Severe(v ...interface{}) {
 	severeSync(fmt.Sprint(v...))
 }
@@ -273,13 +327,62 @@ func WithGzip() LogOption {
 	}
 }
 
+// WithRotation sets the rule to rotate the log files, daily, hourly, size or combined.
+func WithRotation(rotation string) LogOption {
+	return func(opts *logOptions) {
+		opts.rotation = rotation
+	}
+}
+
+// WithMaxSize sets the size in megabytes to rotate at with the size or combined rotation.
+func WithMaxSize(megabytes int) LogOption {
+	return func(opts *logOptions) {
+		opts.maxSize = megabytes
+	}
+}
+
+// WithMaxBackups sets the max count of the backups with the size or combined rotation.
+func WithMaxBackups(backups int) LogOption {
+	return func(opts *logOptions) {
+		opts.maxBackups = backups
+	}
+}
+
+// WithMaxTotalSize sets the max total size in megabytes of the backups with the size or combined rotation.
+func WithMaxTotalSize(megabytes int) LogOption {
+	return func(opts *logOptions) {
+		opts.maxTotalSize = megabytes
+	}
+}
+
 func createOutput(path string) (io.WriteCloser, error) {
 	if len(path) == 0 {
 		return nil, ErrLogPathNotSet
 	}
 
-	return NewLogger(path, DefaultRotateRule(path, backupFileDelimiter, options.keepDays,
-		options.gzipEnabled), options.gzipEnabled)
+	return NewLogger(path, createRotateRule(path), options.gzipEnabled)
+}
+
+func createRotateRule(path string) RotateRule {
+	switch options.rotation {
+	case hourlyRotation:
+		return NewHourlyRotateRule(path, backupFileDelimiter, options.keepDays, options.gzipEnabled)
+	case sizeRotation:
+		return NewSizeLimitRotateRule(path, backupFileDelimiter, options.keepDays, options.maxSize,
+			options.maxBackups, options.maxTotalSize, options.gzipEnabled)
+	case combinedRotation:
+		return NewCombinedRotateRule(NewSizeLimitRotateRule(path, backupFileDelimiter, options.keepDays,
+			options.maxSize, options.maxBackups, options.maxTotalSize, options.gzipEnabled),
+			DefaultRotateRule(path, backupFileDelimiter, options.keepDays, options.gzipEnabled))
+	default:
+		return DefaultRotateRule(path, backupFileDelimiter, options.keepDays, options.gzipEnabled)
+	}
+}
+
+func accessSync(msg string) {
+	if shouldLog(InfoLevel) {
+		outputRaw(accessLog, msg)
+	}
 }
 
 func errorSync(msg string, callDepth int) {
@@ -358,29 +461,33 @@ func outputError(writer io.Writer, msg string, callDepth int, level string) {
 	output(writer, level, content)
 }
 
-func outputJson(writer io.Writer, info logEntry) {
-	if content, err := json.Marshal(info); err != nil {
+func outputJson(writer io.Writer, info logEntry, fields ...Field) {
+	content, err := json.Marshal(info)
+	if err != nil {
 		fmt.Println(err.Error())
-	} else if atomic.LoadUint32(&initialized) == 0 || writer == nil {
+		return
+	}
+
+	content = appendFields(content, fields)
+	if atomic.LoadUint32(&initialized) == 0 || writer == nil {
 		fmt.Println(string(content))
 	} else {
 		writer.Write(append(content, '\n'))
 	}
 }
 
-func setupLogLevel(c Config) {
-	switch c.Level {
-	case levelInfo:
-		SetLevel(InfoLevel)
-	case levelDebug:
-		SetLevel(DebugLevel)
-	case levelError:
-		SetLevel(ErrorLevel)
-	case levelSevere:
-		SetLevel(SevereLevel)
+func outputRaw(writer io.Writer, msg string) {
+	if atomic.LoadUint32(&initialized) == 0 || writer == nil {
+		fmt.Println(msg)
+	} else {
+		writer.Write(append([]byte(msg), '\n'))
 	}
 }
 
+func setupLogLevel(c Config) {
+	SetLevelName(c.Level)
+}
+
 func setupWithConsole(c Config) {
 	once.Do(func() {
 		atomic.StoreUint32(&initialized, 1)
@@ -388,6 +495,7 @@ func setupWithConsole(c Config) {
 		setupLogLevel(c)
 
 		infoLog = newLogWriter(log.New(os.Stdout, "", flags))
+		accessLog = infoLog
 		debugLog = newLogWriter(log.New(os.Stderr, "", flags))
 		errorLog = newLogWriter(log.New(os.Stderr, "", flags))
 		severeLog = newLogWriter(log.New(os.Stderr, "", flags))
@@ -412,6 +520,15 @@ func setupWithFiles(c Config) error {
 	if c.KeepDays > 0 {
 		opts = append(opts, WithKeepDays(c.KeepDays))
 	}
+	switch c.Rotation {
+	case sizeRotation, combinedRotation:
+		if c.MaxSize <= 0 {
+			return ErrLogMaxSizeNotSet
+		}
+		opts = append(opts, WithMaxSize(c.MaxSize), WithMaxBackups(c.MaxBackups),
+			WithMaxTotalSize(c.MaxTotalSize))
+	}
+	opts = append(opts, WithRotation(c.Rotation))
 
 	accessFile := path.Join(c.Path, accessFilename)
 	debugFile := path.Join(c.Path, debugFilename)
@@ -428,6 +545,7 @@ func setupWithFiles(c Config) error {
 		if infoLog, err = createOutput(accessFile); err != nil {
 			return
 		}
+		accessLog = infoLog
 
 		if debugLog, err = createOutput(debugFile); err != nil {
 			return
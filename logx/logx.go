@@ -14,6 +14,9 @@ type (
 	}
 )
 
+// InfoX prints args with the caller in json.
+//
+// Deprecated: use WithFields, like logx.WithFields(logx.Any("data", args)).Info(msg).
 func InfoX(args ...interface{}) {
 	_, file, line, ok := runtime.Caller(1)
 	if ok {
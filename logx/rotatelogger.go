@@ -9,6 +9,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -23,6 +24,10 @@ const (
 	bufferSize      = 100
 	defaultDirMode  = 0755
 	defaultFileMode = 0600
+	megabyte        = 1 << 20
+
+	hourFormat       = "2006-01-02T15"
+	backupTimeFormat = "2006-01-02T15-04-05.000"
 )
 
 var ErrLogFileClosed = errors.New("error: log file closed")
@@ -35,6 +40,13 @@ type (
 		ShallRotate() bool
 	}
 
+	// sizeRotateRule is implemented by the RotateRules which rotate by the size of the file as well.
+	sizeRotateRule interface {
+		RotateRule
+		// shallRotateAtSize tells whether to rotate the file of size bytes before writing to it.
+		shallRotateAtSize(size int64) bool
+	}
+
 	RotateLogger struct {
 		filename string
 		backup   string
@@ -44,6 +56,8 @@ type (
 		rule     RotateRule
 		compress bool
 		keepDays int
+		// the size of the current file, only accessed in the worker goroutine
+		currentSize int64
 		// can't use threading.RoutineGroup because of cycle import
 		waitGroup sync.WaitGroup
 		closeOnce sync.Once
@@ -56,6 +70,26 @@ type (
 		days        int
 		gzip        bool
 	}
+
+	// HourlyRotateRule rotates the files every hour, the backups older than days are deleted.
+	HourlyRotateRule struct {
+		DailyRotateRule
+	}
+
+	// SizeLimitRotateRule rotates the files once they reach maxSize, the backups older than days,
+	// beyond maxBackups, or beyond maxTotalSize in total from the newest ones are deleted.
+	SizeLimitRotateRule struct {
+		DailyRotateRule
+		maxSize      int64
+		maxBackups   int
+		maxTotalSize int64
+	}
+
+	// CombinedRotateRule rotates the files if any of its rules shall rotate, like daily or at 100MB.
+	// The backups are named by the first rule, and the outdated files of all the rules are deleted.
+	CombinedRotateRule struct {
+		rules []RotateRule
+	}
 )
 
 func DefaultRotateRule(filename, delimiter string, days int, gzip bool) RotateRule {
@@ -81,6 +115,16 @@ func (r *DailyRotateRule) OutdatedFiles() []string {
 		return nil
 	}
 
+	boundary := time.Now().Add(-time.Hour * time.Duration(hoursPerDay*r.days)).Format(timex.DateFormat)
+	return r.filesBefore(r.backupFiles(), boundary)
+}
+
+func (r *DailyRotateRule) ShallRotate() bool {
+	return len(r.rotatedTime) > 0 && timex.NowDateStr() != r.rotatedTime
+}
+
+// backupFiles returns the backup files sorted from the oldest, only the compressed ones if gzip.
+func (r *DailyRotateRule) backupFiles() []string {
 	var pattern string
 	if r.gzip {
 		pattern = fmt.Sprintf("%s%s*.gz", r.filename, r.delimiter)
@@ -94,8 +138,13 @@ func (r *DailyRotateRule) OutdatedFiles() []string {
 		return nil
 	}
 
+	sort.Strings(files)
+	return files
+}
+
+// filesBefore returns the files named with the time before boundary.
+func (r *DailyRotateRule) filesBefore(files []string, boundary string) []string {
 	var buf strings.Builder
-	boundary := time.Now().Add(-time.Hour * time.Duration(hoursPerDay*r.days)).Format(timex.DateFormat)
 	fmt.Fprintf(&buf, "%s%s%s", r.filename, r.delimiter, boundary)
 	if r.gzip {
 		buf.WriteString(".gz")
@@ -112,8 +161,170 @@ func (r *DailyRotateRule) OutdatedFiles() []string {
 	return outdates
 }
 
-func (r *DailyRotateRule) ShallRotate() bool {
-	return len(r.rotatedTime) > 0 && timex.NowDateStr() != r.rotatedTime
+// NewHourlyRotateRule returns a HourlyRotateRule keeping the backups of days.
+func NewHourlyRotateRule(filename, delimiter string, days int, gzip bool) RotateRule {
+	return &HourlyRotateRule{
+		DailyRotateRule: DailyRotateRule{
+			rotatedTime: time.Now().Format(hourFormat),
+			filename:    filename,
+			delimiter:   delimiter,
+			days:        days,
+			gzip:        gzip,
+		},
+	}
+}
+
+func (r *HourlyRotateRule) BackupFileName() string {
+	return fmt.Sprintf("%s%s%s", r.filename, r.delimiter, time.Now().Format(hourFormat))
+}
+
+func (r *HourlyRotateRule) MarkRotated() {
+	r.rotatedTime = time.Now().Format(hourFormat)
+}
+
+func (r *HourlyRotateRule) OutdatedFiles() []string {
+	if r.days <= 0 {
+		return nil
+	}
+
+	boundary := time.Now().Add(-time.Hour * time.Duration(hoursPerDay*r.days)).Format(hourFormat)
+	return r.filesBefore(r.backupFiles(), boundary)
+}
+
+func (r *HourlyRotateRule) ShallRotate() bool {
+	return len(r.rotatedTime) > 0 && time.Now().Format(hourFormat) != r.rotatedTime
+}
+
+// NewSizeLimitRotateRule returns a SizeLimitRotateRule rotating at maxSize megabytes,
+// the zero days, maxBackups and maxTotalSize mean no limits.
+func NewSizeLimitRotateRule(filename, delimiter string, days, maxSize, maxBackups, maxTotalSize int,
+	gzip bool) RotateRule {
+	return &SizeLimitRotateRule{
+		DailyRotateRule: DailyRotateRule{
+			rotatedTime: time.Now().Format(backupTimeFormat),
+			filename:    filename,
+			delimiter:   delimiter,
+			days:        days,
+			gzip:        gzip,
+		},
+		maxSize:      int64(maxSize) * megabyte,
+		maxBackups:   maxBackups,
+		maxTotalSize: int64(maxTotalSize) * megabyte,
+	}
+}
+
+// BackupFileName names the backups with the time in milliseconds, because they may rotate
+// many times a day.
+func (r *SizeLimitRotateRule) BackupFileName() string {
+	return fmt.Sprintf("%s%s%s", r.filename, r.delimiter, time.Now().Format(backupTimeFormat))
+}
+
+func (r *SizeLimitRotateRule) MarkRotated() {
+	r.rotatedTime = time.Now().Format(backupTimeFormat)
+}
+
+func (r *SizeLimitRotateRule) OutdatedFiles() []string {
+	files := r.backupFiles()
+	var outdates []string
+	if r.days > 0 {
+		boundary := time.Now().Add(-time.Hour * time.Duration(hoursPerDay*r.days)).Format(backupTimeFormat)
+		outdates = r.filesBefore(files, boundary)
+		files = files[len(outdates):]
+	}
+
+	// the oldest files beyond the limits
+	var exceeded int
+	if r.maxBackups > 0 && len(files) > r.maxBackups {
+		exceeded = len(files) - r.maxBackups
+	}
+	if r.maxTotalSize > 0 {
+		var total int64
+		for i := len(files) - 1; i >= exceeded; i-- {
+			info, err := os.Stat(files[i])
+			if err != nil {
+				continue
+			}
+			if total += info.Size(); total > r.maxTotalSize {
+				exceeded = i + 1
+				break
+			}
+		}
+	}
+
+	return append(outdates, files[:exceeded]...)
+}
+
+// ShallRotate returns false, the SizeLimitRotateRule only rotates by size.
+func (r *SizeLimitRotateRule) ShallRotate() bool {
+	return false
+}
+
+func (r *SizeLimitRotateRule) shallRotateAtSize(size int64) bool {
+	return r.maxSize > 0 && size >= r.maxSize
+}
+
+// NewCombinedRotateRule returns a CombinedRotateRule of rules, put the SizeLimitRotateRule first
+// to name the backups uniquely, like NewCombinedRotateRule(sizeRule, DefaultRotateRule(...)).
+func NewCombinedRotateRule(rules ...RotateRule) RotateRule {
+	return &CombinedRotateRule{
+		rules: rules,
+	}
+}
+
+func (r *CombinedRotateRule) BackupFileName() string {
+	return r.rules[0].BackupFileName()
+}
+
+func (r *CombinedRotateRule) MarkRotated() {
+	for _, rule := range r.rules {
+		rule.MarkRotated()
+	}
+}
+
+func (r *CombinedRotateRule) OutdatedFiles() []string {
+	var outdates []string
+	seen := make(map[string]struct{})
+	for _, rule := range r.rules {
+		for _, file := range rule.OutdatedFiles() {
+			if _, ok := seen[file]; !ok {
+				seen[file] = struct{}{}
+				outdates = append(outdates, file)
+			}
+		}
+	}
+
+	return outdates
+}
+
+func (r *CombinedRotateRule) ShallRotate() bool {
+	for _, rule := range r.rules {
+		if rule.ShallRotate() {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *CombinedRotateRule) shallRotateAtSize(size int64) bool {
+	for _, rule := range r.rules {
+		if sizeRule, ok := rule.(sizeRotateRule); ok && sizeRule.shallRotateAtSize(size) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// shallRotate tells whether rule shall rotate the file of size bytes,
+// by time, or by size if rule is a sizeRotateRule.
+func shallRotate(rule RotateRule, size int64) bool {
+	if rule.ShallRotate() {
+		return true
+	}
+
+	sizeRule, ok := rule.(sizeRotateRule)
+	return ok && sizeRule.shallRotateAtSize(size)
 }
 
 func NewLogger(filename string, rule RotateRule, compress bool) (*RotateLogger, error) {
@@ -170,7 +381,7 @@ func (l *RotateLogger) getBackupFilename() string {
 func (l *RotateLogger) init() error {
 	l.backup = l.rule.BackupFileName()
 
-	if _, err := os.Stat(l.filename); err != nil {
+	if info, err := os.Stat(l.filename); err != nil {
 		basePath := path.Dir(l.filename)
 		if _, err = os.Stat(basePath); err != nil {
 			if err = os.MkdirAll(basePath, defaultDirMode); err != nil {
@@ -183,6 +394,8 @@ func (l *RotateLogger) init() error {
 		}
 	} else if l.fp, err = os.OpenFile(l.filename, os.O_APPEND|os.O_WRONLY, defaultFileMode); err != nil {
 		return err
+	} else {
+		l.currentSize = info.Size()
 	}
 	if l.fp != nil {
 		syscall.CloseOnExec(int(l.fp.Fd()))
@@ -239,6 +452,7 @@ func (l *RotateLogger) rotate() error {
 	}
 
 	l.backup = l.rule.BackupFileName()
+	l.currentSize = 0
 	if l.fp, err = os.Create(l.filename); err == nil {
 		if l.fp != nil {
 			syscall.CloseOnExec(int(l.fp.Fd()))
@@ -266,7 +480,7 @@ func (l *RotateLogger) startWorker() {
 }
 
 func (l *RotateLogger) write(v []byte) {
-	if l.rule.ShallRotate() {
+	if shallRotate(l.rule, l.currentSize) {
 		if err := l.rotate(); err != nil {
 			log.Println(err)
 		} else {
@@ -274,7 +488,8 @@ func (l *RotateLogger) write(v []byte) {
 		}
 	}
 	if l.fp != nil {
-		l.fp.Write(v)
+		n, _ := l.fp.Write(v)
+		l.currentSize += int64(n)
 	}
 }
 
@@ -0,0 +1,84 @@
+package logx
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSizeLimitRotateRuleOutdatedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotate")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "access.log")
+	old := time.Now().Add(-time.Hour * 24 * 3).Format(backupTimeFormat)
+	backups := []string{
+		filename + "-" + old,
+		filename + "-2100-01-01T00-00-00.000",
+		filename + "-2100-01-01T00-00-01.000",
+		filename + "-2100-01-01T00-00-02.000",
+	}
+	for _, backup := range backups {
+		assert.Nil(t, ioutil.WriteFile(backup, make([]byte, megabyte), defaultFileMode))
+	}
+
+	rule := NewSizeLimitRotateRule(filename, "-", 2, 1, 0, 0, false)
+	assert.Equal(t, backups[:1], rule.OutdatedFiles())
+	rule = NewSizeLimitRotateRule(filename, "-", 0, 1, 2, 0, false)
+	assert.Equal(t, backups[:2], rule.OutdatedFiles())
+	rule = NewSizeLimitRotateRule(filename, "-", 0, 1, 0, 1, false)
+	assert.Equal(t, backups[:3], rule.OutdatedFiles())
+	rule = NewCombinedRotateRule(NewSizeLimitRotateRule(filename, "-", 0, 1, 3, 0, false),
+		DefaultRotateRule(filename, "-", 2, false))
+	assert.Equal(t, backups[:1], rule.OutdatedFiles())
+
+	assert.False(t, shallRotate(rule, megabyte-1))
+	assert.True(t, shallRotate(rule, megabyte))
+}
+
+func TestShallRotate(t *testing.T) {
+	sizeRule := NewSizeLimitRotateRule("access.log", "-", 0, 1, 0, 0, false)
+	assert.False(t, sizeRule.ShallRotate())
+	assert.True(t, shallRotate(sizeRule, megabyte))
+
+	// the rules without sizeRotateRule only rotate by time
+	dailyRule := DefaultRotateRule("access.log", "-", 0, false)
+	assert.False(t, shallRotate(dailyRule, megabyte*1024))
+	dailyRule.(*DailyRotateRule).rotatedTime = "2000-01-01"
+	assert.True(t, dailyRule.ShallRotate())
+	rule := NewCombinedRotateRule(sizeRule, dailyRule)
+	assert.True(t, rule.ShallRotate())
+	assert.True(t, shallRotate(rule, 0))
+}
+
+func TestRotateLoggerBySize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotate")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "access.log")
+	rule := NewSizeLimitRotateRule(filename, "-", 0, 1, 0, 0, false)
+	logger, err := NewLogger(filename, rule, false)
+	assert.Nil(t, err)
+
+	line := []byte(strings.Repeat("a", megabyte/2) + "\n")
+	for i := 0; i < 3; i++ {
+		logger.Write(line)
+		// different backup names in milliseconds
+		time.Sleep(2 * time.Millisecond)
+	}
+	assert.Nil(t, logger.Close())
+
+	backups, err := filepath.Glob(filename + "-*")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(backups))
+	info, err := os.Stat(filename)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(line)), info.Size())
+}
@@ -3,6 +3,21 @@ package mapping
 import "fmt"
 
 type (
+	// FieldOptions are the key and the options of a field tag, like json:"age,default=18,range=[0:150]".
+	FieldOptions struct {
+		Key         string
+		FromString  bool
+		Optional    bool
+		OptionalDep string
+		Options     []string
+		Default     string
+		// the bounds of the range option, nil if not bounded
+		Minimum          *float64
+		Maximum          *float64
+		ExclusiveMinimum bool
+		ExclusiveMaximum bool
+	}
+
 	// use context and OptionalDep option to determine the value of Optional
 	// nothing to do with context.Context
 	fieldOptionsWithContext struct {
@@ -26,6 +41,13 @@ type (
 	}
 )
 
+// Required tells whether the field is reported as required if it's missing,
+// only the fields with options or range are validated.
+func (o FieldOptions) Required() bool {
+	return !o.Optional && len(o.Default) == 0 &&
+		(len(o.Options) > 0 || o.Minimum != nil || o.Maximum != nil)
+}
+
 func (o *fieldOptionsWithContext) fromString() bool {
 	return o != nil && o.FromString
 }
@@ -85,6 +107,7 @@ func (o *fieldOptions) toOptionsWithContext(key string, m Valuer) (*fieldOptions
 			Optional:   optional,
 			Options:    o.Options,
 			Default:    o.Default,
+			Range:      o.Range,
 		}, nil
 	}
 }
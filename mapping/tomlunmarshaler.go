@@ -0,0 +1,53 @@
+package mapping
+
+import (
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// UnmarshalTomlBytes unmarshals the toml content into v with the json tag keys and options,
+// see UnmarshalJsonBytes.
+func UnmarshalTomlBytes(content []byte, v interface{}) error {
+	m, err := TomlBytesToMap(content)
+	if err != nil {
+		return err
+	}
+
+	return UnmarshalKey(m, v)
+}
+
+// TomlBytesToMap decodes the toml content to a map like the one of JsonBytesToMap,
+// the datetimes are converted to RFC 3339 strings.
+func TomlBytesToMap(content []byte) (map[string]interface{}, error) {
+	var m map[string]interface{}
+	if _, err := toml.Decode(string(content), &m); err != nil {
+		return nil, err
+	}
+
+	return toJsonValue(toTomlValue(m)).(map[string]interface{}), nil
+}
+
+func toTomlValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, item := range val {
+			val[k] = toTomlValue(item)
+		}
+		return val
+	case []interface{}:
+		for i, item := range val {
+			val[i] = toTomlValue(item)
+		}
+		return val
+	case []map[string]interface{}:
+		for _, item := range val {
+			toTomlValue(item)
+		}
+		return val
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
+	default:
+		return v
+	}
+}
@@ -0,0 +1,421 @@
+package mapping
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const jsonTagKey = "json"
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+type (
+	// Unmarshaler fills structs from maps with the options of the tags named key,
+	// like `json:"name,default=x,options=x|y,range=[1:5],optional"`.
+	Unmarshaler struct {
+		key string
+	}
+
+	// keyValuer looks up the keys like encoding/json, the exact key first, then case-insensitively.
+	keyValuer map[string]interface{}
+)
+
+// NewUnmarshaler returns an Unmarshaler using the tags named key.
+func NewUnmarshaler(key string) *Unmarshaler {
+	return &Unmarshaler{
+		key: key,
+	}
+}
+
+// UnmarshalJsonBytes unmarshals the json object content into v with the json tag options:
+// the missing fields get their default values or fail unless optional,
+// and the values must be one of options and within range.
+// The fields without options keep the encoding/json behaviour, they may be missing.
+// All the failed fields are returned in ValidationErrors, named by their paths like Log.Level or Static[0].Dir.
+func UnmarshalJsonBytes(content []byte, v interface{}) error {
+	m, err := JsonBytesToMap(content)
+	if err != nil {
+		return err
+	}
+
+	return UnmarshalKey(m, v)
+}
+
+// JsonBytesToMap decodes the json object content to a map for UnmarshalKey, the numbers are json.Number.
+func JsonBytesToMap(content []byte) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+
+	var m map[string]interface{}
+	if err := decoder.Decode(&m); err != nil {
+		return nil, jsonError(content, err)
+	}
+	if m == nil {
+		// null
+		m = make(map[string]interface{})
+	}
+
+	return m, nil
+}
+
+// UnmarshalKey unmarshals m into v by the json tag keys and options, see UnmarshalJsonBytes.
+func UnmarshalKey(m map[string]interface{}, v interface{}) error {
+	return NewUnmarshaler(jsonTagKey).Unmarshal(m, v)
+}
+
+// Unmarshal unmarshals m into the struct pointed by v.
+func (u *Unmarshaler) Unmarshal(m map[string]interface{}, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if err := ValidatePtr(&rv); err != nil {
+		return err
+	}
+
+	rv = rv.Elem()
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("%v must be a struct pointer", v)
+	}
+
+	var errs ValidationErrors
+	if err := u.fillStruct(rv, keyValuer(m), "", &errs); err != nil {
+		return err
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// fillStruct fills value with m, the field errors are appended to errs,
+// the returned error means the wrong tags of the struct.
+func (u *Unmarshaler) fillStruct(value reflect.Value, m Valuer, prefix string, errs *ValidationErrors) error {
+	rt := value.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		fieldValue := value.Field(i)
+		// the exported fields of the embedded structs are promoted even if the structs are unexported
+		if field.Anonymous && len(field.Tag.Get(u.key)) == 0 && Deref(field.Type).Kind() == reflect.Struct &&
+			(fieldValue.CanSet() || field.Type.Kind() == reflect.Struct) {
+			maybeNewValue(field, fieldValue)
+			if err := u.fillStruct(reflect.Indirect(fieldValue), m, prefix, errs); err != nil {
+				return err
+			}
+			continue
+		}
+		if !fieldValue.CanSet() {
+			continue
+		}
+
+		key, opts, err := parseKeyAndOptions(u.key, field)
+		if err != nil {
+			return err
+		}
+		if key == "-" {
+			continue
+		}
+
+		fullName := joinFieldName(prefix, key)
+		var optsWithContext *fieldOptionsWithContext
+		if opts != nil {
+			if optsWithContext, err = opts.toOptionsWithContext(key, m); err != nil {
+				*errs = append(*errs, &FieldError{Field: fullName, Message: err.Error()})
+				continue
+			}
+		}
+
+		mapValue, hasValue := m.Value(key)
+		if !hasValue || mapValue == nil {
+			if def, ok := optsWithContext.getDefault(); ok {
+				if err := setDefaultValue(field, fieldValue, def); err != nil {
+					return fmt.Errorf("field %s has wrong default value: %s", fullName, err)
+				}
+			} else if hasValidationOptions(opts) && !optsWithContext.optional() {
+				*errs = append(*errs, &FieldError{Field: fullName, Message: "is required"})
+			} else if field.Type.Kind() == reflect.Struct && isNestedStruct(field.Type) {
+				// apply the defaults of the missing struct, its required fields are
+				// only reported if the struct is not optional
+				var nestedErrs ValidationErrors
+				if err := u.fillStruct(fieldValue, keyValuer{}, fullName, &nestedErrs); err != nil {
+					return err
+				}
+				if !optsWithContext.optional() {
+					*errs = append(*errs, nestedErrs...)
+				}
+			}
+			continue
+		}
+
+		numErrs := len(*errs)
+		if err := u.fillValue(fieldValue, mapValue, optsWithContext.fromString(), fullName, errs); err != nil {
+			return err
+		}
+		if len(*errs) > numErrs || optsWithContext == nil {
+			continue
+		}
+
+		if message, ok := checkOptions(reflect.Indirect(fieldValue), optsWithContext); !ok {
+			*errs = append(*errs, &FieldError{Field: fullName, Message: message})
+		}
+	}
+
+	return nil
+}
+
+func (u *Unmarshaler) fillValue(value reflect.Value, mapValue interface{}, fromString bool,
+	fullName string, errs *ValidationErrors) error {
+	fail := func(format string, args ...interface{}) error {
+		*errs = append(*errs, &FieldError{Field: fullName, Message: fmt.Sprintf(format, args...)})
+		return nil
+	}
+
+	if mapValue == nil {
+		return nil
+	}
+
+	rt := value.Type()
+	if rt.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			value.Set(reflect.New(rt.Elem()))
+		}
+		return u.fillValue(value.Elem(), mapValue, fromString, fullName, errs)
+	}
+
+	if reflect.PtrTo(rt).Implements(jsonUnmarshalerType) || reflect.PtrTo(rt).Implements(textUnmarshalerType) {
+		if err := fillWithJson(value, mapValue); err != nil {
+			return fail("%s", err)
+		}
+		return nil
+	}
+
+	if rt == durationType {
+		switch v := mapValue.(type) {
+		case string:
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return fail("value %q is not a duration", v)
+			}
+			value.SetInt(int64(d))
+			return nil
+		case json.Number:
+			// nanoseconds, like encoding/json
+			n, err := v.Int64()
+			if err != nil {
+				return fail("value %s is not a duration", v)
+			}
+			value.SetInt(n)
+			return nil
+		}
+	}
+
+	switch rt.Kind() {
+	case reflect.Struct:
+		sub, ok := mapValue.(map[string]interface{})
+		if !ok {
+			return fail("expect an object, got %s", jsonKind(mapValue))
+		}
+		return u.fillStruct(value, keyValuer(sub), fullName, errs)
+	case reflect.Slice:
+		items, ok := mapValue.([]interface{})
+		if !ok {
+			if rt.Elem().Kind() == reflect.Uint8 {
+				// []byte is base64 in json
+				if err := fillWithJson(value, mapValue); err != nil {
+					return fail("%s", err)
+				}
+				return nil
+			}
+			return fail("expect an array, got %s", jsonKind(mapValue))
+		}
+
+		slice := reflect.MakeSlice(rt, len(items), len(items))
+		for i, item := range items {
+			if err := u.fillValue(slice.Index(i), item, fromString, fullName+"["+strconv.Itoa(i)+"]",
+				errs); err != nil {
+				return err
+			}
+		}
+		value.Set(slice)
+		return nil
+	case reflect.Bool:
+		switch v := mapValue.(type) {
+		case bool:
+			value.SetBool(v)
+			return nil
+		case string:
+			if fromString {
+				b, err := strconv.ParseBool(v)
+				if err != nil {
+					return fail("value %q is not a bool", v)
+				}
+				value.SetBool(b)
+				return nil
+			}
+		}
+		return fail("expect a bool, got %s", jsonKind(mapValue))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		str, ok := numberString(mapValue, fromString)
+		if !ok {
+			return fail("expect a number, got %s", jsonKind(mapValue))
+		}
+		n, err := strconv.ParseInt(str, 10, 64)
+		if err != nil || value.OverflowInt(n) {
+			return fail("value %s is not a valid %s", str, rt.Kind())
+		}
+		value.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		str, ok := numberString(mapValue, fromString)
+		if !ok {
+			return fail("expect a number, got %s", jsonKind(mapValue))
+		}
+		n, err := strconv.ParseUint(str, 10, 64)
+		if err != nil || value.OverflowUint(n) {
+			return fail("value %s is not a valid %s", str, rt.Kind())
+		}
+		value.SetUint(n)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		str, ok := numberString(mapValue, fromString)
+		if !ok {
+			return fail("expect a number, got %s", jsonKind(mapValue))
+		}
+		f, err := strconv.ParseFloat(str, 64)
+		if err != nil || value.OverflowFloat(f) {
+			return fail("value %s is not a valid %s", str, rt.Kind())
+		}
+		value.SetFloat(f)
+		return nil
+	case reflect.String:
+		switch v := mapValue.(type) {
+		case string:
+			value.SetString(v)
+			return nil
+		case json.Number:
+			if fromString {
+				value.SetString(v.String())
+				return nil
+			}
+		}
+		return fail("expect a string, got %s", jsonKind(mapValue))
+	default:
+		// maps, interfaces and arrays are decoded like encoding/json does
+		if err := fillWithJson(value, mapValue); err != nil {
+			return fail("%s", err)
+		}
+		return nil
+	}
+}
+
+func (kv keyValuer) Value(key string) (interface{}, bool) {
+	if v, ok := kv[key]; ok {
+		return v, true
+	}
+
+	for k, v := range kv {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+
+	return nil, false
+}
+
+func fillWithJson(value reflect.Value, mapValue interface{}) error {
+	content, err := json.Marshal(mapValue)
+	if err != nil {
+		return err
+	}
+
+	ptr := reflect.New(value.Type())
+	if err := json.Unmarshal(content, ptr.Interface()); err != nil {
+		if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+			return fmt.Errorf("expect %s, got %s", typeErr.Type, typeErr.Value)
+		}
+		return err
+	}
+
+	value.Set(ptr.Elem())
+	return nil
+}
+
+func setDefaultValue(field reflect.StructField, value reflect.Value, def string) error {
+	if Deref(field.Type) == durationType {
+		d, err := time.ParseDuration(def)
+		if err != nil {
+			return err
+		}
+		maybeNewValue(field, value)
+		reflect.Indirect(value).SetInt(int64(d))
+		return nil
+	}
+
+	return setDefault(field, value, def)
+}
+
+// numberString returns the number in v, the strings are accepted with the string option.
+func numberString(v interface{}, fromString bool) (string, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		return n.String(), true
+	case string:
+		return n, fromString
+	default:
+		if f, ok := toFloat64(v); ok {
+			return strconv.FormatFloat(f, 'f', -1, 64), true
+		}
+		return "", false
+	}
+}
+
+func jsonKind(v interface{}) string {
+	switch val := v.(type) {
+	case bool:
+		return "bool " + strconv.FormatBool(val)
+	case string:
+		return strconv.Quote(val)
+	case json.Number:
+		return "number " + val.String()
+	case []interface{}:
+		return "an array"
+	case map[string]interface{}:
+		return "an object"
+	default:
+		if _, ok := toFloat64(v); ok {
+			return fmt.Sprintf("number %v", v)
+		}
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// jsonError tells the line and column of the json syntax errors.
+func jsonError(content []byte, err error) error {
+	var offset int64
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		offset = e.Offset
+	case *json.UnmarshalTypeError:
+		return fmt.Errorf("expect a json object, got %s", e.Value)
+	default:
+		return err
+	}
+
+	if offset > int64(len(content)) {
+		offset = int64(len(content))
+	}
+	// Offset is right after the bad character
+	line := 1 + bytes.Count(content[:offset], []byte{'\n'})
+	column := offset - int64(bytes.LastIndexByte(content[:offset], '\n')) - 1
+
+	return fmt.Errorf("line %d, column %d: %s", line, column, err)
+}
@@ -0,0 +1,128 @@
+package mapping
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnmarshalJsonBytes(t *testing.T) {
+	type log struct {
+		Mode  string `json:",default=console,options=console|file"`
+		Level string `json:",default=info"`
+	}
+	type static struct {
+		Prefix string
+		MaxAge int `json:",optional,range=[0:86400]"`
+	}
+	type base struct {
+		Log  log
+		Name string
+	}
+	type config struct {
+		base
+		Port    int64         `json:",range=[1:65535]"`
+		Timeout time.Duration `json:",default=3s"`
+		Ratio   float64       `json:",optional"`
+		Static  []static      `json:",optional"`
+		Pages   map[string]string
+		ID      int64 `json:",string,optional"`
+	}
+
+	var c config
+	assert.Nil(t, UnmarshalJsonBytes([]byte(`{
+		"name": "api",
+		"log": {"mode": "file"},
+		"port": 8080,
+		"static": [{"prefix": "/s", "maxage": 60}],
+		"pages": {"404": "404.html"},
+		"id": "9007199254740993"
+	}`), &c))
+	assert.Equal(t, "api", c.Name)
+	assert.Equal(t, "file", c.Log.Mode)
+	assert.Equal(t, "info", c.Log.Level)
+	assert.Equal(t, int64(8080), c.Port)
+	assert.Equal(t, 3*time.Second, c.Timeout)
+	assert.Equal(t, []static{{Prefix: "/s", MaxAge: 60}}, c.Static)
+	assert.Equal(t, map[string]string{"404": "404.html"}, c.Pages)
+	assert.Equal(t, int64(9007199254740993), c.ID)
+
+	c = config{}
+	assert.Nil(t, UnmarshalJsonBytes([]byte(`{"Port": 1}`), &c))
+	assert.Equal(t, "console", c.Log.Mode)
+
+	c = config{}
+	err := UnmarshalJsonBytes([]byte(`{
+		"log": {"mode": "volume"},
+		"timeout": "3 seconds",
+		"ratio": "0.5",
+		"static": [{"maxage": 60}, {"maxage": -1}]
+	}`), &c)
+	assert.Equal(t, `Log.Mode: value "volume" is not one of console|file; `+
+		`Port: is required; Timeout: value "3 seconds" is not a duration; Ratio: expect a number, got "0.5"; `+
+		`Static[1].MaxAge: value -1 is out of range [0:86400]`, err.Error())
+
+	err = UnmarshalJsonBytes([]byte("{\n\t\"port\": 1,\n\t\"name\" \"api\"\n}"), &c)
+	assert.Equal(t, "line 3, column 9: invalid character '\"' after object key", err.Error())
+}
+
+func TestParseFieldOptions(t *testing.T) {
+	type user struct {
+		Name  string
+		Age   int    `json:"age,string,range=(0:150]"`
+		Role  string `json:"role,optional=name,options=admin|user"`
+		Level int    `json:",default=1,range=[1:]"`
+		Skip  string `json:"-"`
+		Wrong int    `json:"wrong,range=[1]"`
+	}
+
+	rt := reflect.TypeOf(user{})
+	parse := func(name string) (FieldOptions, error) {
+		field, _ := rt.FieldByName(name)
+		return ParseFieldOptions("json", field)
+	}
+
+	opts, err := parse("Name")
+	assert.Nil(t, err)
+	assert.Equal(t, FieldOptions{Key: "Name"}, opts)
+	assert.False(t, opts.Required())
+
+	opts, err = parse("Age")
+	assert.Nil(t, err)
+	assert.Equal(t, "age", opts.Key)
+	assert.True(t, opts.FromString)
+	assert.Equal(t, float64(0), *opts.Minimum)
+	assert.True(t, opts.ExclusiveMinimum)
+	assert.Equal(t, float64(150), *opts.Maximum)
+	assert.False(t, opts.ExclusiveMaximum)
+	assert.True(t, opts.Required())
+
+	opts, err = parse("Role")
+	assert.Nil(t, err)
+	assert.True(t, opts.Optional)
+	assert.Equal(t, "name", opts.OptionalDep)
+	assert.Equal(t, []string{"admin", "user"}, opts.Options)
+	assert.False(t, opts.Required())
+	// the cached options are not shared
+	opts.Options[0] = "root"
+	opts, err = parse("Role")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"admin", "user"}, opts.Options)
+
+	opts, err = parse("Level")
+	assert.Nil(t, err)
+	assert.Equal(t, "Level", opts.Key)
+	assert.Equal(t, "1", opts.Default)
+	assert.Equal(t, float64(1), *opts.Minimum)
+	assert.Nil(t, opts.Maximum)
+	assert.False(t, opts.Required())
+
+	opts, err = parse("Skip")
+	assert.Nil(t, err)
+	assert.Equal(t, "-", opts.Key)
+
+	_, err = parse("Wrong")
+	assert.NotNil(t, err)
+}
@@ -172,6 +172,41 @@ func maybeNewValue(field reflect.StructField, value reflect.Value) {
 	}
 }
 
+// ParseFieldOptions parses the tagName tag of field the same way as unmarshaling,
+// the key is the field name if it's not in the tag.
+func ParseFieldOptions(tagName string, field reflect.StructField) (FieldOptions, error) {
+	key, opts, err := parseKeyAndOptions(tagName, field)
+	if err != nil {
+		return FieldOptions{}, err
+	}
+
+	fieldOpts := FieldOptions{Key: key}
+	if opts == nil {
+		return fieldOpts, nil
+	}
+
+	fieldOpts.FromString = opts.FromString
+	fieldOpts.Optional = opts.Optional
+	fieldOpts.OptionalDep = opts.OptionalDep
+	// the options are cached, copy them to keep the cache intact
+	fieldOpts.Options = append([]string(nil), opts.Options...)
+	fieldOpts.Default = opts.Default
+	if nr := opts.Range; nr != nil {
+		if nr.left > -math.MaxFloat64 {
+			left := nr.left
+			fieldOpts.Minimum = &left
+			fieldOpts.ExclusiveMinimum = !nr.leftInclude
+		}
+		if nr.right < math.MaxFloat64 {
+			right := nr.right
+			fieldOpts.Maximum = &right
+			fieldOpts.ExclusiveMaximum = !nr.rightInclude
+		}
+	}
+
+	return fieldOpts, nil
+}
+
 // don't modify returned fieldOptions, it's cached and shared among different calls.
 func parseKeyAndOptions(tagName string, field reflect.StructField) (string, *fieldOptions, error) {
 	value := field.Tag.Get(tagName)
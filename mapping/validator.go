@@ -0,0 +1,220 @@
+package mapping
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/weblazy/core/stringx"
+)
+
+type (
+	// FieldError describes why a field failed the validation.
+	FieldError struct {
+		Field   string `json:"field"`
+		Message string `json:"message"`
+	}
+
+	// ValidationErrors lists all the fields failed the validation.
+	ValidationErrors []*FieldError
+)
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, fe := range e {
+		messages[i] = fe.Error()
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+// Validate checks the struct pointed by v with the options of tagName tags, m tells which keys are provided.
+// Only the fields with options like default, optional, options and range are validated:
+// missing fields get their default values or fail unless optional,
+// provided fields must be one of options and within range.
+// Nested structs are validated with the nested maps of m, anonymous structs with m itself.
+func Validate(tagName string, v interface{}, m Valuer) error {
+	rv := reflect.ValueOf(v)
+	if err := ValidatePtr(&rv); err != nil {
+		return err
+	}
+
+	rv = rv.Elem()
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("%v must be a struct pointer", v)
+	}
+
+	var errs ValidationErrors
+	if err := validateStruct(tagName, rv, m, "", &errs); err != nil {
+		return err
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func validateStruct(tagName string, value reflect.Value, m Valuer, prefix string, errs *ValidationErrors) error {
+	rt := value.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		fieldValue := value.Field(i)
+		if !fieldValue.CanSet() {
+			continue
+		}
+
+		if field.Anonymous && Deref(field.Type).Kind() == reflect.Struct {
+			maybeNewValue(field, fieldValue)
+			if err := validateStruct(tagName, reflect.Indirect(fieldValue), m, prefix, errs); err != nil {
+				return err
+			}
+			continue
+		}
+
+		key, opts, err := parseKeyAndOptions(tagName, field)
+		if err != nil {
+			return err
+		}
+		if key == "-" {
+			continue
+		}
+
+		fullName := joinFieldName(prefix, key)
+		mapValue, hasValue := m.Value(key)
+		if hasValue && isNestedStruct(field.Type) {
+			if sub, ok := mapValue.(map[string]interface{}); ok {
+				maybeNewValue(field, fieldValue)
+				if err := validateStruct(tagName, reflect.Indirect(fieldValue), MapValuer(sub),
+					fullName, errs); err != nil {
+					return err
+				}
+			}
+		}
+
+		if !hasValidationOptions(opts) {
+			continue
+		}
+
+		optsWithContext, err := opts.toOptionsWithContext(key, m)
+		if err != nil {
+			*errs = append(*errs, &FieldError{Field: fullName, Message: err.Error()})
+			continue
+		}
+
+		if !hasValue {
+			if def, ok := optsWithContext.getDefault(); ok {
+				if err := setDefault(field, fieldValue, def); err != nil {
+					return fmt.Errorf("field %s has wrong default value: %s", fullName, err)
+				}
+			} else if !optsWithContext.optional() {
+				*errs = append(*errs, &FieldError{Field: fullName, Message: "is required"})
+			}
+			continue
+		}
+
+		if message, ok := checkOptions(reflect.Indirect(fieldValue), optsWithContext); !ok {
+			*errs = append(*errs, &FieldError{Field: fullName, Message: message})
+		}
+	}
+
+	return nil
+}
+
+func checkOptions(value reflect.Value, opts *fieldOptionsWithContext) (string, bool) {
+	if !value.IsValid() {
+		return "", true
+	}
+
+	if options := opts.options(); len(options) > 0 {
+		str := Repr(value.Interface())
+		if !stringx.Contains(options, str) {
+			return fmt.Sprintf("value %q is not one of %s", str, strings.Join(options, "|")), false
+		}
+	}
+
+	if nr := opts.Range; nr != nil {
+		fv, ok := toFloat64(value.Interface())
+		if !ok {
+			return "range is only allowed on numbers", false
+		}
+		if !nr.contains(fv) {
+			return fmt.Sprintf("value %v is out of range %s", value.Interface(), nr), false
+		}
+	}
+
+	return "", true
+}
+
+func hasValidationOptions(opts *fieldOptions) bool {
+	return opts != nil && (opts.Optional || len(opts.Default) > 0 || len(opts.Options) > 0 || opts.Range != nil)
+}
+
+func isNestedStruct(t reflect.Type) bool {
+	t = Deref(t)
+	return t.Kind() == reflect.Struct && t.PkgPath() != "time"
+}
+
+func joinFieldName(prefix, key string) string {
+	if len(prefix) == 0 {
+		return key
+	}
+
+	return prefix + "." + key
+}
+
+func setDefault(field reflect.StructField, value reflect.Value, def string) error {
+	maybeNewValue(field, value)
+	value = reflect.Indirect(value)
+	return setValue(value.Kind(), value, def)
+}
+
+func (nr *numberRange) contains(v float64) bool {
+	if nr.leftInclude {
+		if v < nr.left {
+			return false
+		}
+	} else if v <= nr.left {
+		return false
+	}
+
+	if nr.rightInclude {
+		if v > nr.right {
+			return false
+		}
+	} else if v >= nr.right {
+		return false
+	}
+
+	return true
+}
+
+func (nr *numberRange) String() string {
+	var buf strings.Builder
+	if nr.leftInclude {
+		buf.WriteByte('[')
+	} else {
+		buf.WriteByte('(')
+	}
+	if nr.left > -math.MaxFloat64 {
+		buf.WriteString(strconv.FormatFloat(nr.left, 'f', -1, 64))
+	}
+	buf.WriteByte(':')
+	if nr.right < math.MaxFloat64 {
+		buf.WriteString(strconv.FormatFloat(nr.right, 'f', -1, 64))
+	}
+	if nr.rightInclude {
+		buf.WriteByte(']')
+	} else {
+		buf.WriteByte(')')
+	}
+
+	return buf.String()
+}
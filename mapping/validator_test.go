@@ -0,0 +1,66 @@
+package mapping
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	type inner struct {
+		Level string `json:"level,options=info|error"`
+	}
+	type request struct {
+		Name   string  `json:"name"`
+		Mode   string  `json:"mode,default=console,options=console|file"`
+		Age    int     `json:"age,range=[0:150]"`
+		Ratio  float64 `json:"ratio,optional,range=(0:1]"`
+		Remark string  `json:"remark,optional"`
+		Inner  inner   `json:"inner,optional"`
+	}
+
+	var req request
+	assert.Nil(t, Validate("json", &req, MapValuer{"age": 20}))
+	assert.Equal(t, "console", req.Mode)
+
+	req = request{Mode: "volume", Age: 200, Inner: inner{Level: "debug"}}
+	err := Validate("json", &req, MapValuer{
+		"mode":  "volume",
+		"age":   200,
+		"ratio": 0,
+		"inner": map[string]interface{}{"level": "debug"},
+	})
+	errs, ok := err.(ValidationErrors)
+	assert.True(t, ok)
+	var fields []string
+	for _, fe := range errs {
+		fields = append(fields, fe.Field)
+	}
+	assert.Equal(t, []string{"mode", "age", "ratio", "inner.level"}, fields)
+
+	req = request{}
+	err = Validate("json", &req, MapValuer{})
+	assert.Equal(t, "age: is required", err.Error())
+}
+
+func TestNumberRangeContains(t *testing.T) {
+	tests := []struct {
+		rng    string
+		value  float64
+		expect bool
+	}{
+		{"[1:5]", 1, true},
+		{"(1:5]", 1, false},
+		{"[1:5)", 5, false},
+		{"[1:]", 100, true},
+		{"(:5]", -100, true},
+	}
+	for _, test := range tests {
+		t.Run(test.rng, func(t *testing.T) {
+			nr, err := parseNumberRange(test.rng)
+			assert.Nil(t, err)
+			assert.Equal(t, test.expect, nr.contains(test.value))
+			assert.Equal(t, test.rng, nr.String())
+		})
+	}
+}
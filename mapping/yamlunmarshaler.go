@@ -0,0 +1,80 @@
+package mapping
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"gopkg.in/yaml.v2"
+)
+
+// UnmarshalYamlBytes unmarshals the yaml content into v with the json tag keys and options,
+// so the same struct is used for the json and yaml configs, see UnmarshalJsonBytes.
+func UnmarshalYamlBytes(content []byte, v interface{}) error {
+	m, err := YamlBytesToMap(content)
+	if err != nil {
+		return err
+	}
+
+	return UnmarshalKey(m, v)
+}
+
+// YamlBytesToMap decodes the yaml mapping content to a map like the one of JsonBytesToMap.
+func YamlBytesToMap(content []byte) (map[string]interface{}, error) {
+	var o interface{}
+	if err := yaml.Unmarshal(content, &o); err != nil {
+		return nil, err
+	}
+	if o == nil {
+		return make(map[string]interface{}), nil
+	}
+
+	value := toJsonValue(o)
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expect a yaml mapping, got %s", jsonKind(value))
+	}
+
+	return m, nil
+}
+
+// toJsonValue converts the decoded yaml and toml values to the ones decoded from json,
+// the maps are keyed by strings, and the numbers are json.Number.
+func toJsonValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			m[fmt.Sprint(k)] = toJsonValue(item)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			m[k] = toJsonValue(item)
+		}
+		return m
+	case []interface{}:
+		items := make([]interface{}, len(val))
+		for i, item := range val {
+			items[i] = toJsonValue(item)
+		}
+		return items
+	case []map[string]interface{}:
+		items := make([]interface{}, len(val))
+		for i, item := range val {
+			items[i] = toJsonValue(item)
+		}
+		return items
+	case int:
+		return json.Number(strconv.Itoa(val))
+	case int64:
+		return json.Number(strconv.FormatInt(val, 10))
+	case uint64:
+		return json.Number(strconv.FormatUint(val, 10))
+	case float64:
+		return json.Number(strconv.FormatFloat(val, 'f', -1, 64))
+	default:
+		return v
+	}
+}
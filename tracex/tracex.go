@@ -0,0 +1,141 @@
+package tracex
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/weblazy/core/stringx"
+)
+
+const (
+	// RequestIDHeader is the http header of the request id.
+	RequestIDHeader = "X-Request-Id"
+	// TraceparentHeader is the http header of the w3c trace context.
+	TraceparentHeader = "traceparent"
+
+	traceparentVersion = "00"
+	sampledFlag        = "01"
+	notSampledFlag     = "00"
+	traceIDLen         = 16
+	spanIDLen          = 8
+	maxRequestIDLen    = 128
+)
+
+var (
+	requestIDRegex   = regexp.MustCompile(`^[A-Za-z0-9._:-]+$`)
+	traceparentRegex = regexp.MustCompile(`^([0-9a-f]{2})-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$`)
+	zeroTraceID      = strings.Repeat("0", traceIDLen*2)
+	zeroSpanID       = strings.Repeat("0", spanIDLen*2)
+)
+
+type (
+	// Span is the tracing metadata of a request, following the w3c trace context.
+	Span struct {
+		TraceID  string
+		SpanID   string
+		ParentID string
+		Sampled  bool
+	}
+
+	requestIDKey struct{}
+	spanKey      struct{}
+)
+
+// NewRequestID returns a random request id.
+func NewRequestID() string {
+	return randomHex(traceIDLen)
+}
+
+// ValidRequestID tells whether id can be taken from the clients as the request id.
+func ValidRequestID(id string) bool {
+	return len(id) > 0 && len(id) <= maxRequestIDLen && requestIDRegex.MatchString(id)
+}
+
+// ContextWithRequestID returns a copy of ctx with the request id.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request id in ctx, empty if not set.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// ContextWithSpan returns a copy of ctx with span.
+func ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the span in ctx.
+func SpanFromContext(ctx context.Context) (Span, bool) {
+	span, ok := ctx.Value(spanKey{}).(Span)
+	return span, ok
+}
+
+// StartSpan returns a new span following the traceparent header,
+// a new trace is started if traceparent is empty or invalid.
+func StartSpan(traceparent string) Span {
+	parent, ok := ParseTraceparent(traceparent)
+	if !ok {
+		return Span{
+			TraceID: randomHex(traceIDLen),
+			SpanID:  randomHex(spanIDLen),
+			Sampled: true,
+		}
+	}
+
+	return parent.Child()
+}
+
+// Child returns a span of the same trace with s as its parent.
+func (s Span) Child() Span {
+	return Span{
+		TraceID:  s.TraceID,
+		SpanID:   randomHex(spanIDLen),
+		ParentID: s.SpanID,
+		Sampled:  s.Sampled,
+	}
+}
+
+// Traceparent returns the traceparent header of s to propagate to the downstream services.
+func (s Span) Traceparent() string {
+	flag := notSampledFlag
+	if s.Sampled {
+		flag = sampledFlag
+	}
+
+	return fmt.Sprintf("%s-%s-%s-%s", traceparentVersion, s.TraceID, s.SpanID, flag)
+}
+
+// ParseTraceparent parses the w3c traceparent header like 00-<trace id>-<parent id>-01.
+func ParseTraceparent(header string) (Span, bool) {
+	matches := traceparentRegex.FindStringSubmatch(strings.TrimSpace(header))
+	if len(matches) == 0 || matches[1] == "ff" || matches[2] == zeroTraceID || matches[3] == zeroSpanID {
+		return Span{}, false
+	}
+
+	flags, err := hex.DecodeString(matches[4])
+	if err != nil {
+		return Span{}, false
+	}
+
+	return Span{
+		TraceID: matches[2],
+		SpanID:  matches[3],
+		Sampled: flags[0]&1 == 1,
+	}, true
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return hex.EncodeToString([]byte(stringx.Randn(n)))
+	}
+
+	return hex.EncodeToString(b)
+}